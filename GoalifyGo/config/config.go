@@ -3,12 +3,14 @@ package config
 import (
 	"fmt"
 	"github.com/spf13/viper"
+	"strings"
 )
 
 // Config 存储所有配置信息
 type Config struct {
-	Environment string `mapstructure:"ENVIRONMENT"`
-	ServerPort  string `mapstructure:"SERVER_PORT"`
+	Environment    string `mapstructure:"ENVIRONMENT"`
+	ServerPort     string `mapstructure:"SERVER_PORT"`
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"` // 可信反向代理的 IP 或 CIDR，多个以逗号分隔；为空时不信任 X-Forwarded-For
 
 	// 数据库配置
 	DBHost     string `mapstructure:"DB_HOST"`
@@ -27,6 +29,13 @@ type Config struct {
 	DeepseekAPIKey      string `mapstructure:"DEEPSEEK_API_KEY"`
 	DeepseekAPIEndpoint string `mapstructure:"DEEPSEEK_API_ENDPOINT"`
 
+	// 大模型后端配置
+	LLMProvider string `mapstructure:"LLM_PROVIDER"` // deepseek（默认）, openai, ollama
+	LLMBaseURL  string `mapstructure:"LLM_BASE_URL"` // OpenAI 兼容接口或 Ollama 服务地址
+	LLMAPIKey   string `mapstructure:"LLM_API_KEY"`
+	LLMModel    string `mapstructure:"LLM_MODEL"`    // 后端默认模型
+	LLMProfiles string `mapstructure:"LLM_PROFILES"` // 按教练或场景指定模型和温度，如 "orange=deepseek-chat@0.8,summary=@0.3"
+
 	// 微信登录配置
 	WechatAppID     string `mapstructure:"WECHAT_APP_ID"`
 	WechatAppSecret string `mapstructure:"WECHAT_APP_SECRET"`
@@ -39,6 +48,27 @@ type Config struct {
 
 	// JWT配置
 	JWTSecret string `mapstructure:"JWT_SECRET"`
+
+	// 内部接口配置
+	InternalAuthToken string `mapstructure:"INTERNAL_AUTH_TOKEN"` // 内部接口通过 X-Internal-Auth 请求头携带的令牌，为空时拒绝所有受保护的内部请求
+
+	// 同步配置
+	TombstoneRetentionDays int `mapstructure:"TOMBSTONE_RETENTION_DAYS"` // 删除墓碑保留天数，默认90天
+
+	// 能量恢复配置
+	EnergyDailyGrant int    `mapstructure:"ENERGY_DAILY_GRANT"` // 每天免费恢复的能量，默认3点，负数表示关闭
+	EnergyDailyCap   int    `mapstructure:"ENERGY_DAILY_CAP"`   // 免费恢复的能量上限，默认20点
+	DefaultTimezone  string `mapstructure:"DEFAULT_TIMEZONE"`   // 客户端未提供时区时使用的时区，默认 Asia/Shanghai
+	EnergyRegenRules string `mapstructure:"ENERGY_REGEN_RULES"` // 各订阅等级的每日恢复和上限，如 "plus.grant=6,pro.cap=100"
+
+	// 订阅配置
+	EnergyCostRules string `mapstructure:"ENERGY_COST_RULES"` // 各订阅等级的能量消耗，如 "plus.chat=0,free.review_month=2"
+
+	// App Store 内购配置
+	AppStoreBundleID    string `mapstructure:"APPSTORE_BUNDLE_ID"`
+	AppStoreRootCerts   string `mapstructure:"APPSTORE_ROOT_CERTS"`  // 根证书文件路径（PEM 或 DER），多个以逗号分隔
+	AppStoreProducts    string `mapstructure:"APPSTORE_PRODUCTS"`    // 商品配置，如 "com.goalify.energy50=energy:50,com.goalify.plus.monthly=tier:plus"
+	AppStoreEnvironment string `mapstructure:"APPSTORE_ENVIRONMENT"` // 只接受该环境的交易（Production 或 Sandbox），为空时生产环境只接受 Production
 }
 
 // LoadConfig 从环境变量或配置文件加载配置
@@ -71,3 +101,19 @@ func (c *Config) GetDBConnString() string {
 func (c *Config) GetRedisConnString() string {
 	return fmt.Sprintf("%s:%s", c.RedisHost, c.RedisPort)
 }
+
+// GetTrustedProxies 返回可信反向代理列表
+func (c *Config) GetTrustedProxies() []string {
+	return SplitList(c.TrustedProxies)
+}
+
+// SplitList 解析以逗号分隔的配置项，忽略空白项
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -41,6 +41,11 @@ func InitDB(config Config) error {
 	//	return fmt.Errorf("数据库迁移失败: %v", err)
 	//}
 
+	// 执行各功能新增的表结构和数据迁移
+	if err := RunMigrations(DB); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -53,8 +58,19 @@ func migrateDB() error {
 		&models.Subtask{},
 		&models.EmotionRecord{},
 		&models.RedeemCode{},
+		&models.RedeemCampaign{},
+		&models.RedeemRedemption{},
 		&models.TimeRecord{},
 		&models.ReviewAnalysis{},
+		&models.SyncChange{},
+		&models.Conversation{},
+		&models.ConversationMessage{},
+		&models.Plan{},
+		&models.PendingEmotion{},
+		&models.EnergyReservation{},
+		&models.EnergyLedgerEntry{},
+		&models.Subscription{},
+		&models.AppStoreTransaction{},
 	)
 	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
@@ -42,4 +42,9 @@ func InitLogger() error {
     logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
     Logger = logger.Sugar()
     return nil
-} 
\ No newline at end of file
+}
+
+// LogSecurityEvent 记录安全事件，统一使用 securityEvent 字段便于检索和告警
+func LogSecurityEvent(event string, keysAndValues ...interface{}) {
+    Logger.Warnw("安全事件", append([]interface{}{"securityEvent", event}, keysAndValues...)...)
+}
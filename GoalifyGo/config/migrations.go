@@ -0,0 +1,243 @@
+package config
+
+import (
+	"GoalifyGo/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migration 启动时执行一次的表结构或数据变更，按 ID 记录在 schema_migrations 中。
+// 表结构变更只创建各自的表、列和索引，不对全部模型执行 AutoMigrate。
+type migration struct {
+	id  string
+	run func(tx *gorm.DB) error
+}
+
+// migrations 按顺序执行的迁移，已发布的迁移不要修改或删除，新的迁移追加在对应位置之后
+var migrations = []migration{
+	{
+		// 删除改为标记状态，供其他设备同步墓碑
+		id: "003_sync_status",
+		run: steps(
+			addColumns(&models.Task{}, "Status"),
+			addColumns(&models.Subtask{}, "Status"),
+			addColumns(&models.TimeRecord{}, "Status"),
+		),
+	},
+	{
+		// 清理变更日志时记录每个用户已清理的最大序号
+		id:  "003_sync_pruned_seq",
+		run: addColumns(&models.User{}, "SyncPrunedSeq"),
+	},
+	{
+		// 服务端同步变更日志和每个用户的变更序号
+		id: "004_sync_change_log",
+		run: steps(
+			createTables(&models.SyncChange{}),
+			addColumns(&models.User{}, "SyncSeq"),
+		),
+	},
+	{
+		// 子任务和计时记录保存客户端提交的修改时间
+		id: "004_client_modified",
+		run: steps(
+			addColumns(&models.Subtask{}, "ClientModified"),
+			addColumns(&models.TimeRecord{}, "ClientModified"),
+		),
+	},
+	{
+		// 任务和情绪记录按字段合并时使用的修改时间
+		id: "006_field_timestamps",
+		run: steps(
+			addColumns(&models.Task{}, "FieldModified"),
+			addColumns(&models.EmotionRecord{}, "FieldModified"),
+		),
+	},
+	{
+		// 任务和情绪记录保存客户端提交的修改时间，字段没有修改时间时用它比较
+		id: "006_client_modified",
+		run: steps(
+			addColumns(&models.Task{}, "ClientModified"),
+			addColumns(&models.EmotionRecord{}, "ClientModified"),
+		),
+	},
+	{
+		id:  "011_conversations",
+		run: createTables(&models.Conversation{}, &models.ConversationMessage{}),
+	},
+	{
+		id:  "013_plans",
+		run: createTables(&models.Plan{}),
+	},
+	{
+		// 计划生成的任务保留提醒时间和重复间隔
+		id:  "013_task_alarm_repeat_interval",
+		run: addColumns(&models.Task{}, "RepeatInterval", "AlarmDate"),
+	},
+	{
+		// 任务保存计划和客户端提交的优先级
+		id:  "013_task_priority",
+		run: addColumns(&models.Task{}, "Priority"),
+	},
+	{
+		id:  "014_pending_emotions",
+		run: createTables(&models.PendingEmotion{}),
+	},
+	{
+		id:  "018_energy_reservations",
+		run: createTables(&models.EnergyReservation{}),
+	},
+	{
+		id:  "019_energy_ledger",
+		run: createTables(&models.EnergyLedgerEntry{}),
+	},
+	{
+		// 已有用户以当前余额补写期初流水，使流水合计与余额一致
+		id: "019_energy_ledger_opening",
+		run: func(tx *gorm.DB) error {
+			return tx.Exec(`INSERT INTO energy_ledger (user_id, delta, reason, reference_id, balance_after, created_at)
+				SELECT id, energy, ?, '', energy, ? FROM users
+				WHERE NOT EXISTS (SELECT 1 FROM energy_ledger WHERE energy_ledger.user_id = users.id)`,
+				models.EnergyReasonInitial, time.Now()).Error
+		},
+	},
+	{
+		// 每日恢复能量的日期
+		id:  "021_energy_regen",
+		run: addColumns(&models.User{}, "LastEnergyGrantOn"),
+	},
+	{
+		// 服务端固定的用户时区
+		id:  "021_user_timezone",
+		run: addColumns(&models.User{}, "Timezone", "TimezoneChangedAt"),
+	},
+	{
+		id:  "022_subscriptions",
+		run: createTables(&models.Subscription{}),
+	},
+	{
+		id:  "023_appstore_transactions",
+		run: createTables(&models.AppStoreTransaction{}),
+	},
+	{
+		id: "024_redeem_campaigns",
+		run: steps(
+			createTables(&models.RedeemCampaign{}, &models.RedeemRedemption{}),
+			addColumns(&models.RedeemCode{}, "CampaignID", "MaxUses", "UseCount", "ExpiresAt"),
+			// 兑换码从 4 位加长到最多 32 位
+			alterColumns(&models.RedeemCode{}, "Code"),
+			// SQLite 修改列时会重建表，需要补回原有索引
+			addIndexes(&models.RedeemCode{}, "CampaignID", "Code", "UserID"),
+		),
+	},
+	{
+		// 新增兑换次数字段之前已使用的兑换码，补记为已兑换一次，否则旧兑换码可以再次兑换
+		id: "024_redeem_code_use_count",
+		run: func(tx *gorm.DB) error {
+			return tx.Model(&models.RedeemCode{}).
+				Where("used_at IS NOT NULL AND use_count = 0").
+				Update("use_count", 1).Error
+		},
+	},
+}
+
+// RunMigrations 执行尚未执行的迁移，执行成功后写入记录。
+// MySQL 的 DDL 会隐式提交事务，因此迁移不放在事务中，每一步都先检查表、列或索引是否已存在，
+// 中途失败后重新启动会从失败的步骤继续。
+func RunMigrations(db *gorm.DB) error {
+	if err := createTables(&models.SchemaMigration{})(db); err != nil {
+		return fmt.Errorf("创建迁移记录表失败: %v", err)
+	}
+
+	for _, m := range migrations {
+		var applied int64
+		if err := db.Model(&models.SchemaMigration{}).Where("id = ?", m.id).Count(&applied).Error; err != nil {
+			return fmt.Errorf("查询迁移记录失败: %v", err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		if err := m.run(db); err != nil {
+			return fmt.Errorf("迁移 %s 失败: %v", m.id, err)
+		}
+		record := models.SchemaMigration{ID: m.id, AppliedAt: time.Now()}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+			return fmt.Errorf("保存迁移记录 %s 失败: %v", m.id, err)
+		}
+		Logger.Infow("数据库迁移完成", "migration", m.id)
+	}
+	return nil
+}
+
+// steps 依次执行多个迁移步骤
+func steps(fns ...func(tx *gorm.DB) error) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, fn := range fns {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// createTables 创建不存在的表及其索引
+func createTables(tables ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, table := range tables {
+			if tx.Migrator().HasTable(table) {
+				continue
+			}
+			if err := tx.Migrator().CreateTable(table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumns 为已有的表添加不存在的列，fields 为模型字段名
+func addColumns(table interface{}, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, field := range fields {
+			if tx.Migrator().HasColumn(table, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(table, field); err != nil {
+				return fmt.Errorf("添加列 %s 失败: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
+
+// addIndexes 创建模型中声明但不存在的索引，names 为索引名或字段名
+func addIndexes(table interface{}, names ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, name := range names {
+			if tx.Migrator().HasIndex(table, name) {
+				continue
+			}
+			if err := tx.Migrator().CreateIndex(table, name); err != nil {
+				return fmt.Errorf("创建索引 %s 失败: %v", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// alterColumns 按模型定义修改列类型
+func alterColumns(table interface{}, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, field := range fields {
+			if err := tx.Migrator().AlterColumn(table, field); err != nil {
+				return fmt.Errorf("修改列 %s 失败: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,227 @@
+package config_test
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移之前线上已有的表结构
+type baselineUser struct {
+	ID                string `gorm:"type:varchar(50);primaryKey"`
+	Username          string `gorm:"type:varchar(100)"`
+	Email             string `gorm:"type:varchar(100)"`
+	CreatedAt         time.Time
+	Avatar            string `gorm:"type:varchar(255)"`
+	LastLogin         *time.Time
+	Provider          string `gorm:"type:varchar(50)"`
+	ProviderID        string `gorm:"type:varchar(50)"`
+	AppleRefreshToken string `gorm:"type:varchar(255)"`
+	IsTestUser        bool   `gorm:"default:false"`
+	Energy            int    `gorm:"default:20"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineTask struct {
+	ID           string `gorm:"type:varchar(50);primary_key"`
+	Title        string `gorm:"type:varchar(100)"`
+	IsCompleted  bool
+	Notes        string `gorm:"type:text"`
+	Deadline     *time.Time
+	PlannedDate  *time.Time
+	Difficulty   int    `gorm:"default:1"`
+	Quadrant     string `gorm:"type:varchar(30)"`
+	UserID       string `gorm:"type:varchar(50)"`
+	FocusTime    int    `gorm:"default:0"`
+	LastModified time.Time
+	RepeatType   string `gorm:"type:varchar(30)"`
+}
+
+func (baselineTask) TableName() string { return "tasks" }
+
+type baselineSubtask struct {
+	ID           string `gorm:"type:varchar(50);primaryKey"`
+	Title        string `gorm:"type:varchar(100)"`
+	IsCompleted  bool   `gorm:"default:false"`
+	TaskID       string `gorm:"type:varchar(50)"`
+	UserID       string `gorm:"type:varchar(50)"`
+	LastModified time.Time
+}
+
+func (baselineSubtask) TableName() string { return "subtasks" }
+
+type baselineEmotionRecord struct {
+	ID               string `gorm:"type:varchar(50);primaryKey"`
+	EmotionType      string `gorm:"type:varchar(50)"`
+	Intensity        int
+	Trigger          string `gorm:"type:text"`
+	UnhealthyBeliefs string `gorm:"type:text"`
+	HealthyEmotion   string `gorm:"type:varchar(50)"`
+	CopingStrategies string `gorm:"type:text"`
+	Status           int    `gorm:"type:int"`
+	RecordDate       time.Time
+	UserID           string `gorm:"type:varchar(50)"`
+	LastModified     time.Time
+}
+
+func (baselineEmotionRecord) TableName() string { return "emotion_records" }
+
+type baselineRedeemCode struct {
+	ID        string `gorm:"primaryKey"`
+	Code      string `gorm:"type:varchar(4);uniqueIndex"`
+	Energy    int    `gorm:"default:20"`
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	UserID    *string `gorm:"index"`
+}
+
+func (baselineRedeemCode) TableName() string { return "redeem_codes" }
+
+type baselineTimeRecord struct {
+	ID           string    `gorm:"type:varchar(50);primary_key"`
+	UserID       string    `gorm:"index:idx_time_records_user_start"`
+	TaskID       string    `gorm:"type:varchar(50);index:idx_time_records_task"`
+	StartTime    time.Time `gorm:"index:idx_time_records_user_start"`
+	EndTime      time.Time
+	LastModified time.Time
+}
+
+func (baselineTimeRecord) TableName() string { return "time_records" }
+
+// migratedModels 迁移后应与模型定义一致的表
+var migratedModels = []interface{}{
+	&models.SyncChange{},
+	&models.Subtask{},
+	&models.TimeRecord{},
+	&models.Task{},
+	&models.EmotionRecord{},
+	&models.Conversation{},
+	&models.ConversationMessage{},
+	&models.Plan{},
+	&models.PendingEmotion{},
+	&models.EnergyReservation{},
+	&models.EnergyLedgerEntry{},
+	&models.User{},
+	&models.Subscription{},
+	&models.AppStoreTransaction{},
+	&models.RedeemCode{},
+	&models.RedeemCampaign{},
+	&models.RedeemRedemption{},
+	&models.SchemaMigration{},
+}
+
+// setupBaselineDB 创建只有迁移之前表结构的测试数据库
+func setupBaselineDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	testutil.ObserveLogs(t)
+	return testutil.SetupDB(t,
+		&baselineUser{}, &baselineTask{}, &baselineSubtask{}, &baselineEmotionRecord{},
+		&baselineRedeemCode{}, &baselineTimeRecord{},
+	)
+}
+
+func TestRunMigrationsFromBaseline(t *testing.T) {
+	db := setupBaselineDB(t)
+
+	if err := config.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	// 再次执行时跳过已记录的迁移
+	if err := config.RunMigrations(db); err != nil {
+		t.Fatalf("重复执行 RunMigrations: %v", err)
+	}
+
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("解析模型失败: %v", err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("缺少表 %s", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("表 %s 缺少列 %s", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !db.Migrator().HasIndex(model, index.Name) {
+				t.Errorf("表 %s 缺少索引 %s", stmt.Schema.Table, index.Name)
+			}
+		}
+	}
+}
+
+func TestRunMigrationsBackfillsRedeemUseCountOnce(t *testing.T) {
+	db := setupBaselineDB(t)
+
+	usedAt := time.Now().Add(-time.Hour)
+	uid := "old-user"
+	codes := []baselineRedeemCode{
+		// 新增兑换次数字段之前已使用的 4 位兑换码
+		{ID: "used", Code: "AB23", Energy: 20, UsedAt: &usedAt, UserID: &uid},
+		{ID: "unused", Code: "CD45", Energy: 20},
+	}
+	if err := db.Create(&codes).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	useCount := func(id string) int {
+		t.Helper()
+		var code models.RedeemCode
+		if err := db.First(&code, "id = ?", id).Error; err != nil {
+			t.Fatalf("查询兑换码失败: %v", err)
+		}
+		return code.UseCount
+	}
+
+	if err := config.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	if got := useCount("used"); got != 1 {
+		t.Errorf("已使用兑换码的兑换次数 = %d, want 1", got)
+	}
+	if got := useCount("unused"); got != 0 {
+		t.Errorf("未使用兑换码的兑换次数 = %d, want 0", got)
+	}
+
+	// 已记录的迁移不再执行
+	if err := db.Model(&models.RedeemCode{}).Where("id = ?", "used").UpdateColumn("use_count", 0).Error; err != nil {
+		t.Fatalf("重置兑换次数失败: %v", err)
+	}
+	if err := config.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	if got := useCount("used"); got != 0 {
+		t.Errorf("数据迁移重复执行, use_count = %d", got)
+	}
+}
+
+func TestRunMigrationsBackfillsEnergyOpeningEntries(t *testing.T) {
+	db := setupBaselineDB(t)
+
+	users := []baselineUser{{ID: "rich", Energy: 35}, {ID: "empty", Energy: 0}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := config.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+
+	for _, user := range users {
+		var entries []models.EnergyLedgerEntry
+		if err := db.Where("user_id = ?", user.ID).Find(&entries).Error; err != nil {
+			t.Fatalf("查询能量流水失败: %v", err)
+		}
+		if len(entries) != 1 || entries[0].Reason != models.EnergyReasonInitial ||
+			entries[0].Delta != user.Energy || entries[0].BalanceAfter != user.Energy {
+			t.Errorf("用户 %s 的流水 = %+v, want 1 opening entry of %d", user.ID, entries, user.Energy)
+		}
+	}
+}
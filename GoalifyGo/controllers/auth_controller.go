@@ -3,6 +3,7 @@ package controllers
 import (
 	"GoalifyGo/config"
 	"GoalifyGo/models"
+	"GoalifyGo/services"
 	"GoalifyGo/utils"
 	"log"
 	"net/http"
@@ -56,7 +57,7 @@ func (ac *AuthController) WechatLogin(c *gin.Context) {
 			CreatedAt:  time.Now(),
 			Energy:     20, // 默认20点能量值
 		}
-		if err := config.DB.Create(&user).Error; err != nil {
+		if err := services.CreateUser(&user); err != nil {
 			config.Logger.Errorw("用户创建失败",
 				"error", err,
 				"provider", "wechat",
@@ -117,7 +118,7 @@ func (ac *AuthController) AppleLogin(c *gin.Context) {
 			ProviderID: appleID,
 			Email:      req.Email, // 苹果首次登录会返回邮箱
 		}
-		if err := config.DB.Create(&user).Error; err != nil {
+		if err := services.CreateUser(&user); err != nil {
 			config.Logger.Errorw("用户创建失败",
 				"error", err,
 				"provider", "apple",
@@ -161,7 +162,7 @@ func (ac *AuthController) CreateTestUser(c *gin.Context) {
 		IsTestUser: true,
 	}
 
-	if err := config.DB.Create(&testUser).Error; err != nil {
+	if err := services.CreateUser(&testUser); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建测试用户失败"})
 		return
 	}
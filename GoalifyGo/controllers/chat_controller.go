@@ -4,14 +4,15 @@ import (
 	"GoalifyGo/config"
 	"GoalifyGo/models"
 	"GoalifyGo/services"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -19,14 +20,65 @@ import (
 type ChatController struct {
 	chatService *services.ChatService
 	wg          sync.WaitGroup // 添加 WaitGroup
+
+	// 后台任务使用的上下文，关闭时取消以中止未完成的任务
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+
+	// 流式生成使用的上下文，服务器开始关闭时取消
+	streamsCtx    context.Context
+	streamsCancel context.CancelFunc
+
+	// 按 sessionID 串行执行对话总结任务
+	summaryMu    sync.Mutex
+	summaryLocks map[string]*summaryLock
 }
 
+// 对话总结在 Redis 中的保留时间
+const historySummaryTTL = 7 * 24 * time.Hour
+
+// 单次生成对话总结的超时时间
+const summaryTimeout = time.Minute
+
+// 每轮对话最多加载的历史消息数，更早的内容由对话总结覆盖
+const conversationHistoryLimit = 40
+
 func NewChatController(chatService *services.ChatService) *ChatController {
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	streamsCtx, streamsCancel := context.WithCancel(context.Background())
 	return &ChatController{
-		chatService: chatService,
+		chatService:   chatService,
+		bgCtx:         bgCtx,
+		bgCancel:      bgCancel,
+		streamsCtx:    streamsCtx,
+		streamsCancel: streamsCancel,
+		summaryLocks:  make(map[string]*summaryLock),
 	}
 }
 
+// streamContext 返回在请求结束或服务器关闭时取消的生成上下文
+func (c *ChatController) streamContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	// 服务器已开始关闭时直接取消，不再开始新的生成
+	if c.streamsCtx.Err() != nil {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-c.streamsCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// CancelStreams 取消所有进行中的流式生成，未完成的请求会退还预扣的能量
+func (c *ChatController) CancelStreams() {
+	c.streamsCancel()
+}
+
 // SendMessage handles chat requests from clients
 func (c *ChatController) SendMessage(ctx *gin.Context) {
 	// 获取用户信息
@@ -37,33 +89,11 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
-	// 检查用户能量值
-	var user models.User
-	if err := config.DB.Where("id = ?", uid).First(&user).Error; err != nil {
-		config.Logger.Errorw("获取用户信息失败", "error", err, "uid", uid)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
-		return
-	}
-
-	if user.Energy < 1 {
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"error":           "能量值不足，请充值",
-			"remainingEnergy": user.Energy,
-		})
-		return
-	}
-
-	// 扣除能量值
-	if err := config.DB.Model(&user).Update("energy", user.Energy-1).Error; err != nil {
-		config.Logger.Errorw("扣除能量值失败", "error", err, "uid", uid)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "扣除能量值失败"})
-		return
-	}
-
 	var chatRequest struct {
-		Message   string `json:"message" binding:"required"`
-		Scene     string `json:"scene"`      // goal, emotion, chat
-		CoachType string `json:"coach_type"` // logic, orange
+		Message        string `json:"message" binding:"required"`
+		Scene          string `json:"scene"`      // goal, emotion, chat
+		CoachType      string `json:"coach_type"` // logic, orange
+		ConversationID string `json:"conversation_id"`
 	}
 
 	// 绑定 JSON 请求
@@ -74,25 +104,59 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
-	// 生成会话 ID
-	sessionID := fmt.Sprintf("%s_%s", uid, chatRequest.Scene)
+	// 加载对话线程及之前的消息，场景以对话创建时为准
+	var conversation *models.Conversation
+	var history []services.ChatTurn
+	if chatRequest.ConversationID != "" {
+		conversation = &models.Conversation{}
+		if err := config.DB.Where("id = ? AND user_id = ?", chatRequest.ConversationID, uid).First(conversation).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "对话不存在"})
+			} else {
+				config.Logger.Errorw("获取对话失败", "error", err, "uid", uid)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话失败"})
+			}
+			return
+		}
+		chatRequest.Scene = conversation.Scene
+
+		// 只加载最近的消息，按时间倒序查询后再恢复为正序
+		var messages []models.ConversationMessage
+		if err := config.DB.Where("conversation_id = ?", conversation.ID).
+			Order("created_at desc").
+			Limit(conversationHistoryLimit).
+			Find(&messages).Error; err != nil {
+			config.Logger.Errorw("获取对话消息失败", "error", err, "uid", uid, "conversationID", conversation.ID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话消息失败"})
+			return
+		}
+		for i := len(messages) - 1; i >= 0; i-- {
+			history = append(history, services.ChatTurn{Role: messages[i].Role, Content: messages[i].Content})
+		}
+	}
 
-	// 从 Redis 中获取对话历史总结
-	historySummary, err := config.RedisClient.Get(ctx, sessionID).Result()
+	// 按订阅等级计算能量消耗
+	entitlement, err := services.GetEntitlement(uid.(string))
 	if err != nil {
-		config.Logger.Errorw("获取对话历史总结失败",
-			"error", err,
-			"sessionID", sessionID,
-			"uid", uid,
-		)
+		config.Logger.Errorw("获取订阅权益失败", "error", err, "uid", uid)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅权益失败"})
+		return
 	}
 
-	// 设置流式响应头
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Access-Control-Allow-Origin", "*")
-	ctx.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+	// 预扣能量值，生成成功后确认，失败时退还
+	reservation, remainingEnergy, err := services.ReserveEnergy(uid.(string), entitlement.EnergyCost(models.EnergyReasonChat), models.EnergyReasonChat)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientEnergy) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"error":           "能量值不足，请充值",
+				"remainingEnergy": remainingEnergy,
+			})
+			return
+		}
+		config.Logger.Errorw("扣除能量值失败", "error", err, "uid", uid)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "扣除能量值失败"})
+		return
+	}
 
 	var aiScene services.AIScene
 	var aiCoach services.AICoach
@@ -109,35 +173,274 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		aiCoach = services.OrangeCoach
 	}
 
-	// 处理聊天请求
+	// 对话总结按对话线程保存；未指定对话时沿用按用户和场景保存的总结
+	sessionID := fmt.Sprintf("%s_%s", uid, chatRequest.Scene)
+	if conversation != nil {
+		sessionID = "conversation_summary:" + conversation.ID
+	}
+
+	// 只有提示词中使用总结的场景才从 Redis 中获取对话历史总结
+	var historySummary string
+	if aiScene.UsesHistorySummary() {
+		historySummary, err = config.RedisClient.Get(ctx, sessionID).Result()
+		if err != nil && err != redis.Nil {
+			config.Logger.Errorw("获取对话历史总结失败",
+				"error", err,
+				"sessionID", sessionID,
+				"uid", uid,
+			)
+		}
+	}
+
+	// 设置流式响应头
+	setSSEHeaders(ctx)
+
+	// 处理聊天请求，服务器关闭时取消生成以便退还能量
+	genCtx, cancel := c.streamContext(ctx.Request.Context())
+	defer cancel()
 	stream, err := c.chatService.GenerateCoachResponse(
-		ctx,
+		genCtx,
 		aiCoach,
 		aiScene,
 		chatRequest.Message,
+		history,
 		historySummary,
 		uid.(string), // 传入 uid
 	)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to process chat: " + err.Error(),
-		})
+		config.Logger.Errorw("启动聊天生成失败", "error", err, "uid", uid)
+		settleEnergy(reservation, streamGenerationFailed, "")
+		writeStreamError(ctx)
 		return
 	}
 
 	// 发送流式响应
-	var fullResponse strings.Builder
-	for chunk := range stream {
-		_, err := ctx.Writer.Write([]byte(chunk))
-		if err != nil {
-			log.Printf("Write error: %v", err)
-			return
+	sentAt := time.Now()
+	reply, usage, outcome := relayStream(ctx, stream)
+	settleEnergy(reservation, outcome, reply)
+	if outcome != streamCompleted {
+		return
+	}
+
+	// Logic 教练回复中的任务计划在服务端解析保存，以 structured 事件下发计划ID供客户端接受，
+	// skipped 为被丢弃的无效任务数
+	if aiCoach == services.LogicCoach {
+		if plan, skipped := savePlanFromReply(uid.(string), conversation, reply); plan != nil {
+			if err := writeSSEEvent(ctx, sseEventStructured, gin.H{
+				"type":    structuredTypePlan,
+				"id":      plan.ID,
+				"data":    plan.Tasks,
+				"skipped": skipped,
+			}); err != nil {
+				logSSEWriteError(ctx, sseEventStructured, err)
+			}
+		}
+	}
+
+	// 情绪场景回复中的情绪记录保存为待确认记录，由用户确认或丢弃
+	if aiScene == services.EmotionScene {
+		if pending := savePendingEmotionFromReply(uid.(string), conversation, reply); pending != nil {
+			if err := writeSSEEvent(ctx, sseEventStructured, gin.H{
+				"type": structuredTypeEmotionRecord,
+				"id":   pending.ID,
+				"data": pending,
+			}); err != nil {
+				logSSEWriteError(ctx, sseEventStructured, err)
+			}
+		}
+	}
+
+	// 在发送 done 之前保存本轮对话，客户端收到 done 后立即发送的下一轮才能读到完整历史
+	if conversation != nil {
+		saveConversationTurn(conversation, chatRequest.Message, reply, sentAt)
+	}
+
+	if err := writeSSEEvent(ctx, sseEventDone, gin.H{
+		"usage":           usage,
+		"remainingEnergy": remainingEnergy,
+	}); err != nil {
+		logSSEWriteError(ctx, sseEventDone, err)
+	}
+
+	// 在协程中更新对话历史总结，不使用总结的场景不再额外调用模型
+	if aiScene.UsesHistorySummary() {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.updateHistorySummary(sessionID, chatRequest.Message, reply)
+		}()
+	}
+}
+
+// savePlanFromReply 解析回复中的任务计划并保存有效的任务，同时返回被丢弃的任务数；
+// 没有计划或没有任何有效任务时返回 nil
+func savePlanFromReply(uid string, conversation *models.Conversation, reply string) (*models.Plan, int) {
+	tasks, invalid, err := services.ParseTaskPlan(reply)
+	for _, reason := range invalid {
+		config.Logger.Warnw("丢弃无效的计划任务", "error", reason, "uid", uid)
+	}
+	if err != nil {
+		if !errors.Is(err, services.ErrNoStructuredBlock) {
+			config.Logger.Warnw("任务计划校验失败", "error", err, "uid", uid)
+		}
+		return nil, len(invalid)
+	}
+
+	plan := models.Plan{
+		ID:        uuid.New().String(),
+		UserID:    uid,
+		Tasks:     tasks,
+		Status:    models.PlanStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if conversation != nil {
+		plan.ConversationID = conversation.ID
+	}
+	if err := config.DB.Create(&plan).Error; err != nil {
+		config.Logger.Errorw("保存任务计划失败", "error", err, "uid", uid)
+		return nil, len(invalid)
+	}
+	return &plan, len(invalid)
+}
+
+// savePendingEmotionFromReply 解析回复中的情绪记录并保存为待确认记录，没有记录或记录无效时返回 nil
+func savePendingEmotionFromReply(uid string, conversation *models.Conversation, reply string) *models.PendingEmotion {
+	pending, err := services.ParseEmotionRecord(reply)
+	if err != nil {
+		if !errors.Is(err, services.ErrNoStructuredBlock) {
+			config.Logger.Warnw("情绪记录校验失败", "error", err, "uid", uid)
+		}
+		return nil
+	}
+
+	pending.ID = uuid.New().String()
+	pending.UserID = uid
+	pending.Status = models.PendingEmotionStatusPending
+	pending.CreatedAt = time.Now()
+	if conversation != nil {
+		pending.ConversationID = conversation.ID
+	}
+	if err := config.DB.Create(pending).Error; err != nil {
+		config.Logger.Errorw("保存待确认情绪记录失败", "error", err, "uid", uid)
+		return nil
+	}
+	return pending
+}
+
+// updateHistorySummary 结合之前的总结和最新一轮对话生成新的总结，并写回 Redis。
+// 同一 sessionID 的总结任务依次执行，并在任务内读取最新的总结：客户端收到 done 后会立即发送下一轮，
+// 若使用请求开始时读到的总结，后一轮的任务会覆盖前一轮的结果，使前一轮从总结中丢失
+func (c *ChatController) updateHistorySummary(sessionID string, message string, reply string) {
+	if reply == "" {
+		return
+	}
+
+	unlock := c.lockSummary(sessionID)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(c.bgCtx, summaryTimeout)
+	defer cancel()
+
+	historySummary, err := config.RedisClient.Get(ctx, sessionID).Result()
+	if err != nil && err != redis.Nil {
+		config.Logger.Errorw("获取对话历史总结失败", "error", err, "sessionID", sessionID)
+		return
+	}
+
+	latest := fmt.Sprintf("用户：%s\n助手：%s", message, reply)
+	summary, err := c.chatService.GenerateSummary(ctx, latest, historySummary)
+	if err != nil {
+		config.Logger.Errorw("生成对话总结失败", "error", err, "sessionID", sessionID)
+		return
+	}
+
+	if err := config.RedisClient.Set(ctx, sessionID, summary, historySummaryTTL).Err(); err != nil {
+		config.Logger.Errorw("保存对话总结失败", "error", err, "sessionID", sessionID)
+	}
+}
+
+// summaryLock 一个 sessionID 的总结任务锁，refs 为持有或等待该锁的任务数
+type summaryLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockSummary 获取 sessionID 的总结任务锁，返回释放函数；没有任务等待时删除该锁
+func (c *ChatController) lockSummary(sessionID string) func() {
+	c.summaryMu.Lock()
+	lock := c.summaryLocks[sessionID]
+	if lock == nil {
+		lock = &summaryLock{}
+		c.summaryLocks[sessionID] = lock
+	}
+	lock.refs++
+	c.summaryMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		c.summaryMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(c.summaryLocks, sessionID)
 		}
-		ctx.Writer.Flush() // 确保每个块都被立即发送
-		fullResponse.WriteString(chunk)
+		c.summaryMu.Unlock()
 	}
 }
 
+// saveConversationTurn 保存一轮用户消息与助手回复，并刷新对话的更新时间
+func saveConversationTurn(conversation *models.Conversation, message string, reply string, sentAt time.Time) {
+	now := time.Now()
+	messages := []models.ConversationMessage{
+		{
+			ID:             uuid.New().String(),
+			ConversationID: conversation.ID,
+			UserID:         conversation.UserID,
+			Role:           models.MessageRoleUser,
+			Content:        message,
+			CreatedAt:      sentAt,
+		},
+		{
+			ID:             uuid.New().String(),
+			ConversationID: conversation.ID,
+			UserID:         conversation.UserID,
+			Role:           models.MessageRoleAssistant,
+			Content:        reply,
+			CreatedAt:      now,
+		},
+	}
+
+	updates := map[string]interface{}{"updated_at": now}
+	// 首条消息作为默认标题
+	if conversation.Title == "" {
+		updates["title"] = truncateRunes(message, 30)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Conversation{}).Where("id = ?", conversation.ID).Updates(updates).Error
+	})
+	if err != nil {
+		config.Logger.Errorw("保存对话消息失败",
+			"error", err,
+			"uid", conversation.UserID,
+			"conversationID", conversation.ID,
+		)
+	}
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
 // AnalyzeReview 处理复盘分析请求
 func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 	// 获取用户信息
@@ -148,14 +451,6 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 		return
 	}
 
-	// 检查用户能量值
-	var user models.User
-	if err := config.DB.Where("id = ?", uid).First(&user).Error; err != nil {
-		config.Logger.Errorw("获取用户信息失败", "error", err, "uid", uid)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
-		return
-	}
-
 	// 解析请求参数
 	var request models.ReviewAnalysisRequest
 	if err := ctx.ShouldBindJSON(&request); err != nil {
@@ -173,40 +468,47 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 		return
 	}
 
-	// 根据复盘周期计算需要扣除的能量值
-	var energyCost int
+	// 根据复盘周期和订阅等级计算需要扣除的能量值
+	var energyReason string
 	switch request.Period {
 	case "day":
-		energyCost = 1
+		energyReason = models.EnergyReasonReviewDay
 	case "week":
-		energyCost = 1
+		energyReason = models.EnergyReasonReviewWeek
 	case "month":
-		energyCost = 3
+		energyReason = models.EnergyReasonReviewMonth
 	default:
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid period"})
 		return
 	}
 
-	// 检查用户能量值是否足够
-	if user.Energy < energyCost {
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"error":           fmt.Sprintf("能量值不足，需要%d点，当前剩余%d点", energyCost, user.Energy),
-			"remainingEnergy": user.Energy,
-		})
+	entitlement, err := services.GetEntitlement(uid.(string))
+	if err != nil {
+		config.Logger.Errorw("获取订阅权益失败", "error", err, "uid", uid)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅权益失败"})
 		return
 	}
+	energyCost := entitlement.EnergyCost(energyReason)
 
 	// 查询情绪记录
 	var emotions []models.EmotionRecord
-	if err := config.DB.Where("user_id = ? AND record_date BETWEEN ? AND ?",
-		uid, request.StartDate, request.EndDate).Find(&emotions).Error; err != nil {
+	if err := config.DB.Where("user_id = ? AND record_date BETWEEN ? AND ? AND status = ?",
+		uid, request.StartDate, request.EndDate, models.StatusNormal).Find(&emotions).Error; err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取情绪记录失败"})
 		return
 	}
 	config.Logger.Debugw("查询到的情绪记录", "count", len(emotions))
 
-	// 扣除能量值
-	if err := config.DB.Model(&user).Update("energy", user.Energy-energyCost).Error; err != nil {
+	// 预扣能量值，生成成功后确认，失败时退还
+	reservation, remainingEnergy, err := services.ReserveEnergy(uid.(string), energyCost, energyReason)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientEnergy) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"error":           fmt.Sprintf("能量值不足，需要%d点，当前剩余%d点", energyCost, remainingEnergy),
+				"remainingEnergy": remainingEnergy,
+			})
+			return
+		}
 		config.Logger.Errorw("扣除能量值失败", "error", err, "uid", uid)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "扣除能量值失败"})
 		return
@@ -214,7 +516,7 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 
 	// 查询上一次同周期的复盘总结
 	var previousAnalysis models.ReviewAnalysis
-	err := config.DB.Where("user_id = ? AND period = ? AND start_date < ?",
+	err = config.DB.Where("user_id = ? AND period = ? AND start_date < ?",
 		uid.(string), request.Period, request.StartDate).
 		Order("start_date desc").
 		First(&previousAnalysis).Error
@@ -225,31 +527,31 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 	}
 
 	// 设置流式响应头
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Access-Control-Allow-Origin", "*")
-	ctx.Header("X-Accel-Buffering", "no")
-
-	// 处理复盘分析请求
-	stream, err := c.chatService.GenerateReviewAnalysis(ctx, request.Period, request.TimeRecord, emotions, previousSummary)
+	setSSEHeaders(ctx)
+
+	// 处理复盘分析请求，服务器关闭时取消生成以便退还能量
+	genCtx, cancel := c.streamContext(ctx.Request.Context())
+	defer cancel()
+	stream, err := c.chatService.GenerateReviewAnalysis(genCtx, request.Period, request.TimeRecord, emotions, previousSummary)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to process review analysis: " + err.Error(),
-		})
+		config.Logger.Errorw("启动复盘分析生成失败", "error", err, "uid", uid)
+		settleEnergy(reservation, streamGenerationFailed, "")
+		writeStreamError(ctx)
 		return
 	}
 
 	// 发送流式响应
-	var fullResponse strings.Builder
-	for chunk := range stream {
-		_, err := ctx.Writer.Write([]byte(chunk))
-		if err != nil {
-			log.Printf("Write error: %v", err)
-			return
-		}
-		ctx.Writer.Flush()
-		fullResponse.WriteString(chunk)
+	summary, usage, outcome := relayStream(ctx, stream)
+	settleEnergy(reservation, outcome, summary)
+	if outcome != streamCompleted {
+		return
+	}
+
+	if err := writeSSEEvent(ctx, sseEventDone, gin.H{
+		"usage":           usage,
+		"remainingEnergy": remainingEnergy,
+	}); err != nil {
+		logSSEWriteError(ctx, sseEventDone, err)
 	}
 
 	// 在协程中存储分析结果
@@ -264,7 +566,7 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 
 		if err == nil {
 			// 如果记录已存在，更新 Summary
-			if err := config.DB.Model(&existingAnalysis).Update("summary", fullResponse.String()).Error; err != nil {
+			if err := config.DB.Model(&existingAnalysis).Update("summary", summary).Error; err != nil {
 				config.Logger.Errorw("更新复盘分析结果失败",
 					"error", err,
 					"uid", uid,
@@ -279,7 +581,7 @@ func (c *ChatController) AnalyzeReview(ctx *gin.Context) {
 				Period:    request.Period,
 				StartDate: request.StartDate,
 				EndDate:   request.EndDate,
-				Summary:   fullResponse.String(),
+				Summary:   summary,
 				CreatedAt: time.Now(),
 			}
 
@@ -373,3 +675,20 @@ func (c *ChatController) GetReviewAnalyses(ctx *gin.Context) {
 func (c *ChatController) Wait() {
 	c.wg.Wait()
 }
+
+// Shutdown 等待后台任务完成；ctx 结束时取消仍在进行的任务并等待其退出
+func (c *ChatController) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.bgCancel()
+		<-done
+	}
+	c.bgCancel()
+}
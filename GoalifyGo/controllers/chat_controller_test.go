@@ -0,0 +1,559 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"GoalifyGo/services/fakellm"
+	"GoalifyGo/testutil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+)
+
+const (
+	chatTestUID    = "chat-user"
+	chatTestEnergy = 20
+)
+
+// sseFrame 解析出的一个 SSE 事件
+type sseFrame struct {
+	Event string
+	Data  map[string]interface{}
+}
+
+// parseSSE 按空行切分响应体并解析每个事件的 JSON 数据
+func parseSSE(t *testing.T, body string) []sseFrame {
+	t.Helper()
+
+	var frames []sseFrame
+	for _, block := range strings.Split(body, "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		var frame sseFrame
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				frame.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame.Data); err != nil {
+					t.Fatalf("解析 SSE 数据失败: %v, block=%q", err, block)
+				}
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// frameEvents 返回事件名称序列
+func frameEvents(frames []sseFrame) []string {
+	events := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		events = append(events, frame.Event)
+	}
+	return events
+}
+
+// deltaContent 拼接所有 delta 事件的内容
+func deltaContent(frames []sseFrame) string {
+	var content strings.Builder
+	for _, frame := range frames {
+		if frame.Event == sseEventDelta {
+			content.WriteString(frame.Data["content"].(string))
+		}
+	}
+	return content.String()
+}
+
+// setupChatFixture 创建测试数据库、Redis 和按顺序返回 scripts 的聊天控制器
+func setupChatFixture(t *testing.T, scripts ...fakellm.Script) (*gorm.DB, *ChatController, *gin.Engine) {
+	t.Helper()
+	return setupChatFixtureWithModel(t, fakellm.New(scripts...))
+}
+
+// setupChatFixtureWithModel 创建测试数据库、Redis 和使用指定 fakellm 模型的聊天控制器
+func setupChatFixtureWithModel(t *testing.T, model *fakellm.Model) (*gorm.DB, *ChatController, *gin.Engine) {
+	t.Helper()
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.Subscription{}, &models.EnergyReservation{},
+		&models.EnergyLedgerEntry{}, &models.Conversation{}, &models.ConversationMessage{}, &models.Plan{},
+		&models.PendingEmotion{}, &models.EmotionRecord{}, &models.ReviewAnalysis{})
+	if err := db.Create(&models.User{ID: chatTestUID, Energy: chatTestEnergy}).Error; err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+
+	chatService := services.NewChatService(model, nil)
+	controller := NewChatController(chatService)
+	t.Cleanup(func() {
+		controller.Wait()
+		chatService.Wait()
+	})
+
+	r := newTestRouter()
+	r.POST("/chat", controller.SendMessage)
+	r.POST("/review/analyze", controller.AnalyzeReview)
+	return db, controller, r
+}
+
+// mustScript 生成带结构化数据的预设回复
+func mustScript(t *testing.T, build func() (fakellm.Script, error)) fakellm.Script {
+	t.Helper()
+	script, err := build()
+	if err != nil {
+		t.Fatalf("生成预设回复失败: %v", err)
+	}
+	return script
+}
+
+// assertReservation 检查唯一的一条能量预扣的状态，以及用户余额
+func assertReservation(t *testing.T, db *gorm.DB, status string) {
+	t.Helper()
+
+	var reservations []models.EnergyReservation
+	if err := db.Find(&reservations).Error; err != nil {
+		t.Fatalf("查询能量预扣失败: %v", err)
+	}
+	if len(reservations) != 1 {
+		t.Fatalf("能量预扣数量 = %d, want 1", len(reservations))
+	}
+	reservation := reservations[0]
+	if reservation.Status != status {
+		t.Errorf("预扣状态 = %s, want %s", reservation.Status, status)
+	}
+
+	want := chatTestEnergy
+	if status == models.EnergyReservationCommitted {
+		want -= reservation.Amount
+	}
+	var user models.User
+	if err := db.First(&user, "id = ?", chatTestUID).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	if user.Energy != want {
+		t.Errorf("能量余额 = %d, want %d", user.Energy, want)
+	}
+}
+
+func TestSendMessageStreamsFakeLLM(t *testing.T) {
+	cases := []struct {
+		name   string
+		scene  string
+		script func(t *testing.T) fakellm.Script
+		// events 期望的事件序列
+		events      []string
+		reservation string
+		// check 检查生成后写入的数据
+		check func(t *testing.T, db *gorm.DB, frames []sseFrame)
+	}{
+		{
+			name:  "chunks",
+			scene: "chat",
+			script: func(t *testing.T) fakellm.Script {
+				return fakellm.Script{
+					Chunks: []string{"你好，", "今天过得", "怎么样？"},
+					Usage:  fakellm.Usage{PromptTokens: 12, CompletionTokens: 8},
+				}
+			},
+			events:      []string{sseEventDelta, sseEventDelta, sseEventDelta, sseEventDone},
+			reservation: models.EnergyReservationCommitted,
+			check: func(t *testing.T, db *gorm.DB, frames []sseFrame) {
+				usage := frames[len(frames)-1].Data["usage"].(map[string]interface{})
+				if usage["totalTokens"] != float64(20) {
+					t.Errorf("usage = %v, want totalTokens 20", usage)
+				}
+			},
+		},
+		{
+			name:  "error after chunk",
+			scene: "chat",
+			script: func(t *testing.T) fakellm.Script {
+				return fakellm.FailAfter("第一段第二段", 1, nil)
+			},
+			events:      []string{sseEventDelta, sseEventError},
+			reservation: models.EnergyReservationReleased,
+			check: func(t *testing.T, db *gorm.DB, frames []sseFrame) {
+				if code := frames[len(frames)-1].Data["code"]; code != streamErrorGenerationFailed {
+					t.Errorf("error code = %v, want %s", code, streamErrorGenerationFailed)
+				}
+			},
+		},
+		{
+			name:  "error before first chunk",
+			scene: "chat",
+			script: func(t *testing.T) fakellm.Script {
+				return fakellm.FailAfter("不会发送", 0, nil)
+			},
+			events:      []string{sseEventError},
+			reservation: models.EnergyReservationReleased,
+		},
+		{
+			name:  "task plan",
+			scene: "goal",
+			script: func(t *testing.T) fakellm.Script {
+				return mustScript(t, fakellm.TaskPlanReply)
+			},
+			reservation: models.EnergyReservationCommitted,
+			check: func(t *testing.T, db *gorm.DB, frames []sseFrame) {
+				var plans []models.Plan
+				if err := db.Find(&plans).Error; err != nil {
+					t.Fatalf("查询任务计划失败: %v", err)
+				}
+				if len(plans) != 1 || plans[0].UserID != chatTestUID || len(plans[0].Tasks) != 1 {
+					t.Fatalf("plans = %+v, want 1 plan with 1 task", plans)
+				}
+				structured := frames[len(frames)-2]
+				if structured.Event != sseEventStructured || structured.Data["type"] != structuredTypePlan || structured.Data["id"] != plans[0].ID {
+					t.Errorf("structured frame = %+v, want plan %s", structured, plans[0].ID)
+				}
+			},
+		},
+		{
+			name:  "task plan with invalid task",
+			scene: "goal",
+			script: func(t *testing.T) fakellm.Script {
+				script, err := fakellm.StructuredReply("先从小目标开始。", map[string]interface{}{
+					"tasks": []map[string]interface{}{
+						{"title": "每天阅读半小时", "priority": 1},
+						{"title": "  ", "priority": 1},
+					},
+				})
+				if err != nil {
+					t.Fatalf("生成预设回复失败: %v", err)
+				}
+				return script
+			},
+			reservation: models.EnergyReservationCommitted,
+			check: func(t *testing.T, db *gorm.DB, frames []sseFrame) {
+				var plans []models.Plan
+				if err := db.Find(&plans).Error; err != nil {
+					t.Fatalf("查询任务计划失败: %v", err)
+				}
+				if len(plans) != 1 || len(plans[0].Tasks) != 1 || plans[0].Tasks[0].Title != "每天阅读半小时" {
+					t.Fatalf("plans = %+v, want 1 plan with the valid task", plans)
+				}
+				structured := frames[len(frames)-2]
+				if structured.Event != sseEventStructured || structured.Data["id"] != plans[0].ID || structured.Data["skipped"] != float64(1) {
+					t.Errorf("structured frame = %+v, want plan %s with 1 skipped task", structured, plans[0].ID)
+				}
+			},
+		},
+		{
+			name:  "emotion record",
+			scene: "emotion",
+			script: func(t *testing.T) fakellm.Script {
+				return mustScript(t, fakellm.EmotionRecordReply)
+			},
+			reservation: models.EnergyReservationCommitted,
+			check: func(t *testing.T, db *gorm.DB, frames []sseFrame) {
+				var pending []models.PendingEmotion
+				if err := db.Find(&pending).Error; err != nil {
+					t.Fatalf("查询待确认情绪记录失败: %v", err)
+				}
+				if len(pending) != 1 || pending[0].UserID != chatTestUID || pending[0].EmotionType != "焦虑" {
+					t.Fatalf("pending = %+v, want 1 record", pending)
+				}
+				structured := frames[len(frames)-2]
+				if structured.Event != sseEventStructured || structured.Data["type"] != structuredTypeEmotionRecord || structured.Data["id"] != pending[0].ID {
+					t.Errorf("structured frame = %+v, want emotion record %s", structured, pending[0].ID)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			script := tc.script(t)
+			db, _, r := setupChatFixture(t, script)
+
+			w := performJSON(t, r, http.MethodPost, "/chat", chatTestUID, gin.H{
+				"message": "最近有点焦虑",
+				"scene":   tc.scene,
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body=%s", w.Code, w.Body.String())
+			}
+
+			frames := parseSSE(t, w.Body.String())
+			if len(frames) == 0 {
+				t.Fatalf("没有收到 SSE 事件")
+			}
+			if tc.events != nil {
+				if got := frameEvents(frames); strings.Join(got, ",") != strings.Join(tc.events, ",") {
+					t.Errorf("events = %v, want %v", got, tc.events)
+				}
+			}
+			// 失败的预设回复只会发送 ErrAt 之前的片段
+			sent := script.Chunks
+			if script.Err != nil {
+				sent = sent[:script.ErrAt]
+			}
+			if got, want := deltaContent(frames), strings.Join(sent, ""); got != want {
+				t.Errorf("content = %q, want %q", got, want)
+			}
+			if script.Err == nil && frames[len(frames)-1].Event != sseEventDone {
+				t.Errorf("最后一个事件 = %s, want %s", frames[len(frames)-1].Event, sseEventDone)
+			}
+
+			assertReservation(t, db, tc.reservation)
+			if tc.check != nil {
+				tc.check(t, db, frames)
+			}
+		})
+	}
+}
+
+func TestAnalyzeReviewStreamsFakeLLM(t *testing.T) {
+	cases := []struct {
+		name        string
+		script      fakellm.Script
+		events      []string
+		reservation string
+		// saved 是否保存复盘结果
+		saved bool
+	}{
+		{
+			name:        "chunks",
+			script:      fakellm.Script{Chunks: []string{"今天完成了", "两项任务。"}},
+			events:      []string{sseEventDelta, sseEventDelta, sseEventDone},
+			reservation: models.EnergyReservationCommitted,
+			saved:       true,
+		},
+		{
+			name:        "error after chunk",
+			script:      fakellm.FailAfter("今天完成了两项任务。", 1, nil),
+			events:      []string{sseEventDelta, sseEventError},
+			reservation: models.EnergyReservationReleased,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, controller, r := setupChatFixture(t, tc.script)
+
+			start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			w := performJSON(t, r, http.MethodPost, "/review/analyze", chatTestUID, gin.H{
+				"period":    "day",
+				"startDate": start,
+				"endDate":   start.Add(24*time.Hour - time.Second),
+				"timeRecords": []models.TimeRecordWithTask{
+					{TaskID: "T1", Title: "写周报", TotalTime: 3600},
+				},
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body=%s", w.Code, w.Body.String())
+			}
+			controller.Wait()
+
+			frames := parseSSE(t, w.Body.String())
+			if got := frameEvents(frames); strings.Join(got, ",") != strings.Join(tc.events, ",") {
+				t.Errorf("events = %v, want %v", got, tc.events)
+			}
+			assertReservation(t, db, tc.reservation)
+
+			var analyses []models.ReviewAnalysis
+			if err := db.Find(&analyses).Error; err != nil {
+				t.Fatalf("查询复盘结果失败: %v", err)
+			}
+			if !tc.saved {
+				if len(analyses) != 0 {
+					t.Errorf("生成失败时不应保存复盘结果: %+v", analyses)
+				}
+				return
+			}
+			if len(analyses) != 1 || analyses[0].Summary != strings.Join(tc.script.Chunks, "") {
+				t.Errorf("analyses = %+v, want summary %q", analyses, strings.Join(tc.script.Chunks, ""))
+			}
+		})
+	}
+}
+
+func TestSendMessageCancelledAtShutdown(t *testing.T) {
+	db, controller, r := setupChatFixture(t, fakellm.Reply("服务器关闭前不会完成的回复"))
+
+	// 服务器开始关闭时取消生成，生成协程的错误事件可能被丢弃，仍应按生成失败处理
+	controller.CancelStreams()
+	w := performJSON(t, r, http.MethodPost, "/chat", chatTestUID, gin.H{
+		"message": "你好",
+		"scene":   "chat",
+	})
+
+	frames := parseSSE(t, w.Body.String())
+	if len(frames) == 0 || frames[len(frames)-1].Event != sseEventError {
+		t.Fatalf("events = %v, want trailing %s", frameEvents(frames), sseEventError)
+	}
+	assertReservation(t, db, models.EnergyReservationReleased)
+}
+
+func TestSendMessageSummarizesOnlyScenesUsingSummary(t *testing.T) {
+	cases := []struct {
+		scene string
+		// calls 期望的模型调用次数，使用总结的场景在回复后再生成一次总结
+		calls int
+	}{
+		{scene: "emotion", calls: 2},
+		{scene: "goal", calls: 1},
+		{scene: "chat", calls: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.scene, func(t *testing.T) {
+			model := fakellm.New(fakellm.Reply("我在听，慢慢说。"), fakellm.Reply("用户最近有点焦虑"))
+			_, controller, r := setupChatFixtureWithModel(t, model)
+
+			w := performJSON(t, r, http.MethodPost, "/chat", chatTestUID, gin.H{
+				"message": "最近有点焦虑",
+				"scene":   tc.scene,
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body=%s", w.Code, w.Body.String())
+			}
+			controller.Wait()
+
+			if got := len(model.Calls()); got != tc.calls {
+				t.Errorf("模型调用次数 = %d, want %d", got, tc.calls)
+			}
+		})
+	}
+}
+
+func TestUpdateHistorySummarySerializesOverlappingTurns(t *testing.T) {
+	model := fakellm.New(fakellm.Reply("第一次总结"), fakellm.Reply("第二次总结"))
+	_, controller, _ := setupChatFixtureWithModel(t, model)
+	const sessionID = "conversation_summary:overlap"
+
+	// 两轮的总结任务同时开始，后执行的任务必须基于先执行的任务写入的总结
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, turn := range []string{"第一轮", "第二轮"} {
+		wg.Add(1)
+		go func(turn string) {
+			defer wg.Done()
+			<-start
+			controller.updateHistorySummary(sessionID, turn, turn+"的回复")
+		}(turn)
+	}
+	close(start)
+	wg.Wait()
+
+	calls := model.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("模型调用次数 = %d, want 2", len(calls))
+	}
+	if summaryInput(calls[0].Messages, "Historical summary:") != "" {
+		t.Errorf("第一次总结不应包含历史总结")
+	}
+	if got := summaryInput(calls[1].Messages, "Historical summary:"); got != "Historical summary: 第一次总结" {
+		t.Errorf("第二次总结的历史总结 = %q, want 第一次总结", got)
+	}
+
+	summary, err := config.RedisClient.Get(context.Background(), sessionID).Result()
+	if err != nil {
+		t.Fatalf("读取对话总结失败: %v", err)
+	}
+	if summary != "第二次总结" {
+		t.Errorf("对话总结 = %q, want 第二次总结", summary)
+	}
+	if len(controller.summaryLocks) != 0 {
+		t.Errorf("总结任务结束后仍保留 %d 个锁", len(controller.summaryLocks))
+	}
+}
+
+// summaryInput 返回以 prefix 开头的消息文本，没有时返回空字符串
+func summaryInput(messages []llms.MessageContent, prefix string) string {
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok && strings.HasPrefix(text.Text, prefix) {
+				return text.Text
+			}
+		}
+	}
+	return ""
+}
+
+func TestSendMessageConcurrentRequestsNeverOverdraw(t *testing.T) {
+	const (
+		initial = 5
+		workers = 20
+	)
+	db, _, r := setupChatFixture(t)
+	if err := db.Model(&models.User{}).Where("id = ?", chatTestUID).Update("energy", initial).Error; err != nil {
+		t.Fatalf("设置能量失败: %v", err)
+	}
+
+	body, err := json.Marshal(gin.H{"message": "你好", "scene": "chat"})
+	if err != nil {
+		t.Fatalf("序列化请求失败: %v", err)
+	}
+
+	// 工作协程只记录响应，不能调用 t.Fatalf，解析和断言在全部请求结束后进行
+	responses := make([]*httptest.ResponseRecorder, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(testUIDHeader, chatTestUID)
+			responses[i] = httptest.NewRecorder()
+			r.ServeHTTP(responses[i], req)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var succeeded, refused int
+	for _, w := range responses {
+		switch w.Code {
+		case http.StatusOK:
+			frames := parseSSE(t, w.Body.String())
+			if len(frames) == 0 || frames[len(frames)-1].Event != sseEventDone {
+				t.Errorf("events = %v, want trailing %s", frameEvents(frames), sseEventDone)
+				continue
+			}
+			succeeded++
+		case http.StatusForbidden:
+			refused++
+		default:
+			t.Errorf("status = %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+
+	// 每次聊天消耗 1 点能量，余额只够 initial 次
+	if succeeded != initial || refused != workers-initial {
+		t.Errorf("成功 %d 次、被拒绝 %d 次, want %d/%d", succeeded, refused, initial, workers-initial)
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", chatTestUID).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	if user.Energy < 0 {
+		t.Errorf("余额为负: %d", user.Energy)
+	}
+	if user.Energy+succeeded != initial {
+		t.Errorf("余额 %d + 成功次数 %d != 初始能量 %d", user.Energy, succeeded, initial)
+	}
+
+	var committed int64
+	if err := db.Model(&models.EnergyReservation{}).Where("status = ?", models.EnergyReservationCommitted).Count(&committed).Error; err != nil {
+		t.Fatalf("统计能量预扣失败: %v", err)
+	}
+	if int(committed) != succeeded {
+		t.Errorf("已确认的预扣 %d 条, want %d", committed, succeeded)
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testUIDHeader 测试中代替 JWT 认证传入用户ID的请求头
+const testUIDHeader = "X-Test-UID"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestRouter 创建测试路由，用请求头中的用户ID代替认证中间件
+func newTestRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if uid := c.GetHeader(testUIDHeader); uid != "" {
+			c.Set("uid", uid)
+		}
+		c.Next()
+	})
+	return r
+}
+
+// performJSON 以指定用户身份发送 JSON 请求
+func performJSON(t *testing.T, r http.Handler, method, path, uid string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("序列化请求失败: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if uid != "" {
+		req.Header.Set(testUIDHeader, uid)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON 解析响应体
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("解析响应失败: %v, body=%s", err, w.Body.String())
+	}
+}
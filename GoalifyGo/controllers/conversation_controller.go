@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ConversationController struct{}
+
+// 对话列表默认及最大分页大小
+const (
+	defaultConversationPageSize = 20
+	maxConversationPageSize     = 100
+)
+
+// 对话标题最大字符数，与数据库列长度一致
+const maxConversationTitleRunes = 100
+
+// CreateConversation 创建对话线程
+func (cc *ConversationController) CreateConversation(c *gin.Context) {
+	var req struct {
+		Scene string `json:"scene"` // goal, emotion, chat
+		Title string `json:"title"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+		return
+	}
+
+	switch req.Scene {
+	case "goal", "emotion", "chat":
+	case "":
+		req.Scene = "chat"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的场景"})
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if utf8.RuneCountInString(req.Title) > maxConversationTitleRunes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "标题过长"})
+		return
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{
+		ID:        utils.GenerateID(),
+		UserID:    c.GetString("uid"),
+		Scene:     req.Scene,
+		Title:     req.Title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := config.DB.Create(&conversation).Error; err != nil {
+		config.Logger.Errorw("创建对话失败", "error", err, "uid", conversation.UserID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建对话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": conversation})
+}
+
+// ListConversations 按最近更新时间倒序列出当前用户的对话
+func (cc *ConversationController) ListConversations(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	pageSize := defaultConversationPageSize
+	if pageSizeStr := c.Query("pageSize"); pageSizeStr != "" {
+		size, err := strconv.Atoi(pageSizeStr)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		if size > maxConversationPageSize {
+			size = maxConversationPageSize
+		}
+		pageSize = size
+	}
+
+	query := config.DB.Where("user_id = ?", uid)
+	if scene := c.Query("scene"); scene != "" {
+		query = query.Where("scene = ?", scene)
+	}
+	if before := c.Query("before"); before != "" {
+		beforeTime, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间格式"})
+			return
+		}
+		query = query.Where("updated_at < ?", beforeTime)
+	}
+
+	var conversations []models.Conversation
+	if err := query.Order("updated_at desc").Limit(pageSize).Find(&conversations).Error; err != nil {
+		config.Logger.Errorw("获取对话列表失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": conversations})
+}
+
+// GetConversation 获取对话及其全部消息
+func (cc *ConversationController) GetConversation(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var conversation models.Conversation
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).First(&conversation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "对话不存在"})
+		} else {
+			config.Logger.Errorw("获取对话失败", "error", err, "uid", uid)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话失败"})
+		}
+		return
+	}
+
+	var messages []models.ConversationMessage
+	if err := config.DB.Where("conversation_id = ?", conversation.ID).
+		Order("created_at asc").
+		Find(&messages).Error; err != nil {
+		config.Logger.Errorw("获取对话消息失败", "error", err, "uid", uid, "conversationID", conversation.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话消息失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"conversation": conversation,
+			"messages":     messages,
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateConversationValidatesTitle(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, &models.Conversation{})
+
+	r := newTestRouter()
+	r.POST("/conversations", (&ConversationController{}).CreateConversation)
+
+	cases := []struct {
+		name   string
+		title  string
+		status int
+		want   string
+	}{
+		{name: "trimmed", title: "  期末复习计划  ", status: http.StatusOK, want: "期末复习计划"},
+		{name: "max length", title: strings.Repeat("字", maxConversationTitleRunes), status: http.StatusOK, want: strings.Repeat("字", maxConversationTitleRunes)},
+		{name: "too long", title: strings.Repeat("字", maxConversationTitleRunes+1), status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := performJSON(t, r, http.MethodPost, "/conversations", "u1", map[string]string{"scene": "chat", "title": tc.title})
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data models.Conversation `json:"data"`
+			}
+			decodeJSON(t, w, &resp)
+			var saved models.Conversation
+			if err := db.First(&saved, "id = ?", resp.Data.ID).Error; err != nil {
+				t.Fatalf("查询对话失败: %v", err)
+			}
+			if saved.Title != tc.want {
+				t.Errorf("标题 = %q, want %q", saved.Title, tc.want)
+			}
+		})
+	}
+}
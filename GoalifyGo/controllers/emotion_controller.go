@@ -1,12 +1,14 @@
 package controllers
 
 import (
-	"GoalifyGo/config"
 	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type EmotionController struct{}
@@ -28,61 +30,81 @@ func (ec *EmotionController) SyncEmotions(c *gin.Context) {
 		return
 	}
 
-	// 开启事务
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// 逐条更新或创建情绪记录，每条记录使用独立事务
+	results := make([]models.SyncItemResult, 0, len(emotions))
+	conflicts := make([]models.SyncConflict, 0)
+	for _, emotionReq := range emotions {
+		emotionReq.ConvertToUTC()
+
+		result, conflict := runSyncItem(c, models.EntityEmotion, emotionReq.ID, func(tx *gorm.DB) (string, *models.SyncConflict, error) {
+			return syncEmotion(tx, uid.(string), &emotionReq)
+		})
+		results = append(results, result)
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
 		}
-	}()
+	}
 
-	// 更新或创建情绪记录
-	for _, emotionReq := range emotions {
-		emotion := models.EmotionRecord{
-			ID:              emotionReq.ID,
-			EmotionType:     emotionReq.EmotionType,
-			Intensity:       emotionReq.Intensity,
-			Trigger:         emotionReq.Trigger,
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "情绪记录同步完成",
+		"results":   results,
+		"conflicts": conflicts,
+	})
+}
+
+// syncEmotion 在事务中写入单条情绪记录
+func syncEmotion(tx *gorm.DB, uid string, emotionReq *models.SyncEmotionsRequest) (string, *models.SyncConflict, error) {
+	// 情绪强度只允许 1 消极 2 中性 3 积极
+	if emotionReq.Intensity < 1 || emotionReq.Intensity > 3 {
+		return "", nil, rejectSyncItem(models.SyncReasonInvalidField, "无效的情绪强度")
+	}
+
+	// 检查当前用户是否已有该情绪记录
+	var emotion models.EmotionRecord
+	err := tx.Where("id = ? AND user_id = ?", emotionReq.ID, uid).First(&emotion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 如果不存在，创建新情绪记录
+		emotion = models.EmotionRecord{
+			ID:               emotionReq.ID,
+			EmotionType:      emotionReq.EmotionType,
+			Intensity:        emotionReq.Intensity,
+			Trigger:          emotionReq.Trigger,
 			UnhealthyBeliefs: emotionReq.UnhealthyBeliefs,
-			HealthyEmotion:  emotionReq.HealthyEmotion,
+			HealthyEmotion:   emotionReq.HealthyEmotion,
 			CopingStrategies: emotionReq.CopingStrategies,
-			RecordDate:      emotionReq.RecordDate,
-			LastModified:    emotionReq.LastModified,
-			UserID:          uid.(string),
+			RecordDate:       emotionReq.RecordDate,
+			FieldModified:    services.NewFieldTimestamps(services.EmotionMergeFields, emotionReq.FieldTime),
+			LastModified:     time.Now(),
+			ClientModified:   &emotionReq.LastModified,
+			UserID:           uid,
 		}
-
-		// 检查是否存在同名情绪记录
-		var existingEmotion models.EmotionRecord
-		if err := tx.Where("id = ?", emotion.ID).First(&existingEmotion).Error; err == nil {
-			// 如果存在，比较 lastModified 时间戳
-			if emotion.LastModified.After(existingEmotion.LastModified) {
-				// 如果新数据更晚，更新情绪记录
-				emotion.LastModified = time.Now()
-				if err := tx.Save(&emotion).Error; err != nil {
-					tx.Rollback()
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "情绪记录同步失败"})
-					return
-				}
-			} else {
-				// 如果旧数据更晚，忽略新数据
-				continue
-			}
-		} else {
-			// 如果不存在，创建新情绪记录
-			emotion.LastModified = time.Now()
-			if err := tx.Create(&emotion).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "情绪记录同步失败"})
-				return
-			}
+		if err := tx.Create(&emotion).Error; err != nil {
+			return "", nil, err
 		}
+		return models.SyncItemApplied, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "情绪记录同步失败"})
-		return
+	// 如果存在，按字段修改时间合并
+	result := services.MergeEmotion(&emotion, emotionReq)
+	status := models.SyncItemStale
+	if result.Changed {
+		emotion.LastModified = time.Now()
+		if err := services.SaveOwned(tx, uid, &emotion); err != nil {
+			return "", nil, err
+		}
+		status = models.SyncItemApplied
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "情绪记录同步成功"})
-} 
\ No newline at end of file
+	var conflict *models.SyncConflict
+	if len(result.Conflicts) > 0 {
+		conflict = &models.SyncConflict{
+			ID:     emotion.ID,
+			Fields: result.Conflicts,
+			Server: toEmotionResponse(emotion),
+		}
+	}
+	return status, conflict, nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PendingEmotionController struct{}
+
+var errPendingEmotionResolved = errors.New("情绪记录已处理")
+
+// ListPendingEmotions 列出当前用户待确认的情绪记录
+func (pc *PendingEmotionController) ListPendingEmotions(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var pending []models.PendingEmotion
+	if err := config.DB.Where("user_id = ? AND status = ?", uid, models.PendingEmotionStatusPending).
+		Order("created_at desc").
+		Find(&pending).Error; err != nil {
+		config.Logger.Errorw("获取待确认情绪记录失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认情绪记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": pending})
+}
+
+// ConfirmPendingEmotion 确认待确认的情绪记录，写入情绪记录并通过同步下发到各设备
+func (pc *PendingEmotionController) ConfirmPendingEmotion(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var emotion models.EmotionRecord
+	var seq int64
+	err := pc.resolve(c, uid, func(tx *gorm.DB, pending *models.PendingEmotion, now time.Time) error {
+		// 客户端记录ID为大写 UUID，保持一致以免同步时被当作不同记录
+		emotion = models.EmotionRecord{
+			ID:               strings.ToUpper(uuid.New().String()),
+			EmotionType:      pending.EmotionType,
+			Intensity:        pending.Intensity,
+			Trigger:          pending.Trigger,
+			UnhealthyBeliefs: pending.UnhealthyBeliefs,
+			HealthyEmotion:   pending.HealthyEmotion,
+			CopingStrategies: pending.CopingStrategies,
+			RecordDate:       pending.CreatedAt.UTC(),
+			FieldModified:    services.NewFieldTimestamps(services.EmotionMergeFields, func(string) time.Time { return now }),
+			LastModified:     now,
+			UserID:           uid,
+		}
+		if err := tx.Create(&emotion).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if seq, err = services.RecordChange(tx, uid, models.EntityEmotion, emotion.ID); err != nil {
+			return err
+		}
+
+		pending.Status = models.PendingEmotionStatusConfirmed
+		pending.EmotionRecordID = emotion.ID
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// 事务提交后再推送变更通知
+	services.PublishSyncChange(uid, models.EntityEmotion, emotion.ID, seq)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "情绪记录已确认",
+		"data":    toEmotionResponse(emotion),
+	})
+}
+
+// DiscardPendingEmotion 丢弃待确认的情绪记录
+func (pc *PendingEmotionController) DiscardPendingEmotion(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	err := pc.resolve(c, uid, func(tx *gorm.DB, pending *models.PendingEmotion, now time.Time) error {
+		pending.Status = models.PendingEmotionStatusDiscarded
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "情绪记录已丢弃"})
+}
+
+// resolve 在事务中锁定待确认记录并执行处理，出错时直接写入错误响应
+func (pc *PendingEmotionController) resolve(c *gin.Context, uid string,
+	fn func(tx *gorm.DB, pending *models.PendingEmotion, now time.Time) error) error {
+	id := c.Param("id")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var pending models.PendingEmotion
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", id, uid).
+			First(&pending).Error; err != nil {
+			return err
+		}
+		if pending.Status != models.PendingEmotionStatusPending {
+			return errPendingEmotionResolved
+		}
+
+		now := time.Now()
+		if err := fn(tx, &pending, now); err != nil {
+			return err
+		}
+		return tx.Model(&pending).Updates(map[string]interface{}{
+			"status":            pending.Status,
+			"emotion_record_id": pending.EmotionRecordID,
+			"resolved_at":       now,
+		}).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "情绪记录不存在"})
+	case errors.Is(err, errPendingEmotionResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": "情绪记录已处理"})
+	default:
+		config.Logger.Errorw("处理待确认情绪记录失败", "error", err, "uid", uid, "id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理情绪记录失败"})
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PlanController struct{}
+
+// 计划生成任务的默认难度，与客户端新建任务的默认值一致
+const defaultPlanTaskDifficulty = 2
+
+var errPlanAccepted = errors.New("计划已接受")
+
+// GetPlan 获取任务计划
+func (pc *PlanController) GetPlan(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var plan models.Plan
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).First(&plan).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "计划不存在"})
+		} else {
+			config.Logger.Errorw("获取计划失败", "error", err, "uid", uid)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取计划失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": plan})
+}
+
+// AcceptPlan 接受任务计划，一次性为用户创建计划中的全部任务
+func (pc *PlanController) AcceptPlan(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var plan models.Plan
+	var tasks []models.Task
+	seqs := make([]int64, 0)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定计划，防止并发重复接受
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", c.Param("id"), uid).
+			First(&plan).Error; err != nil {
+			return err
+		}
+		if plan.Status == models.PlanStatusAccepted {
+			return errPlanAccepted
+		}
+
+		now := time.Now()
+		tasks = make([]models.Task, 0, len(plan.Tasks))
+		for _, planTask := range plan.Tasks {
+			task := newTaskFromPlan(planTask, uid, now)
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+			seq, err := services.RecordChange(tx, uid, models.EntityTask, task.ID)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			seqs = append(seqs, seq)
+		}
+
+		taskIDs := make(models.PlanTaskIDs, 0, len(tasks))
+		for _, task := range tasks {
+			taskIDs = append(taskIDs, task.ID)
+		}
+		plan.Status = models.PlanStatusAccepted
+		plan.TaskIDs = taskIDs
+		plan.AcceptedAt = &now
+		return tx.Model(&plan).Updates(map[string]interface{}{
+			"status":      plan.Status,
+			"task_ids":    plan.TaskIDs,
+			"accepted_at": plan.AcceptedAt,
+		}).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "计划不存在"})
+		case errors.Is(err, errPlanAccepted):
+			c.JSON(http.StatusConflict, gin.H{"error": "计划已接受", "taskIds": plan.TaskIDs})
+		default:
+			config.Logger.Errorw("接受计划失败", "error", err, "uid", uid, "planID", c.Param("id"))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "接受计划失败"})
+		}
+		return
+	}
+
+	// 事务提交后再推送变更通知
+	for i, task := range tasks {
+		services.PublishSyncChange(uid, models.EntityTask, task.ID, seqs[i])
+	}
+
+	responses := make([]models.TaskResponse, 0, len(tasks))
+	for _, task := range tasks {
+		responses = append(responses, toTaskResponse(task))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "计划已接受",
+		"data":    responses,
+	})
+}
+
+// newTaskFromPlan 将计划任务转换为任务记录
+func newTaskFromPlan(planTask models.PlanTask, uid string, now time.Time) models.Task {
+	// 客户端任务ID为大写 UUID，保持一致以免同步时被当作不同记录
+	task := models.Task{
+		ID:           strings.ToUpper(uuid.New().String()),
+		Title:        planTask.Title,
+		Notes:        planTask.Notes,
+		Difficulty:   defaultPlanTaskDifficulty,
+		Priority:     planTask.Priority,
+		UserID:       uid,
+		LastModified: now,
+
+		RepeatInterval: 1,
+	}
+
+	// 客户端任务必须有计划时间，未指定时使用当前时间
+	plannedDate := now.UTC()
+	if planTask.DueDate != "" {
+		if dueDate, err := services.ParsePlanTime(planTask.DueDate); err == nil {
+			plannedDate = dueDate
+		}
+	}
+	task.PlannedDate = &plannedDate
+
+	if planTask.HasAlarm {
+		if alarmDate, err := services.ParsePlanTime(planTask.AlarmDate); err == nil {
+			task.AlarmDate = &alarmDate
+		}
+	}
+
+	if planTask.RecurrenceRule != "none" {
+		task.RepeatType = planTask.RecurrenceRule
+		if planTask.RecurrenceInterval > 0 {
+			task.RepeatInterval = planTask.RecurrenceInterval
+		}
+	}
+
+	task.FieldModified = services.NewFieldTimestamps(services.TaskMergeFields, func(string) time.Time { return now })
+	return task
+}
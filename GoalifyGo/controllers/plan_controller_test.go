@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAcceptPlanCarriesPriorityAlarmAndInterval(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.Plan{}, &models.Task{}, &models.SyncChange{})
+
+	plan := models.Plan{
+		ID:     "P1",
+		UserID: "u1",
+		Status: models.PlanStatusPending,
+		Tasks: models.PlanTasks{
+			{Title: "复习", Priority: 1, HasAlarm: true, AlarmDate: "2024-06-01T08:00:00+08:00", RecurrenceRule: "weekly", RecurrenceInterval: 2},
+			{Title: "整理书桌", Priority: 0, RecurrenceRule: "none"},
+		},
+	}
+	if err := db.Create(&models.User{ID: "u1"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := db.Create(&plan).Error; err != nil {
+		t.Fatalf("创建计划失败: %v", err)
+	}
+
+	r := newTestRouter()
+	r.POST("/plans/:id/accept", (&PlanController{}).AcceptPlan)
+	w := performJSON(t, r, http.MethodPost, "/plans/P1/accept", "u1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("接受计划 status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data []models.TaskResponse `json:"data"`
+	}
+	decodeJSON(t, w, &resp)
+	if len(resp.Data) != 2 {
+		t.Fatalf("生成任务 %d 个, want 2", len(resp.Data))
+	}
+
+	var task models.Task
+	if err := db.First(&task, "id = ?", resp.Data[0].ID).Error; err != nil {
+		t.Fatalf("查询任务失败: %v", err)
+	}
+	wantAlarm := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if task.Priority != 1 || task.Quadrant != "" {
+		t.Errorf("优先级/象限 = %d/%q, want 1/空", task.Priority, task.Quadrant)
+	}
+	if task.AlarmDate == nil || !task.AlarmDate.Equal(wantAlarm) {
+		t.Errorf("提醒时间 = %v, want %v", task.AlarmDate, wantAlarm)
+	}
+	if task.RepeatType != "weekly" || task.RepeatInterval != 2 {
+		t.Errorf("重复 = %s/%d, want weekly/2", task.RepeatType, task.RepeatInterval)
+	}
+	if !resp.Data[0].HasAlarm || resp.Data[0].RepeatInterval != 2 || resp.Data[0].Priority != 1 {
+		t.Errorf("响应 = %+v, want 带提醒、间隔为 2、优先级为 1", resp.Data[0])
+	}
+
+	plain := resp.Data[1]
+	if plain.Priority != 0 || plain.Quadrant != "" || plain.HasAlarm || plain.AlarmDate != nil || plain.RepeatType != "" || plain.RepeatInterval != 1 {
+		t.Errorf("无优先级任务 = %+v, want 不设优先级、提醒和重复", plain)
+	}
+}
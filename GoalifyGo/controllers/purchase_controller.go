@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/middleware"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PurchaseController struct{}
+
+// VerifyAppStorePurchase 校验客户端提交的 App Store 签名交易并发放能量或订阅。
+// 失败的响应不作为幂等响应缓存，客户端可以用同一幂等键重试
+func (pc *PurchaseController) VerifyAppStorePurchase(c *gin.Context) {
+	var req struct {
+		SignedTransaction string `json:"signedTransaction" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.DiscardIdempotentResponse(c)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+		return
+	}
+
+	verifier, err := services.AppStoreVerifierInstance()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "暂不支持内购"})
+		return
+	}
+
+	uid := c.GetString("uid")
+	info, err := verifier.VerifyTransaction(req.SignedTransaction)
+	if err != nil {
+		config.Logger.Warnw("App Store 交易校验失败", "error", err, "uid", uid)
+		middleware.DiscardIdempotentResponse(c)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "交易校验失败"})
+		return
+	}
+
+	result, err := services.ApplyAppStoreTransaction(uid, info)
+	if err != nil {
+		middleware.DiscardIdempotentResponse(c)
+		switch {
+		case errors.Is(err, services.ErrAppStoreBundleMismatch),
+			errors.Is(err, services.ErrAppStoreEnvMismatch),
+			errors.Is(err, services.ErrAppStoreUnknownProduct):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAppStoreAccountMismatch),
+			errors.Is(err, services.ErrAppStoreTransactionUsed):
+			config.Logger.Warnw("App Store 交易用户不匹配", "error", err, "uid", uid, "transactionID", info.TransactionID)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			config.Logger.Errorw("处理 App Store 交易失败", "error", err, "uid", uid, "transactionID", info.TransactionID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "处理交易失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// HandleAppStoreNotification 接收 App Store Server Notifications v2 通知。
+// 只有重试也无法处理的通知（不属于本应用或环境、未知商品、用户不匹配）返回 200 确认；
+// 签名校验失败和其他处理失败返回非 200，由 App Store 稍后重试
+func (pc *PurchaseController) HandleAppStoreNotification(c *gin.Context) {
+	var req struct {
+		SignedPayload string `json:"signedPayload" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+		return
+	}
+
+	verifier, err := services.AppStoreVerifierInstance()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "暂不支持内购"})
+		return
+	}
+
+	notification, err := verifier.VerifyNotification(req.SignedPayload)
+	if err != nil {
+		config.Logger.Warnw("App Store 通知校验失败", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "通知校验失败"})
+		return
+	}
+
+	if err := services.HandleAppStoreNotification(notification); err != nil {
+		switch {
+		case errors.Is(err, services.ErrAppStoreBundleMismatch),
+			errors.Is(err, services.ErrAppStoreEnvMismatch),
+			errors.Is(err, services.ErrAppStoreUnknownProduct),
+			errors.Is(err, services.ErrAppStoreAccountMismatch),
+			errors.Is(err, services.ErrAppStoreTransactionUsed):
+			// 重试也无法处理的通知直接确认，避免 App Store 反复重发
+			config.Logger.Warnw("忽略无法处理的 App Store 通知", "error", err, "type", notification.NotificationType, "notificationUUID", notification.NotificationUUID)
+		default:
+			config.Logger.Errorw("处理 App Store 通知失败", "error", err, "type", notification.NotificationType, "notificationUUID", notification.NotificationUUID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "处理通知失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
@@ -3,48 +3,62 @@ package controllers
 import (
 	"GoalifyGo/config"
 	"GoalifyGo/models"
-	"GoalifyGo/utils"
+	"GoalifyGo/services"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type RedeemController struct{}
 
-// CreateRedeemCode 创建兑换码
-func (rc *RedeemController) CreateRedeemCode(c *gin.Context) {
-	energy := c.Query("energy")
-	energyInt := 20
-	if energy != "" {
-		var err error
-		energyInt, err = strconv.Atoi(energy)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的能量值"})
-			return
-		}
+// parseOptionalTime 解析可选的 RFC3339 时间，为空时返回 nil
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
 	}
+	return &t, nil
+}
 
-	password := c.Query("password")
-	if password != "832251086jjxG@" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "fuck you"})
+// CreateRedeemCode 创建兑换码，未指定能量值时为 20；各字段均可省略，请求体为空时全部使用默认值
+func (rc *RedeemController) CreateRedeemCode(c *gin.Context) {
+	var req struct {
+		Energy     int    `json:"energy"`
+		CodeLength int    `json:"codeLength"`
+		ExpiresAt  string `json:"expiresAt"` // RFC3339，为空表示不过期
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
 		return
 	}
+	if req.Energy == 0 {
+		req.Energy = 20
+	}
 
-	// 生成4位兑换码
-	code := models.GenerateRedeemCode()
-
-	// 创建兑换码记录
-	redeemCode := models.RedeemCode{
-		ID:        utils.GenerateID(),
-		Code:      code,
-		Energy:    energyInt, // 默认20点能量
-		CreatedAt: time.Now(),
+	expiresAt, err := parseOptionalTime(req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间格式"})
+		return
 	}
 
-	// 保存到数据库
-	if err := config.DB.Create(&redeemCode).Error; err != nil {
+	redeemCode, err := services.CreateSingleRedeemCode(req.Energy, req.CodeLength, expiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRedeemOptions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.Logger.Errorw("创建兑换码失败", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建兑换码失败"})
 		return
 	}
@@ -52,83 +66,147 @@ func (rc *RedeemController) CreateRedeemCode(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":      redeemCode.Code,
 		"energy":    redeemCode.Energy,
+		"expiresAt": redeemCode.ExpiresAt,
 		"createdAt": redeemCode.CreatedAt,
 	})
 }
 
-// RedeemCode 兑换能量码
-func (rc *RedeemController) RedeemCode(c *gin.Context) {
+// CreateRedeemCampaign 创建兑换码批次，以 CSV 文件返回生成的兑换码
+func (rc *RedeemController) CreateRedeemCampaign(c *gin.Context) {
 	var req struct {
-		Code string `json:"code" binding:"required"`
+		Name       string `json:"name"`
+		Energy     int    `json:"energy" binding:"required"`
+		Count      int    `json:"count" binding:"required"`
+		CodeLength int    `json:"codeLength"`
+		MaxUses    int    `json:"maxUses"`
+		ExpiresAt  string `json:"expiresAt"` // RFC3339，为空表示不过期
 	}
-
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
 		return
 	}
 
-	// 获取用户ID
-	uid, exists := c.Get("uid")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+	expiresAt, err := parseOptionalTime(req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间格式"})
 		return
 	}
 
-	// 查找兑换码
-	var redeemCode models.RedeemCode
-	if err := config.DB.Where("code = ?", req.Code).First(&redeemCode).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "兑换码不存在"})
+	campaign, codes, err := services.CreateRedeemCampaign(services.RedeemCampaignOptions{
+		Name:       req.Name,
+		Energy:     req.Energy,
+		Count:      req.Count,
+		CodeLength: req.CodeLength,
+		MaxUses:    req.MaxUses,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRedeemOptions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.Logger.Errorw("创建兑换码批次失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建兑换码批次失败"})
 		return
 	}
 
-	// 检查是否已使用
-	if redeemCode.UsedAt != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "兑换码已使用"})
-		return
-	}
+	writeRedeemCodesCSV(c, campaign, codes)
+}
 
-	// 更新用户能量
-	var user models.User
-	if err := config.DB.Where("id = ?", uid).First(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
+// ExportRedeemCampaign 以 CSV 文件导出批次的兑换码及使用情况
+func (rc *RedeemController) ExportRedeemCampaign(c *gin.Context) {
+	campaign, codes, err := services.ListRedeemCampaignCodes(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "兑换码批次不存在"})
+		} else {
+			config.Logger.Errorw("导出兑换码批次失败", "error", err, "campaignID", c.Param("id"))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出兑换码失败"})
+		}
 		return
 	}
 
-	// 更新兑换码状态
-	now := time.Now()
-	redeemCode.UsedAt = &now
-	redeemCode.UserID = &user.ID
+	writeRedeemCodesCSV(c, campaign, codes)
+}
 
-	// 开启事务
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+// writeRedeemCodesCSV 输出兑换码 CSV 附件
+func writeRedeemCodesCSV(c *gin.Context, campaign *models.RedeemCampaign, codes []models.RedeemCode) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="redeem-%s.csv"`, campaign.ID))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"code", "energy", "max_uses", "use_count", "expires_at", "campaign_id", "campaign_name"})
+	for _, code := range codes {
+		expiresAt := ""
+		if code.ExpiresAt != nil {
+			expiresAt = code.ExpiresAt.Format(time.RFC3339)
 		}
-	}()
+		w.Write([]string{
+			code.Code,
+			strconv.Itoa(code.Energy),
+			strconv.Itoa(code.MaxUses),
+			strconv.Itoa(code.UseCount),
+			expiresAt,
+			campaign.ID,
+			campaign.Name,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		config.Logger.Errorw("写入兑换码 CSV 失败", "error", err, "campaignID", campaign.ID)
+	}
+}
+
+// RedeemCode 兑换能量码
+func (rc *RedeemController) RedeemCode(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+		return
+	}
 
-	// 更新用户能量
-	if err := tx.Model(&user).Update("energy", user.Energy+redeemCode.Energy).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户能量失败"})
+	// 获取用户ID
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
 		return
 	}
 
-	// 更新兑换码状态
-	if err := tx.Save(&redeemCode).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新兑换码状态失败"})
+	// 查询兑换码之前预留一次尝试名额，用户或 IP 被锁定或尝试过多时直接拒绝。
+	// 只信任配置的反向代理转发的客户端 IP，客户端无法伪造 X-Forwarded-For 绕过 IP 限制
+	attempt, retryAfter := services.ReserveRedeemAttempt(uid.(string), c.ClientIP())
+	if attempt == nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "尝试次数过多，请稍后再试"})
 		return
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "兑换失败"})
+	newEnergy, _, err := services.RedeemEnergyCode(uid.(string), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRedeemCodeNotFound),
+			errors.Is(err, services.ErrRedeemCodeUsed),
+			errors.Is(err, services.ErrRedeemCodeExpired),
+			errors.Is(err, services.ErrRedeemCodeAlreadyClaimed):
+			// 各种无效原因返回相同的响应，避免通过响应差异枚举兑换码
+			attempt.Fail()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "兑换码无效或已失效"})
+		default:
+			// 服务端错误不计入失败次数
+			attempt.Succeed()
+			config.Logger.Errorw("兑换能量码失败", "error", err, "uid", uid)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "兑换失败"})
+		}
 		return
 	}
+	attempt.Succeed()
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "兑换成功",
-		"newEnergy": user.Energy + redeemCode.Energy,
+		"newEnergy": newEnergy,
 	})
 }
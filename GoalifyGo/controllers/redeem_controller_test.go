@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"GoalifyGo/testutil"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setupRedeemFixture 创建兑换测试需要的用户和各种无效的兑换码
+func setupRedeemFixture(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testutil.SetupDB(t, &models.User{}, &models.EnergyLedgerEntry{}, &models.RedeemCode{}, &models.RedeemRedemption{})
+
+	for _, uid := range []string{"redeem-user", "other-user"} {
+		if err := db.Create(&models.User{ID: uid, Energy: 10}).Error; err != nil {
+			t.Fatalf("创建测试用户失败: %v", err)
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	usedAt := past
+	codes := []models.RedeemCode{
+		{ID: "used", Code: "USEDCODE01", Energy: 20, MaxUses: 1, UseCount: 1, UsedAt: &usedAt},
+		{ID: "expired", Code: "EXPIRED001", Energy: 20, MaxUses: 1, ExpiresAt: &past},
+		{ID: "multi", Code: "MULTIUSE01", Energy: 20, MaxUses: 10},
+		{ID: "valid", Code: "VALIDCODE1", Energy: 20, MaxUses: 1},
+	}
+	if err := db.Create(&codes).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+	return db
+}
+
+func TestRedeemCodeUniformFailures(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+	setupRedeemFixture(t)
+
+	r := newTestRouter()
+	rc := RedeemController{}
+	r.POST("/redeem", rc.RedeemCode)
+
+	// 先兑换一次多次可用的兑换码，再次兑换时为已兑换过
+	if w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": "multiuse01"}); w.Code != http.StatusOK {
+		t.Fatalf("兑换失败: %d %s", w.Code, w.Body.String())
+	}
+
+	var first string
+	for _, code := range []string{"NOSUCHCODE", "USEDCODE01", "EXPIRED001", "MULTIUSE01"} {
+		w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": code})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("兑换 %s 的状态码 = %d, want 400", code, w.Code)
+		}
+		if first == "" {
+			first = w.Body.String()
+		} else if w.Body.String() != first {
+			t.Errorf("兑换 %s 的响应 = %s, want %s", code, w.Body.String(), first)
+		}
+	}
+}
+
+func TestRedeemCodeLocksOutAfterFailures(t *testing.T) {
+	logs := testutil.ObserveLogs(t)
+	redis := testutil.SetupRedis(t)
+	db := setupRedeemFixture(t)
+
+	r := newTestRouter()
+	rc := RedeemController{}
+	r.POST("/redeem", rc.RedeemCode)
+
+	// 成功的兑换退还名额，不计入失败次数
+	if w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": "VALIDCODE1"}); w.Code != http.StatusOK {
+		t.Fatalf("兑换失败: %d %s", w.Code, w.Body.String())
+	}
+
+	for i := 0; i < 5; i++ {
+		if w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": "NOSUCHCODE"}); w.Code != http.StatusBadRequest {
+			t.Fatalf("第 %d 次失败的状态码 = %d, want 400", i+1, w.Code)
+		}
+	}
+	if events := testutil.SecurityEvents(logs, "redeem_bruteforce_lockout"); len(events) != 1 {
+		t.Fatalf("安全事件数 = %d, want 1", len(events))
+	}
+
+	// 锁定期间即使兑换码有效也直接拒绝，不查询兑换码
+	if err := db.Create(&models.RedeemCode{ID: "fresh", Code: "FRESHCODE1", Energy: 20, MaxUses: 1}).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+	w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": "FRESHCODE1"})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("锁定期间的响应 = %d (Retry-After %q), want 429 (60)", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// 锁定到期后可以兑换
+	redis.FastForward(time.Minute)
+	if w := performJSON(t, r, http.MethodPost, "/redeem", "redeem-user", gin.H{"code": "FRESHCODE1"}); w.Code != http.StatusOK {
+		t.Errorf("锁定到期后兑换失败: %d %s", w.Code, w.Body.String())
+	}
+
+	// 其他用户不受影响
+	if attempt, _ := services.ReserveRedeemAttempt("other-user", "192.0.2.1"); attempt == nil {
+		t.Errorf("其他用户不应被锁定")
+	}
+}
+
+// readRedeemCSV 解析兑换码 CSV，检查表头并按兑换码返回各行
+func readRedeemCSV(t *testing.T, w *httptest.ResponseRecorder) map[string][]string {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("解析 CSV 失败: %v", err)
+	}
+	wantHeader := "code,energy,max_uses,use_count,expires_at,campaign_id,campaign_name"
+	if len(records) == 0 || strings.Join(records[0], ",") != wantHeader {
+		t.Fatalf("CSV 表头 = %v, want %s", records, wantHeader)
+	}
+	rows := make(map[string][]string, len(records)-1)
+	for _, record := range records[1:] {
+		rows[record[0]] = record
+	}
+	if len(rows) != len(records)-1 {
+		t.Errorf("CSV 中有重复的兑换码: %v", records)
+	}
+	return rows
+}
+
+func TestRedeemCampaignCSV(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.EnergyLedgerEntry{}, &models.RedeemCampaign{},
+		&models.RedeemCode{}, &models.RedeemRedemption{})
+	if err := db.Create(&models.User{ID: "redeem-user", Energy: 10}).Error; err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+
+	r := newTestRouter()
+	rc := RedeemController{}
+	r.POST("/redeem/campaigns", rc.CreateRedeemCampaign)
+	r.GET("/redeem/campaigns/:id/export", rc.ExportRedeemCampaign)
+
+	expiresAt := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+	rows := readRedeemCSV(t, performJSON(t, r, http.MethodPost, "/redeem/campaigns", "", gin.H{
+		"name":      "春节活动",
+		"energy":    30,
+		"count":     3,
+		"maxUses":   2,
+		"expiresAt": expiresAt,
+	}))
+
+	var campaign models.RedeemCampaign
+	if err := db.First(&campaign).Error; err != nil {
+		t.Fatalf("查询兑换码批次失败: %v", err)
+	}
+	var codes []models.RedeemCode
+	if err := db.Where("campaign_id = ?", campaign.ID).Find(&codes).Error; err != nil {
+		t.Fatalf("查询兑换码失败: %v", err)
+	}
+	if len(rows) != 3 || len(codes) != 3 {
+		t.Fatalf("CSV 行数 = %d, 兑换码数 = %d, want 3", len(rows), len(codes))
+	}
+	for _, code := range codes {
+		row, ok := rows[code.Code]
+		if !ok {
+			t.Errorf("CSV 中缺少兑换码 %s", code.Code)
+			continue
+		}
+		want := []string{code.Code, "30", "2", "0", expiresAt, campaign.ID, "春节活动"}
+		if strings.Join(row, ",") != strings.Join(want, ",") {
+			t.Errorf("CSV 行 = %v, want %v", row, want)
+		}
+	}
+
+	// 导出时反映兑换次数
+	redeemed := codes[0].Code
+	if _, _, err := services.RedeemEnergyCode("redeem-user", redeemed); err != nil {
+		t.Fatalf("兑换失败: %v", err)
+	}
+	rows = readRedeemCSV(t, performJSON(t, r, http.MethodGet, "/redeem/campaigns/"+campaign.ID+"/export", "", nil))
+	if len(rows) != 3 {
+		t.Fatalf("导出 CSV 行数 = %d, want 3", len(rows))
+	}
+	for code, row := range rows {
+		want := "0"
+		if code == redeemed {
+			want = "1"
+		}
+		if row[3] != want {
+			t.Errorf("兑换码 %s 的 use_count = %s, want %s", code, row[3], want)
+		}
+	}
+
+	if w := performJSON(t, r, http.MethodGet, "/redeem/campaigns/missing/export", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("导出不存在的批次的状态码 = %d, want 404", w.Code)
+	}
+}
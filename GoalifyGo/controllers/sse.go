@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/middleware"
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 聊天与复盘流的 SSE 事件名称
+const (
+	sseEventDelta      = "delta"      // 内容片段
+	sseEventStructured = "structured" // 服务端解析出的结构化数据
+	sseEventError      = "error"      // 生成失败
+	sseEventDone       = "done"       // 生成结束，附带用量和剩余能量
+)
+
+// 流式错误代码
+const (
+	streamErrorGenerationFailed = "generation_failed"
+)
+
+// 结构化数据类型
+const (
+	structuredTypePlan          = "plan"
+	structuredTypeEmotionRecord = "emotion_record"
+)
+
+// setSSEHeaders 设置流式响应头
+func setSSEHeaders(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+}
+
+// writeSSEEvent 以 JSON 数据写入一个 SSE 事件并立即发送。
+// 以 error 事件结束的流状态码仍为 200，需标记为不缓存，客户端用同一幂等键重试时才会重新生成。
+func writeSSEEvent(ctx *gin.Context, event string, data interface{}) error {
+	if event == sseEventError {
+		middleware.DiscardIdempotentResponse(ctx)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(ctx.Writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	ctx.Writer.Flush() // 确保每个事件都被立即发送
+	return nil
+}
+
+// writeStreamError 发送生成失败的 error 事件；设置 SSE 响应头之后的失败都应使用该事件而不是 JSON 响应
+func writeStreamError(ctx *gin.Context) {
+	if err := writeSSEEvent(ctx, sseEventError, gin.H{
+		"code":    streamErrorGenerationFailed,
+		"message": "生成内容时出错",
+	}); err != nil {
+		logSSEWriteError(ctx, sseEventError, err)
+	}
+}
+
+// logSSEWriteError 记录 SSE 事件写入失败，通常是客户端已断开
+func logSSEWriteError(ctx *gin.Context, event string, err error) {
+	config.Logger.Warnw("写入SSE事件失败", "error", err, "uid", ctx.GetString("uid"), "event", event, "path", ctx.FullPath())
+}
+
+// streamOutcome 流转发的结果
+type streamOutcome int
+
+const (
+	streamCompleted        streamOutcome = iota // 生成完成
+	streamGenerationFailed                      // 模型调用失败或生成被取消
+	streamClientGone                            // 客户端已断开
+)
+
+// relayStream 将生成流转发为 delta 事件，生成出错时发送 error 事件。
+// 返回已发送的内容和用量，结果不是 streamCompleted 时调用方不应再继续写入。
+func relayStream(ctx *gin.Context, stream <-chan services.StreamEvent) (content string, usage *services.TokenUsage, outcome streamOutcome) {
+	// 未完成的流不缓存为幂等响应
+	defer func() {
+		if outcome != streamCompleted {
+			middleware.DiscardIdempotentResponse(ctx)
+		}
+	}()
+
+	var fullResponse strings.Builder
+	for event := range stream {
+		switch {
+		case event.Err != nil:
+			// 客户端断开导致的生成取消不算生成失败
+			if ctx.Request.Context().Err() != nil {
+				return fullResponse.String(), nil, streamClientGone
+			}
+			writeStreamError(ctx)
+			return fullResponse.String(), nil, streamGenerationFailed
+		case event.Usage != nil:
+			usage = event.Usage
+		default:
+			if err := writeSSEEvent(ctx, sseEventDelta, gin.H{"content": event.Content}); err != nil {
+				logSSEWriteError(ctx, sseEventDelta, err)
+				return fullResponse.String(), nil, streamClientGone
+			}
+			fullResponse.WriteString(event.Content)
+		}
+	}
+	// 生成协程只有正常结束时才会发送用量；没有用量说明生成被中途取消，
+	// 如服务器关闭时取消了生成上下文，此时错误事件可能已被丢弃，不能当作生成完成
+	if usage == nil {
+		if ctx.Request.Context().Err() != nil {
+			return fullResponse.String(), nil, streamClientGone
+		}
+		writeStreamError(ctx)
+		return fullResponse.String(), nil, streamGenerationFailed
+	}
+	return fullResponse.String(), usage, streamCompleted
+}
+
+// settleEnergy 根据流结果确认或退还预扣的能量：生成失败，或客户端在收到首个片段前断开时退还
+func settleEnergy(reservation *models.EnergyReservation, outcome streamOutcome, delivered string) {
+	var err error
+	if outcome == streamGenerationFailed || (outcome == streamClientGone && delivered == "") {
+		err = services.ReleaseEnergy(reservation)
+	} else {
+		err = services.CommitEnergy(reservation)
+	}
+	if err != nil && reservation != nil {
+		config.Logger.Errorw("结算能量预扣失败", "error", err, "reservationID", reservation.ID, "uid", reservation.UserID)
+	}
+}
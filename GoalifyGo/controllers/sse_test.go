@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"GoalifyGo/services"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRelayStreamOutcome(t *testing.T) {
+	usage := &services.TokenUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}
+
+	cases := []struct {
+		name string
+		// events 生成协程在关闭通道前发送的事件
+		events       []services.StreamEvent
+		clientGone   bool
+		want         streamOutcome
+		wantLastSent string
+	}{
+		{
+			name:         "completed with usage",
+			events:       []services.StreamEvent{{Content: "你好"}, {Usage: usage}},
+			want:         streamCompleted,
+			wantLastSent: sseEventDelta,
+		},
+		{
+			name:         "error event",
+			events:       []services.StreamEvent{{Content: "你好"}, {Err: context.Canceled}},
+			want:         streamGenerationFailed,
+			wantLastSent: sseEventError,
+		},
+		{
+			// 服务器关闭时生成上下文被取消，错误事件被丢弃，通道直接关闭
+			name:         "closed without usage",
+			events:       []services.StreamEvent{{Content: "你好"}},
+			want:         streamGenerationFailed,
+			wantLastSent: sseEventError,
+		},
+		{
+			name:         "client gone without usage",
+			events:       []services.StreamEvent{{Content: "你好"}},
+			clientGone:   true,
+			want:         streamClientGone,
+			wantLastSent: sseEventDelta,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			reqCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/chat", nil).WithContext(reqCtx)
+			if tc.clientGone {
+				cancel()
+			}
+
+			stream := make(chan services.StreamEvent, len(tc.events))
+			for _, event := range tc.events {
+				stream <- event
+			}
+			close(stream)
+
+			content, gotUsage, outcome := relayStream(ctx, stream)
+			if outcome != tc.want {
+				t.Errorf("outcome = %d, want %d", outcome, tc.want)
+			}
+			if content != "你好" {
+				t.Errorf("content = %q, want %q", content, "你好")
+			}
+			if (outcome == streamCompleted) != (gotUsage != nil) {
+				t.Errorf("usage = %v, outcome = %d", gotUsage, outcome)
+			}
+
+			frames := parseSSE(t, w.Body.String())
+			if last := frames[len(frames)-1].Event; last != tc.wantLastSent {
+				t.Errorf("最后一个事件 = %s, want %s", last, tc.wantLastSent)
+			}
+		})
+	}
+}
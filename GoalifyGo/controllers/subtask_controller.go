@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SubtaskController struct{}
+
+// SyncSubtasks 处理子任务同步
+func (sc *SubtaskController) SyncSubtasks(c *gin.Context) {
+	var subtasks []models.SyncSubtasksRequest
+	if err := c.ShouldBindJSON(&subtasks); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 获取用户ID
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未获取到用户ID"})
+		return
+	}
+
+	// 逐条更新或创建子任务，每条子任务使用独立事务
+	results := make([]models.SyncItemResult, 0, len(subtasks))
+	for _, subtaskReq := range subtasks {
+		subtaskReq.ConvertToUTC()
+
+		result, _ := runSyncItem(c, models.EntitySubtask, subtaskReq.ID, func(tx *gorm.DB) (string, *models.SyncConflict, error) {
+			return syncSubtask(tx, uid.(string), &subtaskReq)
+		})
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "子任务同步完成",
+		"results": results,
+	})
+}
+
+// syncSubtask 在事务中写入单条子任务
+func syncSubtask(tx *gorm.DB, uid string, subtaskReq *models.SyncSubtasksRequest) (string, *models.SyncConflict, error) {
+	// 关联任务不存在或属于其他用户，拒绝写入，避免产生孤儿数据
+	if err := requireOwnedTask(tx, uid, subtaskReq.TaskID); err != nil {
+		return "", nil, err
+	}
+
+	subtask := models.Subtask{
+		ID:             subtaskReq.ID,
+		Title:          subtaskReq.Title,
+		IsCompleted:    subtaskReq.IsCompleted,
+		TaskID:         subtaskReq.TaskID,
+		LastModified:   time.Now(),
+		ClientModified: &subtaskReq.LastModified,
+		UserID:         uid,
+	}
+
+	// 检查当前用户是否已有该子任务
+	var existingSubtask models.Subtask
+	err := tx.Where("id = ? AND user_id = ?", subtask.ID, uid).First(&existingSubtask).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 如果不存在，创建新子任务
+		if err := tx.Create(&subtask).Error; err != nil {
+			return "", nil, err
+		}
+		return models.SyncItemApplied, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 已删除的子任务不会被普通写入恢复
+	if existingSubtask.Status == models.StatusDeleted {
+		return models.SyncItemStale, nil, nil
+	}
+
+	// 如果存在，与上次客户端提交的修改时间比较；没有记录客户端时间的旧数据直接采用客户端版本
+	if existingSubtask.ClientModified != nil && !subtaskReq.LastModified.After(*existingSubtask.ClientModified) {
+		return models.SyncItemStale, nil, nil
+	}
+	if err := services.SaveOwned(tx, uid, &subtask); err != nil {
+		return "", nil, err
+	}
+	return models.SyncItemApplied, nil, nil
+}
@@ -3,14 +3,38 @@ package controllers
 import (
 	"GoalifyGo/config"
 	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type SyncController struct{}
 
+// 游标同步默认及最大分页大小
+const (
+	defaultSyncPageSize = 500
+	maxSyncPageSize     = 1000
+)
+
+// neverSyncedDate 未提供 lastSyncDate 时使用的时间，不晚于该时间的 lastSyncDate 视为从未同步
+var neverSyncedDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// 全量同步时实体类型的输出顺序
+var fullSyncEntityTypes = []string{
+	models.EntityEmotion,
+	models.EntityTask,
+	models.EntitySubtask,
+	models.EntityTimeRecord,
+}
+
 // GetUpdates 获取自上次同步以来的更新
+// full=true 或首次携带空 cursor 时分页返回用户的全部数据；携带 cursor 参数时按服务端变更序号增量同步；否则沿用 lastSyncDate 时间戳同步
+// 上次同步之后的删除记录已被清理时返回 410，客户端需要清空本地同步数据后全量同步
 func (sc *SyncController) GetUpdates(c *gin.Context) {
 	// 获取用户ID
 	uid, exists := c.Get("uid")
@@ -19,6 +43,26 @@ func (sc *SyncController) GetUpdates(c *gin.Context) {
 		return
 	}
 
+	if c.Query("full") == "true" {
+		// 客户端要求重新全量同步时可能仍携带增量游标，忽略该游标并从头开始
+		cursor := c.Query("cursor")
+		if !services.IsFullSyncCursor(cursor) {
+			cursor = ""
+		}
+		sc.getFullResync(c, uid.(string), cursor)
+		return
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		// 首次使用游标时，变更日志中没有引入游标之前就已存在的数据，先全量同步再切换到增量同步
+		if cursor == "" || services.IsFullSyncCursor(cursor) {
+			sc.getFullResync(c, uid.(string), cursor)
+			return
+		}
+		sc.getUpdatesByCursor(c, uid.(string), cursor)
+		return
+	}
+
 	// 获取上次同步时间
 	lastSyncDateStr := c.Query("lastSyncDate")
 	var lastSyncDate time.Time
@@ -32,37 +76,595 @@ func (sc *SyncController) GetUpdates(c *gin.Context) {
 		}
 	} else {
 		// 如果没有提供上次同步时间，则使用很久以前的时间
-		lastSyncDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		lastSyncDate = neverSyncedDate
+	}
+
+	// 超过墓碑保留期未同步的设备可能漏掉已被清理的删除记录，要求客户端全量同步。
+	// 从未同步过的设备（时间不晚于 neverSyncedDate）没有需要清理的本地数据，直接返回全部数据
+	if lastSyncDate.After(neverSyncedDate) && lastSyncDate.Before(services.TombstoneCutoff()) {
+		respondFullResyncRequired(c)
+		return
+	}
+
+	// 先读取当前序号再查询数据，客户端切换到游标同步后不会漏掉查询期间的变更
+	seq, err := services.CurrentSeq(uid.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取同步序号失败"})
+		return
 	}
 
-	// 计算一个月前的时间
-	oneMonthAgo := time.Now().AddDate(0, -1, 0)
+	response := newSyncUpdatesResponse()
+	response.Cursor = services.EncodeSyncCursor(seq)
 
 	// 查询情绪记录更新
 	var emotions []models.EmotionRecord
-	if err := config.DB.Where("user_id = ? AND last_modified > ? AND last_modified > ? AND status = 0",
-		uid, lastSyncDate, oneMonthAgo).Find(&emotions).Error; err != nil {
+	if err := config.DB.Where("user_id = ? AND last_modified > ?",
+		uid, lastSyncDate).Find(&emotions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取情绪记录更新失败"})
 		return
 	}
+	for _, emotion := range emotions {
+		appendEmotionUpdate(&response, emotion)
+	}
 
-	emotionResponses := make([]models.EmotionResponse, len(emotions))
-	for i, emotion := range emotions {
-		emotionResponses[i] = models.EmotionResponse{
-			ID:               emotion.ID,
-			EmotionType:      emotion.EmotionType,
-			Intensity:        emotion.Intensity,
-			Trigger:          emotion.Trigger,
-			UnhealthyBeliefs: emotion.UnhealthyBeliefs,
-			HealthyEmotion:   emotion.HealthyEmotion,
-			CopingStrategies: emotion.CopingStrategies,
-			RecordDate:       emotion.RecordDate,
-			LastModified:     emotion.LastModified,
-		}
+	// 查询任务更新
+	var tasks []models.Task
+	if err := config.DB.Where("user_id = ? AND last_modified > ?",
+		uid, lastSyncDate).Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务更新失败"})
+		return
+	}
+	for _, task := range tasks {
+		appendTaskUpdate(&response, task)
+	}
+
+	// 查询子任务更新
+	var subtasks []models.Subtask
+	if err := config.DB.Where("user_id = ? AND last_modified > ?",
+		uid, lastSyncDate).Find(&subtasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取子任务更新失败"})
+		return
+	}
+	for _, subtask := range subtasks {
+		appendSubtaskUpdate(&response, subtask)
+	}
+
+	// 查询时间记录更新
+	var timeRecords []models.TimeRecord
+	if err := config.DB.Where("user_id = ? AND last_modified > ?",
+		uid, lastSyncDate).Find(&timeRecords).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间记录更新失败"})
+		return
+	}
+	for _, record := range timeRecords {
+		appendTimeRecordUpdate(&response, record)
 	}
 
 	// 返回响应
-	c.JSON(http.StatusOK, models.SyncUpdatesResponse{
-		Emotions: emotionResponses,
+	c.JSON(http.StatusOK, response)
+}
+
+// getUpdatesByCursor 按变更日志序号分页返回游标之后的变更
+func (sc *SyncController) getUpdatesByCursor(c *gin.Context, uid string, cursor string) {
+	afterSeq, err := services.DecodeSyncCursor(cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pageSize, err := parseSyncPageSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 游标之后的变更日志已被清理时，无法再得知其中的删除记录
+	if err := services.CheckCursorRetained(uid, afterSeq); err != nil {
+		if errors.Is(err, services.ErrFullResyncRequired) {
+			respondFullResyncRequired(c)
+			return
+		}
+		config.Logger.Errorw("查询同步变更清理位置失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取同步变更失败"})
+		return
+	}
+
+	// 多取一条用于判断是否还有下一页
+	changes, err := services.ListChanges(uid, afterSeq, pageSize+1)
+	if err != nil {
+		config.Logger.Errorw("查询同步变更失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取同步变更失败"})
+		return
+	}
+
+	response := newSyncUpdatesResponse()
+	if len(changes) > pageSize {
+		changes = changes[:pageSize]
+		response.HasMore = true
+	}
+
+	nextSeq := afterSeq
+	if len(changes) > 0 {
+		nextSeq = changes[len(changes)-1].Seq
+	}
+	response.Cursor = services.EncodeSyncCursor(nextSeq)
+
+	// 按实体类型分组加载最新数据
+	idsByType := make(map[string][]string)
+	for _, change := range changes {
+		idsByType[change.EntityType] = append(idsByType[change.EntityType], change.EntityID)
+	}
+
+	emotions := make(map[string]models.EmotionRecord)
+	if ids := idsByType[models.EntityEmotion]; len(ids) > 0 {
+		var records []models.EmotionRecord
+		if err := config.DB.Where("user_id = ? AND id IN ?", uid, ids).Find(&records).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取情绪记录更新失败"})
+			return
+		}
+		for _, record := range records {
+			emotions[record.ID] = record
+		}
+	}
+
+	tasks := make(map[string]models.Task)
+	if ids := idsByType[models.EntityTask]; len(ids) > 0 {
+		var records []models.Task
+		if err := config.DB.Where("user_id = ? AND id IN ?", uid, ids).Find(&records).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务更新失败"})
+			return
+		}
+		for _, record := range records {
+			tasks[record.ID] = record
+		}
+	}
+
+	subtasks := make(map[string]models.Subtask)
+	if ids := idsByType[models.EntitySubtask]; len(ids) > 0 {
+		var records []models.Subtask
+		if err := config.DB.Where("user_id = ? AND id IN ?", uid, ids).Find(&records).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取子任务更新失败"})
+			return
+		}
+		for _, record := range records {
+			subtasks[record.ID] = record
+		}
+	}
+
+	timeRecords := make(map[string]models.TimeRecord)
+	if ids := idsByType[models.EntityTimeRecord]; len(ids) > 0 {
+		var records []models.TimeRecord
+		if err := config.DB.Where("user_id = ? AND id IN ?", uid, ids).Find(&records).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间记录更新失败"})
+			return
+		}
+		for _, record := range records {
+			timeRecords[record.ID] = record
+		}
+	}
+
+	// 按变更顺序输出，已被清理的墓碑视为删除
+	for _, change := range changes {
+		switch change.EntityType {
+		case models.EntityEmotion:
+			if record, ok := emotions[change.EntityID]; ok {
+				appendEmotionUpdate(&response, record)
+			} else {
+				response.Deleted.Emotions = append(response.Deleted.Emotions, change.EntityID)
+			}
+		case models.EntityTask:
+			if record, ok := tasks[change.EntityID]; ok {
+				appendTaskUpdate(&response, record)
+			} else {
+				response.Deleted.Tasks = append(response.Deleted.Tasks, change.EntityID)
+			}
+		case models.EntitySubtask:
+			if record, ok := subtasks[change.EntityID]; ok {
+				appendSubtaskUpdate(&response, record)
+			} else {
+				response.Deleted.Subtasks = append(response.Deleted.Subtasks, change.EntityID)
+			}
+		case models.EntityTimeRecord:
+			if record, ok := timeRecords[change.EntityID]; ok {
+				appendTimeRecordUpdate(&response, record)
+			} else {
+				response.Deleted.TimeRecords = append(response.Deleted.TimeRecords, change.EntityID)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// getFullResync 按实体类型和ID的固定顺序分页返回用户的全部有效数据，用于新设备或重装后恢复完整历史。
+// 最后一页返回的游标为增量同步游标，客户端可直接切换到增量同步。
+func (sc *SyncController) getFullResync(c *gin.Context, uid string, cursor string) {
+	pageSize, err := parseSyncPageSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var position services.FullSyncCursor
+	if cursor == "" {
+		// 记录开始全量同步时的序号，期间发生的变更会在之后的增量同步中补齐
+		position.Seq, err = services.CurrentSeq(uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取同步序号失败"})
+			return
+		}
+	} else {
+		position, err = services.DecodeFullSyncCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	response := newSyncUpdatesResponse()
+	remaining := pageSize
+	for position.TypeIndex < len(fullSyncEntityTypes) && remaining > 0 {
+		count, lastID, err := appendFullSyncPage(&response, uid, fullSyncEntityTypes[position.TypeIndex], position.LastID, remaining)
+		if err != nil {
+			config.Logger.Errorw("全量同步查询失败", "error", err, "uid", uid, "type", fullSyncEntityTypes[position.TypeIndex])
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "全量同步失败"})
+			return
+		}
+
+		remaining -= count
+		if remaining == 0 {
+			// 当前类型可能还有数据，下一页从该ID之后继续
+			position.LastID = lastID
+		} else {
+			position.TypeIndex++
+			position.LastID = ""
+		}
+	}
+
+	if position.TypeIndex < len(fullSyncEntityTypes) {
+		response.HasMore = true
+		response.Cursor = services.EncodeFullSyncCursor(position)
+	} else {
+		response.Cursor = services.EncodeSyncCursor(position.Seq)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// appendFullSyncPage 按ID升序加载某一实体类型在 afterID 之后的最多 limit 条有效数据，返回条数和最后一条的ID
+func appendFullSyncPage(response *models.SyncUpdatesResponse, uid string, entityType string, afterID string, limit int) (int, string, error) {
+	query := config.DB.Where("user_id = ? AND id > ? AND status = ?", uid, afterID, models.StatusNormal).
+		Order("id asc").
+		Limit(limit)
+
+	switch entityType {
+	case models.EntityEmotion:
+		var records []models.EmotionRecord
+		if err := query.Find(&records).Error; err != nil || len(records) == 0 {
+			return 0, "", err
+		}
+		for _, record := range records {
+			appendEmotionUpdate(response, record)
+		}
+		return len(records), records[len(records)-1].ID, nil
+	case models.EntityTask:
+		var records []models.Task
+		if err := query.Find(&records).Error; err != nil || len(records) == 0 {
+			return 0, "", err
+		}
+		for _, record := range records {
+			appendTaskUpdate(response, record)
+		}
+		return len(records), records[len(records)-1].ID, nil
+	case models.EntitySubtask:
+		var records []models.Subtask
+		if err := query.Find(&records).Error; err != nil || len(records) == 0 {
+			return 0, "", err
+		}
+		for _, record := range records {
+			appendSubtaskUpdate(response, record)
+		}
+		return len(records), records[len(records)-1].ID, nil
+	case models.EntityTimeRecord:
+		var records []models.TimeRecord
+		if err := query.Find(&records).Error; err != nil || len(records) == 0 {
+			return 0, "", err
+		}
+		for _, record := range records {
+			appendTimeRecordUpdate(response, record)
+		}
+		return len(records), records[len(records)-1].ID, nil
+	default:
+		return 0, "", fmt.Errorf("未知的实体类型: %s", entityType)
+	}
+}
+
+// respondFullResyncRequired 通知客户端增量同步的数据已不完整，需要清空本地同步数据后使用 full=true 重新全量同步
+func respondFullResyncRequired(c *gin.Context) {
+	c.JSON(http.StatusGone, gin.H{
+		"error":              services.ErrFullResyncRequired.Error(),
+		"fullResyncRequired": true,
 	})
 }
+
+// parseSyncPageSize 解析分页大小参数，超过上限时按上限处理
+func parseSyncPageSize(c *gin.Context) (int, error) {
+	pageSizeStr := c.Query("pageSize")
+	if pageSizeStr == "" {
+		return defaultSyncPageSize, nil
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize <= 0 {
+		return 0, fmt.Errorf("无效的分页大小")
+	}
+	if pageSize > maxSyncPageSize {
+		pageSize = maxSyncPageSize
+	}
+	return pageSize, nil
+}
+
+// newSyncUpdatesResponse 创建空的同步响应，保证列表字段序列化为 [] 而不是 null
+func newSyncUpdatesResponse() models.SyncUpdatesResponse {
+	return models.SyncUpdatesResponse{
+		Emotions:    make([]models.EmotionResponse, 0),
+		Tasks:       make([]models.TaskResponse, 0),
+		Subtasks:    make([]models.SubtaskResponse, 0),
+		TimeRecords: make([]models.TimeRecordResponse, 0),
+		Deleted: models.DeletedResponse{
+			Emotions:    make([]string, 0),
+			Tasks:       make([]string, 0),
+			Subtasks:    make([]string, 0),
+			TimeRecords: make([]string, 0),
+		},
+	}
+}
+
+// appendEmotionUpdate 将情绪记录加入响应，已删除的记录只返回ID
+func appendEmotionUpdate(response *models.SyncUpdatesResponse, emotion models.EmotionRecord) {
+	if emotion.Status == models.StatusDeleted {
+		response.Deleted.Emotions = append(response.Deleted.Emotions, emotion.ID)
+		return
+	}
+	response.Emotions = append(response.Emotions, toEmotionResponse(emotion))
+}
+
+// appendTaskUpdate 将任务加入响应，已删除的任务只返回ID
+func appendTaskUpdate(response *models.SyncUpdatesResponse, task models.Task) {
+	if task.Status == models.StatusDeleted {
+		response.Deleted.Tasks = append(response.Deleted.Tasks, task.ID)
+		return
+	}
+	response.Tasks = append(response.Tasks, toTaskResponse(task))
+}
+
+// appendSubtaskUpdate 将子任务加入响应，已删除的子任务只返回ID
+func appendSubtaskUpdate(response *models.SyncUpdatesResponse, subtask models.Subtask) {
+	if subtask.Status == models.StatusDeleted {
+		response.Deleted.Subtasks = append(response.Deleted.Subtasks, subtask.ID)
+		return
+	}
+	response.Subtasks = append(response.Subtasks, models.SubtaskResponse{
+		ID:           subtask.ID,
+		Title:        subtask.Title,
+		IsCompleted:  subtask.IsCompleted,
+		TaskID:       subtask.TaskID,
+		LastModified: subtask.LastModified,
+	})
+}
+
+// appendTimeRecordUpdate 将时间记录加入响应，已删除的记录只返回ID
+func appendTimeRecordUpdate(response *models.SyncUpdatesResponse, record models.TimeRecord) {
+	if record.Status == models.StatusDeleted {
+		response.Deleted.TimeRecords = append(response.Deleted.TimeRecords, record.ID)
+		return
+	}
+	response.TimeRecords = append(response.TimeRecords, models.TimeRecordResponse{
+		ID:           record.ID,
+		StartTime:    record.StartTime,
+		EndTime:      record.EndTime,
+		TaskID:       record.TaskID,
+		LastModified: record.LastModified,
+	})
+}
+
+// SyncDeletions 处理客户端上报的删除记录，写入墓碑以便同步到其他设备
+func (sc *SyncController) SyncDeletions(c *gin.Context) {
+	var deletions []models.SyncDeletionsRequest
+	if err := c.ShouldBindJSON(&deletions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 获取用户ID
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未获取到用户ID"})
+		return
+	}
+
+	// 逐条写入墓碑，每条记录使用独立事务
+	results := make([]models.SyncItemResult, 0, len(deletions))
+	for _, deletion := range deletions {
+		if _, ok := models.SyncEntityModels[deletion.Type]; !ok {
+			results = append(results, models.SyncItemResult{
+				ID:     deletion.ID,
+				Status: models.SyncItemRejected,
+				Reason: models.SyncReasonInvalidField,
+			})
+			continue
+		}
+
+		var cascaded []cascadedChange
+		result, _ := runSyncItem(c, deletion.Type, deletion.ID, func(tx *gorm.DB) (string, *models.SyncConflict, error) {
+			cascaded = nil
+			return syncDeletion(tx, uid.(string), deletion, &cascaded)
+		})
+		results = append(results, result)
+
+		// 事务提交后推送级联删除的子任务和时间记录
+		if result.Status == models.SyncItemApplied {
+			for _, change := range cascaded {
+				services.PublishSyncChange(uid.(string), change.entityType, change.id, change.seq)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "删除记录同步完成",
+		"results": results,
+	})
+}
+
+// cascadedChange 删除任务时级联删除的记录及其变更序号
+type cascadedChange struct {
+	entityType string
+	id         string
+	seq        int64
+}
+
+// syncDeletion 在事务中将单条记录标记为删除，删除任务时级联删除其子任务和时间记录，
+// 级联删除的记录追加到 cascaded 中，由调用方在事务提交后推送
+func syncDeletion(tx *gorm.DB, uid string, deletion models.SyncDeletionsRequest, cascaded *[]cascadedChange) (string, *models.SyncConflict, error) {
+	tombstone := map[string]interface{}{
+		"status":        models.StatusDeleted,
+		"last_modified": time.Now(),
+	}
+
+	// 只标记当前用户的记录
+	result := tx.Model(models.SyncEntityModels[deletion.Type]).
+		Where("id = ? AND user_id = ? AND status = ?", deletion.ID, uid, models.StatusNormal).
+		Updates(tombstone)
+	if result.Error != nil {
+		return "", nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 记录不存在或已删除
+		return models.SyncItemStale, nil, nil
+	}
+
+	if deletion.Type != models.EntityTask {
+		return models.SyncItemApplied, nil, nil
+	}
+
+	for _, childType := range []string{models.EntitySubtask, models.EntityTimeRecord} {
+		var childIDs []string
+		if err := tx.Model(models.SyncEntityModels[childType]).
+			Where("task_id = ? AND user_id = ? AND status = ?", deletion.ID, uid, models.StatusNormal).
+			Pluck("id", &childIDs).Error; err != nil {
+			return "", nil, err
+		}
+		if len(childIDs) == 0 {
+			continue
+		}
+
+		if err := tx.Model(models.SyncEntityModels[childType]).
+			Where("id IN ? AND user_id = ?", childIDs, uid).
+			Updates(tombstone).Error; err != nil {
+			return "", nil, err
+		}
+
+		// 级联删除的记录也写入变更日志
+		for _, childID := range childIDs {
+			seq, err := services.RecordChange(tx, uid, childType, childID)
+			if err != nil {
+				return "", nil, err
+			}
+			*cascaded = append(*cascaded, cascadedChange{entityType: childType, id: childID, seq: seq})
+		}
+	}
+	return models.SyncItemApplied, nil, nil
+}
+
+// toEmotionResponse 转换情绪记录为响应结构
+func toEmotionResponse(emotion models.EmotionRecord) models.EmotionResponse {
+	return models.EmotionResponse{
+		ID:               emotion.ID,
+		EmotionType:      emotion.EmotionType,
+		Intensity:        emotion.Intensity,
+		Trigger:          emotion.Trigger,
+		UnhealthyBeliefs: emotion.UnhealthyBeliefs,
+		HealthyEmotion:   emotion.HealthyEmotion,
+		CopingStrategies: emotion.CopingStrategies,
+		RecordDate:       emotion.RecordDate,
+		LastModified:     emotion.LastModified,
+	}
+}
+
+// toTaskResponse 转换任务为响应结构
+func toTaskResponse(task models.Task) models.TaskResponse {
+	return models.TaskResponse{
+		ID:           task.ID,
+		Title:        task.Title,
+		IsCompleted:  task.IsCompleted,
+		Notes:        task.Notes,
+		Deadline:     task.Deadline,
+		PlannedDate:  task.PlannedDate,
+		Difficulty:   task.Difficulty,
+		Quadrant:     task.Quadrant,
+		RepeatType:   task.RepeatType,
+		LastModified: task.LastModified,
+
+		HasAlarm:       task.AlarmDate != nil,
+		AlarmDate:      task.AlarmDate,
+		RepeatInterval: task.RepeatInterval,
+		Priority:       task.Priority,
+	}
+}
+
+// 推送连接心跳间隔，避免代理因空闲断开连接
+const syncStreamHeartbeat = 25 * time.Second
+
+// StreamChanges 通过 SSE 实时推送当前用户的同步变更通知
+func (sc *SyncController) StreamChanges(c *gin.Context) {
+	uid := c.GetString("uid")
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未获取到用户ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	pubsub, err := services.SubscribeSyncChanges(ctx, uid)
+	if err != nil {
+		config.Logger.Errorw("订阅同步变更失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "订阅同步变更失败"})
+		return
+	}
+	defer pubsub.Close()
+
+	// 设置流式响应头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(syncStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: change\ndata: %s\n\n", msg.Payload); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-ctx.Done():
+			return
+		case <-services.SyncStreamsClosing():
+			return
+		}
+	}
+}
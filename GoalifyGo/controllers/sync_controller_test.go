@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncDeletionsPublishesCascadedChanges(t *testing.T) {
+	setupOwnershipFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pubsub, err := services.SubscribeSyncChanges(ctx, victimUID)
+	if err != nil {
+		t.Fatalf("订阅同步变更失败: %v", err)
+	}
+	defer pubsub.Close()
+
+	r := newTestRouter()
+	r.POST("/sync/deletions", (&SyncController{}).SyncDeletions)
+	w := performJSON(t, r, http.MethodPost, "/sync/deletions", victimUID,
+		[]models.SyncDeletionsRequest{{Type: models.EntityTask, ID: "T1"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 任务及其级联删除的子任务和时间记录都应推送通知
+	want := map[string]bool{
+		models.EntityTask + "/T1":       true,
+		models.EntitySubtask + "/S1":    true,
+		models.EntityTimeRecord + "/R1": true,
+	}
+	messages := pubsub.Channel()
+	timeout := time.After(5 * time.Second)
+	for len(want) > 0 {
+		select {
+		case msg := <-messages:
+			var event models.SyncChangeEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				t.Fatalf("解析通知失败: %v", err)
+			}
+			key := event.EntityType + "/" + event.EntityID
+			if !want[key] {
+				t.Fatalf("意外的通知 %s", key)
+			}
+			delete(want, key)
+		case <-timeout:
+			t.Fatalf("缺少通知: %v", want)
+		}
+	}
+}
+
+func TestGetUpdatesFullResyncIgnoresIncrementalCursor(t *testing.T) {
+	setupOwnershipFixture(t)
+
+	r := newTestRouter()
+	r.GET("/sync/updates", (&SyncController{}).GetUpdates)
+
+	// 客户端带着增量游标要求全量同步时，从头返回全部数据
+	query := "?full=true&cursor=" + services.EncodeSyncCursor(5)
+	w := performJSON(t, r, http.MethodGet, "/sync/updates"+query, victimUID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp models.SyncUpdatesResponse
+	decodeJSON(t, w, &resp)
+	if len(resp.Emotions) != 1 || len(resp.Tasks) != 1 || len(resp.Subtasks) != 1 || len(resp.TimeRecords) != 1 {
+		t.Fatalf("全量同步结果 = %+v, want 全部数据", resp)
+	}
+	if resp.Cursor == "" || resp.Cursor == services.EncodeSyncCursor(5) {
+		t.Errorf("游标 = %q, want 新的同步游标", resp.Cursor)
+	}
+}
+
+func TestGetUpdatesRequiresFullResyncAfterRetention(t *testing.T) {
+	setupOwnershipFixture(t)
+	services.ConfigureTombstoneRetention(90)
+
+	r := newTestRouter()
+	r.GET("/sync/updates", (&SyncController{}).GetUpdates)
+
+	cases := []struct {
+		name         string
+		lastSyncDate time.Time
+		want         int
+	}{
+		{"within retention", time.Now().Add(-24 * time.Hour), http.StatusOK},
+		{"older than retention", time.Now().Add(-91 * 24 * time.Hour), http.StatusGone},
+		// 从未同步过的设备没有需要清理的本地数据
+		{"never synced", time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := "?lastSyncDate=" + tc.lastSyncDate.UTC().Format(time.RFC3339)
+			w := performJSON(t, r, http.MethodGet, "/sync/updates"+query, victimUID, nil)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tc.want, w.Body.String())
+			}
+			if tc.want == http.StatusGone {
+				var resp struct {
+					FullResyncRequired bool `json:"fullResyncRequired"`
+				}
+				decodeJSON(t, w, &resp)
+				if !resp.FullResyncRequired {
+					t.Errorf("body = %s, want fullResyncRequired", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestGetUpdatesRequiresFullResyncBehindPrunedCursor(t *testing.T) {
+	db := setupOwnershipFixture(t)
+	if err := db.Model(&models.User{}).Where("id = ?", victimUID).
+		Updates(map[string]interface{}{"sync_seq": 10, "sync_pruned_seq": 5}).Error; err != nil {
+		t.Fatalf("设置同步序号失败: %v", err)
+	}
+
+	r := newTestRouter()
+	r.GET("/sync/updates", (&SyncController{}).GetUpdates)
+
+	// 游标之后有已被清理的变更
+	w := performJSON(t, r, http.MethodGet, "/sync/updates?cursor="+services.EncodeSyncCursor(4), victimUID, nil)
+	if w.Code != http.StatusGone {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, http.StatusGone, w.Body.String())
+	}
+
+	// 已经收到过被清理的变更
+	w = performJSON(t, r, http.MethodGet, "/sync/updates?cursor="+services.EncodeSyncCursor(5), victimUID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestSyncReportsFieldConflicts(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fieldTimes := func(fields []string, overrides map[string]time.Time) models.FieldTimestamps {
+		fm := services.NewFieldTimestamps(fields, func(string) time.Time { return base })
+		for field, modified := range overrides {
+			fm[field] = modified
+		}
+		return fm
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		fixture interface{}
+		// 客户端修改了两个字段，第一个字段的修改早于服务端，第二个字段晚于服务端
+		body interface{}
+		// conflictField 修改时间早于服务端、应作为冲突返回的字段
+		conflictField string
+		// check 检查冲突中返回的服务端版本
+		check func(t *testing.T, server json.RawMessage)
+	}{
+		{
+			name: "task",
+			path: "/sync/tasks",
+			fixture: &models.Task{
+				ID: "T2", UserID: victimUID, Title: "服务端标题", Notes: "服务端备注", LastModified: base,
+				FieldModified: fieldTimes(services.TaskMergeFields, map[string]time.Time{"title": base.Add(2 * time.Hour)}),
+			},
+			body: []models.SyncTasksRequest{{
+				ID: "T2", Title: "客户端标题", Notes: "客户端备注", LastModified: base.Add(3 * time.Hour),
+				FieldModified: map[string]time.Time{"title": base.Add(time.Hour), "notes": base.Add(3 * time.Hour)},
+			}},
+			conflictField: "title",
+			check: func(t *testing.T, server json.RawMessage) {
+				var task models.TaskResponse
+				if err := json.Unmarshal(server, &task); err != nil {
+					t.Fatalf("解析服务端版本失败: %v", err)
+				}
+				if task.ID != "T2" || task.Title != "服务端标题" || task.Notes != "客户端备注" {
+					t.Errorf("服务端版本 = %+v, want 服务端标题和客户端备注", task)
+				}
+			},
+		},
+		{
+			name: "emotion",
+			path: "/sync/emotions",
+			fixture: &models.EmotionRecord{
+				ID: "E2", UserID: victimUID, EmotionType: "焦虑", Intensity: 1, Trigger: "服务端诱因", CopingStrategies: "服务端策略",
+				RecordDate: base, LastModified: base,
+				FieldModified: fieldTimes(services.EmotionMergeFields, map[string]time.Time{"trigger": base.Add(2 * time.Hour)}),
+			},
+			body: []models.SyncEmotionsRequest{{
+				ID: "E2", EmotionType: "焦虑", Intensity: 1, Trigger: "客户端诱因", CopingStrategies: "客户端策略",
+				RecordDate: base, LastModified: base.Add(3 * time.Hour),
+				FieldModified: map[string]time.Time{"trigger": base.Add(time.Hour), "copingStrategies": base.Add(3 * time.Hour)},
+			}},
+			conflictField: "trigger",
+			check: func(t *testing.T, server json.RawMessage) {
+				var emotion models.EmotionResponse
+				if err := json.Unmarshal(server, &emotion); err != nil {
+					t.Fatalf("解析服务端版本失败: %v", err)
+				}
+				if emotion.ID != "E2" || emotion.Trigger != "服务端诱因" || emotion.CopingStrategies != "客户端策略" {
+					t.Errorf("服务端版本 = %+v, want 服务端诱因和客户端策略", emotion)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupOwnershipFixture(t)
+			if err := db.Create(tc.fixture).Error; err != nil {
+				t.Fatalf("创建测试数据失败: %v", err)
+			}
+
+			r := newTestRouter()
+			r.POST("/sync/emotions", (&EmotionController{}).SyncEmotions)
+			r.POST("/sync/tasks", (&TaskController{}).SyncTasks)
+			w := performJSON(t, r, http.MethodPost, tc.path, victimUID, tc.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			var resp struct {
+				Results   []models.SyncItemResult `json:"results"`
+				Conflicts []struct {
+					ID     string          `json:"id"`
+					Fields []string        `json:"fields"`
+					Server json.RawMessage `json:"server"`
+				} `json:"conflicts"`
+			}
+			decodeJSON(t, w, &resp)
+			// 未冲突的字段仍然写入
+			if len(resp.Results) != 1 || resp.Results[0].Status != models.SyncItemApplied {
+				t.Fatalf("results = %+v, want applied", resp.Results)
+			}
+			if len(resp.Conflicts) != 1 || strings.Join(resp.Conflicts[0].Fields, ",") != tc.conflictField {
+				t.Fatalf("conflicts = %+v, want [%s]", resp.Conflicts, tc.conflictField)
+			}
+			tc.check(t, resp.Conflicts[0].Server)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// syncRejectedError 单条同步记录被拒绝的错误，reason 为返回给客户端的原因代码
+type syncRejectedError struct {
+	reason  string
+	message string
+}
+
+func (e *syncRejectedError) Error() string {
+	return e.message
+}
+
+func rejectSyncItem(reason string, message string) error {
+	return &syncRejectedError{reason: reason, message: message}
+}
+
+// syncItemFunc 在事务中写入单条记录，返回处理状态（applied/stale）以及可选的冲突信息
+type syncItemFunc func(tx *gorm.DB) (string, *models.SyncConflict, error)
+
+// runSyncItem 在独立事务中处理批量同步中的单条记录，单条失败不影响同批次的其他记录
+func runSyncItem(c *gin.Context, entityType string, id string, fn syncItemFunc) (models.SyncItemResult, *models.SyncConflict) {
+	uid := c.GetString("uid")
+	result := models.SyncItemResult{ID: id}
+	if id == "" {
+		result.Status = models.SyncItemRejected
+		result.Reason = models.SyncReasonInvalidID
+		return result, nil
+	}
+
+	var conflict *models.SyncConflict
+	var seq int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 记录ID已被其他用户占用时拒绝写入，防止通过伪造ID接管他人数据
+		foreign, err := services.IsOwnedByOther(tx, models.SyncEntityModels[entityType], id, uid)
+		if err != nil {
+			return err
+		}
+		if foreign {
+			return services.ErrNotOwner
+		}
+
+		status, itemConflict, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		result.Status = status
+		conflict = itemConflict
+
+		// 写入变更日志
+		if status == models.SyncItemApplied {
+			if seq, err = services.RecordChange(tx, uid, entityType, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		// 事务提交后再推送变更通知
+		if result.Status == models.SyncItemApplied {
+			services.PublishSyncChange(uid, entityType, id, seq)
+		}
+		return result, conflict
+	}
+
+	result.Status = models.SyncItemRejected
+	var rejected *syncRejectedError
+	if errors.Is(err, services.ErrNotOwner) {
+		result.Reason = models.SyncReasonForbidden
+		config.LogSecurityEvent("sync_foreign_id",
+			"uid", uid,
+			"clientIP", c.ClientIP(),
+			"path", c.FullPath(),
+			"type", entityType,
+			"id", id,
+		)
+	} else if errors.As(err, &rejected) {
+		result.Reason = rejected.reason
+		config.Logger.Warnw("同步记录被拒绝",
+			"uid", uid,
+			"type", entityType,
+			"id", id,
+			"reason", rejected.reason,
+			"message", rejected.message,
+		)
+	} else {
+		result.Reason = models.SyncReasonInternalError
+		config.Logger.Errorw("同步记录写入失败", "error", err, "uid", uid, "type", entityType, "id", id)
+	}
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	victimUID   = "victim"
+	attackerUID = "attacker"
+)
+
+// setupOwnershipFixture 为 victim 创建每种同步实体各一条记录
+func setupOwnershipFixture(t *testing.T) *gorm.DB {
+	t.Helper()
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.EmotionRecord{}, &models.Task{},
+		&models.Subtask{}, &models.TimeRecord{}, &models.SyncChange{})
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fixtures := []interface{}{
+		&models.User{ID: victimUID},
+		&models.User{ID: attackerUID},
+		&models.EmotionRecord{ID: "E1", UserID: victimUID, EmotionType: "焦虑", Intensity: 1, LastModified: modified},
+		&models.Task{ID: "T1", UserID: victimUID, Title: "victim task", LastModified: modified},
+		&models.Subtask{ID: "S1", UserID: victimUID, TaskID: "T1", Title: "victim subtask", LastModified: modified},
+		&models.TimeRecord{ID: "R1", UserID: victimUID, TaskID: "T1", StartTime: modified, EndTime: modified.Add(time.Hour), LastModified: modified},
+		&models.Task{ID: "A1", UserID: attackerUID, Title: "attacker task", LastModified: modified},
+	}
+	for _, fixture := range fixtures {
+		if err := db.Create(fixture).Error; err != nil {
+			t.Fatalf("创建测试数据失败: %v", err)
+		}
+	}
+	return db
+}
+
+func TestSyncUpsertRejectsForeignID(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+
+	cases := []struct {
+		name  string
+		path  string
+		body  interface{}
+		model interface{}
+		id    string
+		// snapshot 读取 victim 的记录用于比较是否被修改
+		snapshot func(db *gorm.DB) (string, string)
+	}{
+		{
+			name: "emotion",
+			path: "/sync/emotions",
+			body: []models.SyncEmotionsRequest{{ID: "E1", EmotionType: "愤怒", Intensity: 3, LastModified: later}},
+			id:   "E1",
+			snapshot: func(db *gorm.DB) (string, string) {
+				var e models.EmotionRecord
+				db.First(&e, "id = ?", "E1")
+				return e.UserID, e.EmotionType
+			},
+		},
+		{
+			name: "task",
+			path: "/sync/tasks",
+			body: []models.SyncTasksRequest{{ID: "T1", Title: "hijacked", LastModified: later}},
+			id:   "T1",
+			snapshot: func(db *gorm.DB) (string, string) {
+				var task models.Task
+				db.First(&task, "id = ?", "T1")
+				return task.UserID, task.Title
+			},
+		},
+		{
+			name: "subtask",
+			path: "/sync/subtasks",
+			body: []models.SyncSubtasksRequest{{ID: "S1", Title: "hijacked", TaskID: "A1", LastModified: later}},
+			id:   "S1",
+			snapshot: func(db *gorm.DB) (string, string) {
+				var s models.Subtask
+				db.First(&s, "id = ?", "S1")
+				return s.UserID, s.Title
+			},
+		},
+		{
+			name: "time record",
+			path: "/sync/time-records",
+			body: []models.SyncTimeRecordsRequest{{ID: "R1", TaskID: "A1", StartTime: later, EndTime: later.Add(time.Hour), LastModified: later}},
+			id:   "R1",
+			snapshot: func(db *gorm.DB) (string, string) {
+				var r models.TimeRecord
+				db.First(&r, "id = ?", "R1")
+				return r.UserID, r.TaskID
+			},
+		},
+		{
+			name: "deletion",
+			path: "/sync/deletions",
+			body: []models.SyncDeletionsRequest{{Type: models.EntityTask, ID: "T1"}},
+			id:   "T1",
+			snapshot: func(db *gorm.DB) (string, string) {
+				var task models.Task
+				db.First(&task, "id = ?", "T1")
+				return task.UserID, string(rune('0' + task.Status))
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupOwnershipFixture(t)
+			logs := testutil.ObserveLogs(t)
+
+			r := newTestRouter()
+			r.POST("/sync/emotions", (&EmotionController{}).SyncEmotions)
+			r.POST("/sync/tasks", (&TaskController{}).SyncTasks)
+			r.POST("/sync/subtasks", (&SubtaskController{}).SyncSubtasks)
+			r.POST("/sync/time-records", (&TimeRecordController{}).SyncTimeRecords)
+			r.POST("/sync/deletions", (&SyncController{}).SyncDeletions)
+
+			ownerBefore, valueBefore := tc.snapshot(db)
+
+			w := performJSON(t, r, http.MethodPost, tc.path, attackerUID, tc.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Results []models.SyncItemResult `json:"results"`
+			}
+			decodeJSON(t, w, &resp)
+			if len(resp.Results) != 1 {
+				t.Fatalf("results = %+v", resp.Results)
+			}
+			if got := resp.Results[0]; got.Status != models.SyncItemRejected || got.Reason != models.SyncReasonForbidden {
+				t.Fatalf("result = %+v, want rejected/forbidden", got)
+			}
+
+			ownerAfter, valueAfter := tc.snapshot(db)
+			if ownerAfter != victimUID || ownerAfter != ownerBefore || valueAfter != valueBefore {
+				t.Fatalf("victim row changed: owner %q -> %q, value %q -> %q", ownerBefore, ownerAfter, valueBefore, valueAfter)
+			}
+
+			var changes int64
+			db.Model(&models.SyncChange{}).Where("entity_id = ?", tc.id).Count(&changes)
+			if changes != 0 {
+				t.Fatalf("foreign upsert wrote %d change log entries", changes)
+			}
+
+			events := testutil.SecurityEvents(logs, "sync_foreign_id")
+			if len(events) != 1 {
+				t.Fatalf("sync_foreign_id events = %d, want 1", len(events))
+			}
+			if fields := events[0].ContextMap(); fields["uid"] != attackerUID || fields["id"] != tc.id {
+				t.Fatalf("security event fields = %v", fields)
+			}
+		})
+	}
+}
+
+func TestGetUpdatesDoesNotReturnForeignRows(t *testing.T) {
+	setupOwnershipFixture(t)
+
+	r := newTestRouter()
+	r.GET("/sync/updates", (&SyncController{}).GetUpdates)
+
+	for _, query := range []string{"?full=true", "?cursor=", "?lastSyncDate=2000-01-01T00:00:00Z"} {
+		w := performJSON(t, r, http.MethodGet, "/sync/updates"+query, attackerUID, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", query, w.Code, w.Body.String())
+		}
+		var resp models.SyncUpdatesResponse
+		decodeJSON(t, w, &resp)
+		if len(resp.Emotions) != 0 || len(resp.Subtasks) != 0 || len(resp.TimeRecords) != 0 {
+			t.Fatalf("%s: attacker received victim rows: %+v", query, resp)
+		}
+		for _, task := range resp.Tasks {
+			if task.ID != "A1" {
+				t.Fatalf("%s: attacker received foreign task %s", query, task.ID)
+			}
+		}
+	}
+}
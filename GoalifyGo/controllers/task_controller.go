@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TaskController struct{}
+
+// SyncTasks 处理任务同步
+func (tc *TaskController) SyncTasks(c *gin.Context) {
+	var tasks []models.SyncTasksRequest
+	if err := c.ShouldBindJSON(&tasks); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 获取用户ID
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未获取到用户ID"})
+		return
+	}
+
+	// 逐条更新或创建任务，每条任务使用独立事务
+	results := make([]models.SyncItemResult, 0, len(tasks))
+	conflicts := make([]models.SyncConflict, 0)
+	for _, taskReq := range tasks {
+		taskReq.ConvertToUTC()
+
+		result, conflict := runSyncItem(c, models.EntityTask, taskReq.ID, func(tx *gorm.DB) (string, *models.SyncConflict, error) {
+			return syncTask(tx, uid.(string), &taskReq)
+		})
+		results = append(results, result)
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "任务同步完成",
+		"results":   results,
+		"conflicts": conflicts,
+	})
+}
+
+// syncTask 在事务中写入单条任务
+func syncTask(tx *gorm.DB, uid string, taskReq *models.SyncTasksRequest) (string, *models.SyncConflict, error) {
+	if utf8.RuneCountInString(taskReq.Title) > 100 {
+		return "", nil, rejectSyncItem(models.SyncReasonInvalidField, "任务标题过长")
+	}
+
+	// 检查当前用户是否已有该任务
+	var task models.Task
+	err := tx.Where("id = ? AND user_id = ?", taskReq.ID, uid).First(&task).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 如果不存在，创建新任务
+		task = models.Task{
+			ID:             taskReq.ID,
+			Title:          taskReq.Title,
+			IsCompleted:    taskReq.IsCompleted,
+			Notes:          taskReq.Notes,
+			Deadline:       taskReq.Deadline,
+			PlannedDate:    taskReq.PlannedDate,
+			Difficulty:     taskReq.Difficulty,
+			Quadrant:       taskReq.Quadrant,
+			RepeatType:     taskReq.RepeatType,
+			RepeatInterval: taskReq.Interval(),
+			AlarmDate:      taskReq.Alarm(),
+			Priority:       taskReq.PriorityLevel(),
+			FieldModified:  services.NewFieldTimestamps(services.TaskMergeFields, taskReq.FieldTime),
+			LastModified:   time.Now(),
+			ClientModified: &taskReq.LastModified,
+			UserID:         uid,
+		}
+		if err := tx.Create(&task).Error; err != nil {
+			return "", nil, err
+		}
+		return models.SyncItemApplied, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 如果存在，按字段修改时间合并；专注时间由服务端累计，不参与合并
+	result := services.MergeTask(&task, taskReq)
+	status := models.SyncItemStale
+	if result.Changed {
+		task.LastModified = time.Now()
+		if err := services.SaveOwned(tx, uid, &task); err != nil {
+			return "", nil, err
+		}
+		status = models.SyncItemApplied
+	}
+
+	var conflict *models.SyncConflict
+	if len(result.Conflicts) > 0 {
+		conflict = &models.SyncConflict{
+			ID:     task.ID,
+			Fields: result.Conflicts,
+			Server: toTaskResponse(task),
+		}
+	}
+	return status, conflict, nil
+}
+
+// requireOwnedTask 校验子任务和时间记录关联的任务存在、未删除且属于当前用户
+func requireOwnedTask(tx *gorm.DB, uid string, taskID string) error {
+	var count int64
+	if err := tx.Model(&models.Task{}).
+		Where("id = ? AND user_id = ? AND status = ?", taskID, uid, models.StatusNormal).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return rejectSyncItem(models.SyncReasonTaskNotFound, "关联的任务不存在")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TimeRecordController struct{}
+
+// SyncTimeRecords 处理时间记录同步
+func (trc *TimeRecordController) SyncTimeRecords(c *gin.Context) {
+	var records []models.SyncTimeRecordsRequest
+	if err := c.ShouldBindJSON(&records); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 获取用户ID
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未获取到用户ID"})
+		return
+	}
+
+	// 逐条更新或创建时间记录，每条记录使用独立事务
+	results := make([]models.SyncItemResult, 0, len(records))
+	for _, recordReq := range records {
+		recordReq.ConvertToUTC()
+
+		result, _ := runSyncItem(c, models.EntityTimeRecord, recordReq.ID, func(tx *gorm.DB) (string, *models.SyncConflict, error) {
+			return syncTimeRecord(tx, uid.(string), &recordReq)
+		})
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "时间记录同步完成",
+		"results": results,
+	})
+}
+
+// syncTimeRecord 在事务中写入单条时间记录
+func syncTimeRecord(tx *gorm.DB, uid string, recordReq *models.SyncTimeRecordsRequest) (string, *models.SyncConflict, error) {
+	if recordReq.EndTime.Before(recordReq.StartTime) {
+		return "", nil, rejectSyncItem(models.SyncReasonInvalidField, "结束时间早于开始时间")
+	}
+
+	// 关联任务不存在或属于其他用户，拒绝写入，避免产生孤儿数据
+	if err := requireOwnedTask(tx, uid, recordReq.TaskID); err != nil {
+		return "", nil, err
+	}
+
+	record := models.TimeRecord{
+		ID:             recordReq.ID,
+		TaskID:         recordReq.TaskID,
+		StartTime:      recordReq.StartTime,
+		EndTime:        recordReq.EndTime,
+		LastModified:   time.Now(),
+		ClientModified: &recordReq.LastModified,
+		UserID:         uid,
+	}
+
+	// 检查当前用户是否已有该时间记录
+	var existingRecord models.TimeRecord
+	err := tx.Where("id = ? AND user_id = ?", record.ID, uid).First(&existingRecord).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 如果不存在，创建新时间记录
+		if err := tx.Create(&record).Error; err != nil {
+			return "", nil, err
+		}
+		return models.SyncItemApplied, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 已删除的时间记录不会被普通写入恢复
+	if existingRecord.Status == models.StatusDeleted {
+		return models.SyncItemStale, nil, nil
+	}
+
+	// 如果存在，与上次客户端提交的修改时间比较；没有记录客户端时间的旧数据直接采用客户端版本
+	if existingRecord.ClientModified != nil && !recordReq.LastModified.After(*existingRecord.ClientModified) {
+		return models.SyncItemStale, nil, nil
+	}
+	if err := services.SaveOwned(tx, uid, &record); err != nil {
+		return "", nil, err
+	}
+	return models.SyncItemApplied, nil, nil
+}
@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"GoalifyGo/config"
 	"GoalifyGo/models"
+	"GoalifyGo/services"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -30,14 +33,17 @@ func (uc *UserController) AddEnergy(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("id = ?", uid).First(&user).Error; err != nil {
-		config.Logger.Errorw("获取用户信息失败", "error", err, "uid", uid)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
-		return
-	}
-
-	if err := config.DB.Model(&user).Update("energy", user.Energy+amount).Error; err != nil {
+	var newEnergy int
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		newEnergy, err = services.ChangeEnergy(tx, uid, amount, models.EnergyReasonAdminGrant, "")
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
 		config.Logger.Errorw("增加能量值失败", "error", err, "uid", uid)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "增加能量值失败"})
 		return
@@ -45,7 +51,7 @@ func (uc *UserController) AddEnergy(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "能量值增加成功",
-		"newEnergy": user.Energy + amount,
+		"newEnergy": newEnergy,
 	})
 }
 
@@ -59,8 +65,70 @@ func (uc *UserController) GetEnergy(c *gin.Context) {
 		return
 	}
 
+	entitlement, err := services.GetEntitlement(uid)
+	if err != nil {
+		config.Logger.Errorw("获取订阅权益失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅权益失败"})
+		return
+	}
+
+	response := gin.H{
+		"energy":       user.Energy,
+		"subscription": entitlement,
+	}
+	// 当前等级开启每日恢复时返回下一次恢复的时间及规则
+	if allowance := services.CurrentEnergyRegenPolicy().Allowance(entitlement.Tier); allowance.Enabled() {
+		response["nextRefillAt"] = services.NextEnergyRefill(time.Now(), services.UserLocation(user))
+		response["dailyGrant"] = allowance.DailyGrant
+		response["dailyCap"] = allowance.Cap
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// 能量流水默认及最大分页大小
+const (
+	defaultEnergyHistoryPageSize = 50
+	maxEnergyHistoryPageSize     = 200
+)
+
+// GetEnergyHistory 按时间倒序分页返回能量流水，before 为上一页最后一条流水的ID
+func (uc *UserController) GetEnergyHistory(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	pageSize := defaultEnergyHistoryPageSize
+	if pageSizeStr := c.Query("pageSize"); pageSizeStr != "" {
+		size, err := strconv.Atoi(pageSizeStr)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		if size > maxEnergyHistoryPageSize {
+			size = maxEnergyHistoryPageSize
+		}
+		pageSize = size
+	}
+
+	var beforeID uint64
+	if before := c.Query("before"); before != "" {
+		id, err := strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页参数"})
+			return
+		}
+		beforeID = id
+	}
+
+	entries, err := services.ListEnergyHistory(uid, beforeID, pageSize)
+	if err != nil {
+		config.Logger.Errorw("获取能量流水失败", "error", err, "uid", uid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取能量流水失败"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"energy": user.Energy,
+		"data":    entries,
+		"hasMore": len(entries) == pageSize,
 	})
 }
 
@@ -36,20 +36,52 @@ func main() {
 		return
 	}
 
+	// 设置每日能量恢复策略
+	if err := services.ConfigureEnergyRegen(conf); err != nil {
+		log.Fatalf("无法设置能量恢复策略: %v", err)
+		return
+	}
+
+	// 设置各订阅等级的能量消耗
+	if err := services.ConfigureEnergyCosts(conf.EnergyCostRules); err != nil {
+		log.Fatalf("无法设置能量消耗规则: %v", err)
+		return
+	}
+
+	// 加载 App Store 内购根证书和商品配置
+	if err := services.ConfigureAppStore(conf); err != nil {
+		log.Fatalf("无法设置 App Store 内购: %v", err)
+		return
+	}
+
 	// 初始化Redis
 	if err := config.InitRedis(conf); err != nil {
 		log.Fatalf("无法初始化Redis: %v", err)
 		return
 	}
 
-	// 初始化Deepseek客户端
-	deepseekClient, err := services.NewDeepseekClient(conf.DeepseekAPIKey, conf.DeepseekAPIEndpoint)
+	// 初始化大模型后端
+	llmProvider, err := services.NewLLMProvider(conf)
 	if err != nil {
-		log.Fatalf("无法初始化Deepseek客户端: %v", err)
+		log.Fatalf("无法初始化大模型后端: %v", err)
+	}
+	modelProfiles, err := services.ParseModelProfiles(conf.LLMProfiles)
+	if err != nil {
+		log.Fatalf("无法解析模型配置: %v", err)
 	}
 
 	// 创建ChatService
-	chatService := services.NewChatService(deepseekClient)
+	chatService := services.NewChatService(llmProvider, modelProfiles)
+	chatController := controllers.NewChatController(chatService)
+
+	// 启动删除墓碑清理任务
+	services.ConfigureTombstoneRetention(conf.TombstoneRetentionDays)
+	tombstoneCollector := services.NewTombstoneCollector()
+	tombstoneCollector.Start()
+
+	// 启动超时能量预扣退还任务
+	energySweeper := services.NewEnergyReservationSweeper()
+	energySweeper.Start()
 
 	// 设置Gin模式
 	if conf.Environment == "production" {
@@ -59,11 +91,17 @@ func main() {
 	// 创建Gin引擎
 	r := gin.Default()
 
+	// 只从可信反向代理转发的请求头中读取客户端 IP，未配置时使用连接的对端地址
+	if err := r.SetTrustedProxies(conf.GetTrustedProxies()); err != nil {
+		log.Fatalf("无效的可信代理配置: %v", err)
+	}
+
 	// 设置中间件
 	middleware.SetupMiddleware(r)
+	middleware.ConfigureInternalAuth(conf)
 
 	// 注册路由
-	routes.RegisterRoutes(r, deepseekClient)
+	routes.RegisterRoutes(r, chatController)
 
 	// 创建HTTP服务器
 	srv := &http.Server{
@@ -71,6 +109,11 @@ func main() {
 		Handler: r,
 	}
 
+	// 关闭时通知同步推送长连接结束，否则 Shutdown 会一直等待这些连接
+	srv.RegisterOnShutdown(services.CloseSyncStreams)
+	// 关闭时取消进行中的聊天和复盘生成，退还预扣的能量
+	srv.RegisterOnShutdown(chatController.CancelStreams)
+
 	// 在goroutine中启动服务器
 	go func() {
 		log.Printf("启动服务器，监听端口: %s", conf.ServerPort)
@@ -98,8 +141,10 @@ func main() {
 
 	// 在优雅关闭部分
 	log.Println("正在等待所有后台任务完成...")
-	chatController := controllers.NewChatController(chatService)
-	chatController.Wait()
+	// 使用路由中的同一个 chatController，才能等到其后台任务
+	chatController.Shutdown(ctx)
 	chatService.Wait()
+	tombstoneCollector.Stop()
+	energySweeper.Stop()
 	log.Println("所有后台任务已完成")
 }
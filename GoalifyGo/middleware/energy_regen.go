@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimezoneHeader 客户端的 IANA 时区，首次使用时保存为用户时区，之后限制修改频率
+const TimezoneHeader = "X-Timezone"
+
+// EnergyRegenMiddleware 在用户本地日期的首次请求时恢复每日免费能量，需在认证之后使用
+func EnergyRegenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetString("uid")
+		if uid != "" {
+			granted, err := services.RegenerateEnergy(uid, c.GetHeader(TimezoneHeader))
+			if err != nil {
+				// 恢复失败不影响本次请求，下一次请求会重试
+				config.Logger.Errorw("恢复每日能量失败", "error", err, "uid", uid)
+			} else if granted > 0 {
+				config.Logger.Infow("恢复每日能量", "uid", uid, "amount", granted)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"GoalifyGo/config"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyHeader 客户端重试时携带的幂等键请求头
+	IdempotencyHeader = "Idempotency-Key"
+
+	// 首次响应的保留时长
+	idempotencyTTL = 24 * time.Hour
+	// 处理中标记的保留时长，请求处理期间定期续期；请求异常退出后最多占用该时长
+	idempotencyLockTTL = 2 * time.Minute
+	// 处理中标记的续期间隔
+	idempotencyLockRefresh = idempotencyLockTTL / 3
+	// 幂等键最大长度
+	maxIdempotencyKeyLength = 128
+	// 计算摘要时读取的请求体上限，批量同步请求也远小于该值
+	maxIdempotentBodySize = 10 << 20
+	// idempotencyDiscardKey 处理函数标记本次响应不缓存
+	idempotencyDiscardKey = "idempotencyDiscard"
+)
+
+// idempotentResponse 缓存的首次响应；Status 为 0 表示首次请求仍在处理中
+type idempotentResponse struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"` // 请求体摘要，同一幂等键只能用于相同的请求
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// idempotencyWriter 在写出响应的同时记录响应内容
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// DiscardIdempotentResponse 标记本次响应不缓存，释放幂等键以便客户端重试。
+// 用于状态码无法反映失败的响应，如以 error 事件结束的 SSE 流，以及修正后重试可能成功的 400 响应。
+func DiscardIdempotentResponse(c *gin.Context) {
+	c.Set(idempotencyDiscardKey, true)
+}
+
+// IdempotencyMiddleware 幂等中间件，需在认证中间件之后使用。
+// 携带 Idempotency-Key 的 POST 请求只会执行一次：重试时原样返回首次响应，首次请求仍在处理时返回 409，
+// 同一幂等键用于不同的请求时返回 422。
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的幂等键"})
+			return
+		}
+
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "请求体过大"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+			return
+		}
+
+		ctx := context.Background()
+		redisKey := fmt.Sprintf("idempotency:%s:%s", c.GetString("uid"), key)
+
+		// 抢占幂等键，失败说明该键已被使用
+		marker, _ := json.Marshal(idempotentResponse{Path: c.FullPath(), Fingerprint: fingerprint})
+		acquired, err := config.RedisClient.SetNX(ctx, redisKey, marker, idempotencyLockTTL).Result()
+		if err != nil {
+			// Redis 不可用时不阻塞业务请求
+			config.Logger.Errorw("幂等键检查失败", "error", err, "key", redisKey)
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			replayIdempotentResponse(c, redisKey, fingerprint)
+			return
+		}
+
+		// 长时间的流式请求处理期间持续续期处理中标记，避免标记过期后重复请求被执行
+		stopRefresh := refreshIdempotencyLock(redisKey)
+		completed := false
+		defer func() {
+			stopRefresh()
+			// 处理函数 panic 时释放幂等键，由外层的 Recovery 返回 500，客户端可以重试
+			if !completed {
+				if err := config.RedisClient.Del(ctx, redisKey).Err(); err != nil {
+					config.Logger.Errorw("释放幂等键失败", "error", err, "key", redisKey)
+				}
+			}
+		}()
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		completed = true
+		// 先停止续期再写入首次响应，避免续期缩短响应的保留时长
+		stopRefresh()
+
+		// 只缓存成功和结果确定的响应，其余响应及处理函数标记为失败的响应释放幂等键以便客户端重试
+		status := writer.Status()
+		if !isReplayableStatus(status) || c.GetBool(idempotencyDiscardKey) {
+			if err := config.RedisClient.Del(ctx, redisKey).Err(); err != nil {
+				config.Logger.Errorw("释放幂等键失败", "error", err, "key", redisKey)
+			}
+			return
+		}
+
+		payload, err := json.Marshal(idempotentResponse{
+			Path:        c.FullPath(),
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		})
+		if err != nil {
+			config.Logger.Errorw("序列化幂等响应失败", "error", err, "key", redisKey)
+			return
+		}
+		if err := config.RedisClient.Set(ctx, redisKey, payload, idempotencyTTL).Err(); err != nil {
+			config.Logger.Errorw("保存幂等响应失败", "error", err, "key", redisKey)
+		}
+	}
+}
+
+// isReplayableStatus 判断响应是否作为幂等响应缓存：2xx 以及重试同一请求必然得到相同结果的客户端错误。
+// 服务端错误和能量不足（403）、资源不存在（404）、冲突（409）、限流（429）等状态变化后重试可能成功的响应不缓存
+func isReplayableStatus(status int) bool {
+	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		return true
+	}
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// requestFingerprint 计算请求体的 SHA-256 摘要，并恢复请求体供后续处理函数读取。
+// 请求体超过 maxIdempotentBodySize 时返回 *http.MaxBytesError
+func requestFingerprint(c *gin.Context) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// refreshIdempotencyLock 定期续期处理中标记，返回停止续期的函数，该函数可以重复调用
+func refreshIdempotencyLock(redisKey string) func() {
+	var once sync.Once
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := config.RedisClient.Expire(context.Background(), redisKey, idempotencyLockTTL).Err(); err != nil {
+					config.Logger.Errorw("续期幂等键失败", "error", err, "key", redisKey)
+				}
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// replayIdempotentResponse 返回已缓存的首次响应
+func replayIdempotentResponse(c *gin.Context, redisKey string, fingerprint string) {
+	value, err := config.RedisClient.Get(context.Background(), redisKey).Result()
+	if err != nil {
+		config.Logger.Errorw("读取幂等响应失败", "error", err, "key", redisKey)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "请求正在处理中，请稍后重试"})
+		return
+	}
+
+	var cached idempotentResponse
+	if err := json.Unmarshal([]byte(value), &cached); err != nil {
+		config.Logger.Errorw("解析幂等响应失败", "error", err, "key", redisKey)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "读取幂等响应失败"})
+		return
+	}
+
+	// 同一个幂等键不能用于不同的接口或不同的请求内容
+	if cached.Path != c.FullPath() || cached.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "幂等键已用于其他请求"})
+		return
+	}
+
+	if cached.Status == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "请求正在处理中，请稍后重试"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(cached.Status, cached.ContentType, cached.Body)
+	c.Abort()
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"GoalifyGo/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newIdempotencyRouter 创建挂载幂等中间件的测试路由，handler 处理 POST /action
+func newIdempotencyRouter(handler gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uid", "u1")
+		c.Next()
+	})
+	r.Use(IdempotencyMiddleware())
+	r.POST("/action", handler)
+	return r
+}
+
+func postAction(r http.Handler, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/action", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyHeader, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	var calls int32
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusOK, gin.H{"call": n})
+	})
+
+	first := postAction(r, "k1", `{"a":1}`)
+	second := postAction(r, "k1", `{"a":1}`)
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay = %q (replayed=%q), want %q", second.Body.String(), second.Header().Get("Idempotent-Replayed"), first.Body.String())
+	}
+}
+
+func TestIdempotencyRejectsDifferentBody(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	var calls int32
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	postAction(r, "k1", `{"code":"AAAA"}`)
+	w := postAction(r, "k1", `{"code":"BBBB"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyConflictWhileInFlight(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postAction(r, "k1", `{}`) }()
+	<-entered
+
+	if w := postAction(r, "k1", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("concurrent duplicate status = %d, want 409", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", w.Code)
+	}
+}
+
+func TestIdempotencyDoesNotCacheDiscardedResponse(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	var calls int32
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		// 模拟以 error 事件结束的 SSE 流：状态码为 200，但生成失败
+		if atomic.AddInt32(&calls, 1) == 1 {
+			DiscardIdempotentResponse(c)
+			c.Data(http.StatusOK, "text/event-stream", []byte("event: error\ndata: {}\n\n"))
+			return
+		}
+		c.Data(http.StatusOK, "text/event-stream", []byte("event: done\ndata: {}\n\n"))
+	})
+
+	postAction(r, "k1", `{}`)
+	w := postAction(r, "k1", `{}`)
+	if calls != 2 {
+		t.Fatalf("handler called %d times, want retry to run again", calls)
+	}
+	if !strings.Contains(w.Body.String(), "event: done") {
+		t.Fatalf("retry body = %q", w.Body.String())
+	}
+
+	// 成功的流会被缓存
+	postAction(r, "k1", `{}`)
+	if calls != 2 {
+		t.Fatalf("successful stream was not cached, handler called %d times", calls)
+	}
+}
+
+func TestIdempotencyCachesOnlyReplayableStatus(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		// replayed 重试时是否返回缓存的首次响应
+		replayed bool
+	}{
+		{"bad request", http.StatusBadRequest, true},
+		{"unprocessable", http.StatusUnprocessableEntity, true},
+		{"not found", http.StatusNotFound, false},
+		{"payment required", http.StatusPaymentRequired, false},
+		{"conflict", http.StatusConflict, false},
+		// 锁定结束后重试应重新兑换
+		{"too many requests", http.StatusTooManyRequests, false},
+		{"server error", http.StatusInternalServerError, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.ObserveLogs(t)
+			testutil.SetupRedis(t)
+
+			var calls int32
+			r := newIdempotencyRouter(func(c *gin.Context) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					c.JSON(tc.status, gin.H{"error": "first"})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{})
+			})
+
+			postAction(r, "k1", `{}`)
+			w := postAction(r, "k1", `{}`)
+			if tc.replayed {
+				if calls != 1 || w.Code != tc.status {
+					t.Fatalf("handler called %d times, status = %d, want replayed %d", calls, w.Code, tc.status)
+				}
+				return
+			}
+			if calls != 2 || w.Code != http.StatusOK {
+				t.Fatalf("handler called %d times, status = %d, want retry to run again", calls, w.Code)
+			}
+		})
+	}
+}
+
+func TestIdempotencyDoesNotCacheInsufficientEnergy(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	// 与聊天和复盘接口一致，能量不足时返回 403
+	energy := 0
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		if energy < 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "能量值不足，请充值", "remainingEnergy": energy})
+			return
+		}
+		energy--
+		c.JSON(http.StatusOK, gin.H{"remainingEnergy": energy})
+	})
+
+	if w := postAction(r, "k1", `{"message":"你好"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+
+	// 充值后使用同一个幂等键重试，应重新执行而不是重放能量不足的响应
+	energy = 5
+	w := postAction(r, "k1", `{"message":"你好"}`)
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("status = %d (replayed=%q), body = %s, want 200", w.Code, w.Header().Get("Idempotent-Replayed"), w.Body.String())
+	}
+	if energy != 4 {
+		t.Errorf("energy = %d, want 4", energy)
+	}
+}
+
+func TestIdempotencyReleasesKeyWhenHandlerPanics(t *testing.T) {
+	testutil.ObserveLogs(t)
+	redis := testutil.SetupRedis(t)
+
+	var calls int32
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(func(c *gin.Context) {
+		c.Set("uid", "u1")
+		c.Next()
+	})
+	r.Use(IdempotencyMiddleware())
+	r.POST("/action", func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	if w := postAction(r, "k1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic status = %d, want 500", w.Code)
+	}
+	if redis.Exists("idempotency:u1:k1") {
+		t.Fatalf("handler panic 后幂等键仍被占用")
+	}
+
+	// 重试会重新执行，而不是一直返回 409
+	if w := postAction(r, "k1", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, want 200", w.Code)
+	}
+	if calls != 2 {
+		t.Fatalf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	testutil.ObserveLogs(t)
+	redis := testutil.SetupRedis(t)
+
+	var calls int32
+	r := newIdempotencyRouter(func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	body := `{"data":"` + strings.Repeat("a", maxIdempotentBodySize) + `"}`
+	if w := postAction(r, "k1", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+	if calls != 0 || redis.Exists("idempotency:u1:k1") {
+		t.Fatalf("过大的请求不应执行或占用幂等键, calls = %d", calls)
+	}
+}
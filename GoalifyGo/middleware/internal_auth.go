@@ -1,26 +1,38 @@
 package middleware
 
 import (
+	"GoalifyGo/config"
+	"crypto/subtle"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
+// InternalAuthHeader 内部接口认证令牌所在的请求头
+const InternalAuthHeader = "X-Internal-Auth"
+
+// 内部接口认证令牌，未配置时拒绝所有内部请求
+var internalAuthToken string
+
+// ConfigureInternalAuth 设置内部接口认证令牌
+func ConfigureInternalAuth(conf config.Config) {
+	internalAuthToken = conf.InternalAuthToken
+}
+
 // InternalAuthMiddleware 内部接口认证中间件
 func InternalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取请求头中的认证信息
-		authToken := c.GetHeader("X-Internal-Auth")
-		
-		// 验证认证信息
-		if authToken != os.Getenv("INTERNAL_AUTH_TOKEN") {
+		authToken := c.GetHeader(InternalAuthHeader)
+
+		// 验证认证信息，未配置令牌时不能以空请求头通过
+		if internalAuthToken == "" || subtle.ConstantTimeCompare([]byte(authToken), []byte(internalAuthToken)) != 1 {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 				"error": "Forbidden",
 			})
 			return
 		}
-		
+
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// App Store 商品类型
+const (
+	AppStoreKindEnergy       = "energy"       // 能量包
+	AppStoreKindSubscription = "subscription" // 订阅
+)
+
+// App Store 交易状态
+const (
+	AppStoreTransactionCredited = "credited" // 已发放
+	AppStoreTransactionRevoked  = "revoked"  // 已退款或撤销
+)
+
+// AppStoreTransaction 已处理的 App Store 交易，以交易ID为主键保证每笔交易只发放一次
+type AppStoreTransaction struct {
+	TransactionID         string     `gorm:"type:varchar(64);primaryKey" json:"transactionId"`
+	OriginalTransactionID string     `gorm:"type:varchar(64);index" json:"originalTransactionId"`
+	UserID                string     `gorm:"type:varchar(50);index" json:"-"`
+	ProductID             string     `gorm:"type:varchar(100)" json:"productId"`
+	Kind                  string     `gorm:"type:varchar(20)" json:"kind"` // energy, subscription
+	Energy                int        `json:"energy,omitempty"`             // 能量包发放的能量
+	Tier                  string     `gorm:"type:varchar(20)" json:"tier,omitempty"`
+	Environment           string     `gorm:"type:varchar(20)" json:"environment"` // Production, Sandbox
+	Status                string     `gorm:"type:varchar(20)" json:"status"`      // credited, revoked
+	PurchasedAt           time.Time  `json:"purchasedAt"`
+	ExpiresAt             *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt             *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt             time.Time  `json:"createdAt"`
+}
+
+func (AppStoreTransaction) TableName() string {
+	return "appstore_transactions"
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Conversation 对话线程
+type Conversation struct {
+	ID        string    `gorm:"type:varchar(50);primaryKey" json:"id"`
+	UserID    string    `gorm:"type:varchar(50);index:idx_conversations_user_updated" json:"-"`
+	Scene     string    `gorm:"type:varchar(20)" json:"scene"` // goal, emotion, chat
+	Title     string    `gorm:"type:varchar(100)" json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `gorm:"index:idx_conversations_user_updated" json:"updatedAt"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// 对话消息角色
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// ConversationMessage 对话消息
+type ConversationMessage struct {
+	ID             string    `gorm:"type:varchar(50);primaryKey" json:"id"`
+	ConversationID string    `gorm:"type:varchar(50);index:idx_conversation_messages_conv_created" json:"conversationId"`
+	UserID         string    `gorm:"type:varchar(50)" json:"-"`
+	Role           string    `gorm:"type:varchar(20)" json:"role"` // user, assistant
+	Content        string    `gorm:"type:text" json:"content"`
+	CreatedAt      time.Time `gorm:"index:idx_conversation_messages_conv_created" json:"createdAt"`
+}
+
+func (ConversationMessage) TableName() string {
+	return "conversation_messages"
+}
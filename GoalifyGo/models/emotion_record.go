@@ -4,15 +4,18 @@ import "time"
 
 // EmotionRecord 情绪记录模型
 type EmotionRecord struct {
-	ID               string    `gorm:"type:varchar(50);primaryKey" json:"id"`
-	EmotionType      string    `gorm:"type:varchar(50)" json:"emotionType"`
-	Intensity        int       `json:"intensity"`
-	Trigger          string    `gorm:"type:text" json:"trigger"`
-	UnhealthyBeliefs string    `gorm:"type:text" json:"unhealthyBeliefs"`
-	HealthyEmotion   string    `gorm:"type:varchar(50)" json:"healthyEmotion"`
-	CopingStrategies string    `gorm:"type:text" json:"copingStrategies"`
-	Status           int       `gorm:"type:int" default:"0" json:"status"` // 0: 正常 1: 删除
-	RecordDate       time.Time `json:"recordDate"`
-	UserID           string    `gorm:"type:varchar(50)" json:"user_id"`
-	LastModified     time.Time `json:"lastModified"`
+	ID               string          `gorm:"type:varchar(50);primaryKey" json:"id"`
+	EmotionType      string          `gorm:"type:varchar(50)" json:"emotionType"`
+	Intensity        int             `json:"intensity"`
+	Trigger          string          `gorm:"type:text" json:"trigger"`
+	UnhealthyBeliefs string          `gorm:"type:text" json:"unhealthyBeliefs"`
+	HealthyEmotion   string          `gorm:"type:varchar(50)" json:"healthyEmotion"`
+	CopingStrategies string          `gorm:"type:text" json:"copingStrategies"`
+	Status           int             `gorm:"type:int" default:"0" json:"status"` // 0: 正常 1: 删除
+	RecordDate       time.Time       `json:"recordDate"`
+	UserID           string          `gorm:"type:varchar(50)" json:"user_id"`
+	LastModified     time.Time       `json:"lastModified"`
+	FieldModified    FieldTimestamps `gorm:"type:json" json:"fieldModified"` // 各字段最后修改时间
+	// 客户端提交的最后修改时间，字段没有单独的修改时间时以此作为该字段的修改时间
+	ClientModified *time.Time `json:"-"`
 }
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// 能量流水原因
+const (
+	EnergyReasonInitial        = "initial" // 开始记录流水时的期初余额
+	EnergyReasonChat           = "chat"
+	EnergyReasonReviewDay      = "review_day"
+	EnergyReasonReviewWeek     = "review_week"
+	EnergyReasonReviewMonth    = "review_month"
+	EnergyReasonRedeem         = "redeem"
+	EnergyReasonAdminGrant     = "admin_grant"
+	EnergyReasonRefund         = "refund"
+	EnergyReasonDailyGrant     = "daily_grant"
+	EnergyReasonPurchase       = "purchase"
+	EnergyReasonPurchaseRefund = "purchase_refund"
+)
+
+// EnergyLedgerEntry 能量流水，只追加不修改；users.energy 为最后一条流水余额的缓存
+type EnergyLedgerEntry struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       string    `gorm:"type:varchar(50);index" json:"-"`
+	Delta        int       `json:"delta"`
+	Reason       string    `gorm:"type:varchar(30)" json:"reason"`
+	ReferenceID  string    `gorm:"type:varchar(50)" json:"referenceId,omitempty"` // 预扣、兑换码等关联记录的ID
+	BalanceAfter int       `json:"balanceAfter"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (EnergyLedgerEntry) TableName() string {
+	return "energy_ledger"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// 能量预扣状态
+const (
+	EnergyReservationReserved  = "reserved"  // 已预扣，等待确认
+	EnergyReservationCommitted = "committed" // 已确认扣除
+	EnergyReservationReleased  = "released"  // 已退还
+)
+
+// EnergyReservation 能量预扣记录，调用大模型前预扣，生成成功后确认，失败时退还
+type EnergyReservation struct {
+	ID         string     `gorm:"type:varchar(50);primaryKey" json:"id"`
+	UserID     string     `gorm:"type:varchar(50);index" json:"-"`
+	Amount     int        `json:"amount"`
+	Reason     string     `gorm:"type:varchar(30)" json:"reason"`                                              // chat, review_day, review_week, review_month
+	Status     string     `gorm:"type:varchar(20);index:idx_energy_reservations_status_created" json:"status"` // reserved, committed, released
+	CreatedAt  time.Time  `gorm:"index:idx_energy_reservations_status_created" json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+func (EnergyReservation) TableName() string {
+	return "energy_reservations"
+}
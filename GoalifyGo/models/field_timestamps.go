@@ -0,0 +1,38 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FieldTimestamps 记录每个字段最后一次修改的时间，用于字段级合并
+type FieldTimestamps map[string]time.Time
+
+// Value 实现 driver.Valuer，以 JSON 形式存储
+func (f FieldTimestamps) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return json.Marshal(f)
+}
+
+// Scan 实现 sql.Scanner
+func (f *FieldTimestamps) Scan(value interface{}) error {
+	if value == nil {
+		*f = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("无法解析字段修改时间: %T", value)
+	}
+	return json.Unmarshal(data, f)
+}
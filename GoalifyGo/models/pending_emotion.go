@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// 待确认情绪记录状态
+const (
+	PendingEmotionStatusPending   = "pending"
+	PendingEmotionStatusConfirmed = "confirmed"
+	PendingEmotionStatusDiscarded = "discarded"
+)
+
+// PendingEmotion 从 Orange 教练回复中解析出的情绪记录，用户确认后才写入情绪记录并参与同步
+type PendingEmotion struct {
+	ID               string     `gorm:"type:varchar(50);primaryKey" json:"id"`
+	UserID           string     `gorm:"type:varchar(50);index" json:"-"`
+	ConversationID   string     `gorm:"type:varchar(50)" json:"conversationId,omitempty"`
+	EmotionType      string     `gorm:"type:varchar(50)" json:"emotionType"`
+	Intensity        int        `json:"intensity"`
+	Trigger          string     `gorm:"type:text" json:"trigger"`
+	UnhealthyBeliefs string     `gorm:"type:text" json:"unhealthyBeliefs"`
+	HealthyEmotion   string     `gorm:"type:varchar(50)" json:"healthyEmotion"`
+	CopingStrategies string     `gorm:"type:text" json:"copingStrategies"`
+	Status           string     `gorm:"type:varchar(20);default:pending" json:"status"`    // pending, confirmed, discarded
+	EmotionRecordID  string     `gorm:"type:varchar(50)" json:"emotionRecordId,omitempty"` // 确认后生成的情绪记录ID
+	CreatedAt        time.Time  `json:"createdAt"`
+	ResolvedAt       *time.Time `json:"resolvedAt,omitempty"`
+}
+
+func (PendingEmotion) TableName() string {
+	return "pending_emotions"
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 任务计划状态
+const (
+	PlanStatusPending  = "pending"
+	PlanStatusAccepted = "accepted"
+)
+
+// PlanTask 任务计划中的单个任务，字段与 Logic 教练输出的 JSON 一致
+type PlanTask struct {
+	Title              string `json:"title"`
+	Notes              string `json:"notes"`
+	Priority           int    `json:"priority"`          // 1: 高 5: 中 9: 低 0: 无
+	DueDate            string `json:"dueDate,omitempty"` // ISO8601
+	HasAlarm           bool   `json:"hasAlarm"`
+	AlarmDate          string `json:"alarmDate,omitempty"` // ISO8601，hasAlarm 为 true 时必填
+	RecurrenceRule     string `json:"recurrenceRule"`      // none, daily, weekly, monthly, yearly
+	RecurrenceInterval int    `json:"recurrenceInterval"`
+}
+
+// PlanTasks 以 JSON 形式存储的任务列表
+type PlanTasks []PlanTask
+
+// Value 实现 driver.Valuer，以 JSON 形式存储
+func (p PlanTasks) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan 实现 sql.Scanner
+func (p *PlanTasks) Scan(value interface{}) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("无法解析任务计划: %T", value)
+	}
+	return json.Unmarshal(data, p)
+}
+
+// Plan 从 Logic 教练回复中解析出的任务计划，用户接受后生成任务
+type Plan struct {
+	ID             string      `gorm:"type:varchar(50);primaryKey" json:"id"`
+	UserID         string      `gorm:"type:varchar(50);index" json:"-"`
+	ConversationID string      `gorm:"type:varchar(50)" json:"conversationId,omitempty"`
+	Tasks          PlanTasks   `gorm:"type:json" json:"tasks"`
+	Status         string      `gorm:"type:varchar(20);default:pending" json:"status"` // pending, accepted
+	TaskIDs        PlanTaskIDs `gorm:"type:json" json:"taskIds,omitempty"`             // 接受后生成的任务ID
+	CreatedAt      time.Time   `json:"createdAt"`
+	AcceptedAt     *time.Time  `json:"acceptedAt,omitempty"`
+}
+
+func (Plan) TableName() string {
+	return "plans"
+}
+
+// PlanTaskIDs 以 JSON 形式存储的任务ID列表
+type PlanTaskIDs []string
+
+// Value 实现 driver.Valuer，以 JSON 形式存储
+func (p PlanTaskIDs) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan 实现 sql.Scanner
+func (p *PlanTaskIDs) Scan(value interface{}) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("无法解析任务ID列表: %T", value)
+	}
+	return json.Unmarshal(data, p)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RedeemCampaign 兑换码批次，同一批次的兑换码共享能量、兑换次数和过期时间
+type RedeemCampaign struct {
+	ID         string     `gorm:"type:varchar(50);primaryKey" json:"id"`
+	Name       string     `gorm:"type:varchar(100)" json:"name"`
+	Energy     int        `json:"energy"`
+	CodeCount  int        `json:"codeCount"`
+	CodeLength int        `json:"codeLength"`
+	MaxUses    int        `json:"maxUses"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (RedeemCampaign) TableName() string {
+	return "redeem_campaigns"
+}
@@ -1,27 +1,45 @@
 package models
 
 import (
+	"crypto/rand"
+	"fmt"
 	"time"
-	"math/rand"
+)
+
+// 兑换码长度范围，默认长度下码空间约 32^10
+const (
+	RedeemCodeCharset       = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去掉容易混淆的字符
+	DefaultRedeemCodeLength = 10
+	MinRedeemCodeLength     = 6
+	MaxRedeemCodeLength     = 32
 )
 
 type RedeemCode struct {
-	ID        string     `gorm:"primaryKey" json:"id"`
-	Code      string     `gorm:"type:varchar(4);uniqueIndex" json:"code"`
-	Energy    int        `gorm:"default:20" json:"energy"`
-	CreatedAt time.Time  `json:"created_at"`
-	UsedAt    *time.Time `json:"used_at"`
-	UserID    *string    `gorm:"index" json:"user_id"`
+	ID         string     `gorm:"primaryKey" json:"id"`
+	CampaignID *string    `gorm:"type:varchar(50);index" json:"campaign_id"` // 所属批次，单独创建的兑换码为空
+	Code       string     `gorm:"type:varchar(32);uniqueIndex" json:"code"`
+	Energy     int        `gorm:"default:20" json:"energy"`
+	MaxUses    int        `gorm:"default:1" json:"max_uses"`  // 可兑换次数，每个用户只能兑换一次
+	UseCount   int        `gorm:"default:0" json:"use_count"` // 已兑换次数
+	ExpiresAt  *time.Time `json:"expires_at"`                 // 过期时间，为空表示不过期
+	CreatedAt  time.Time  `json:"created_at"`
+	UsedAt     *time.Time `json:"used_at"`              // 兑换次数用完的时间
+	UserID     *string    `gorm:"index" json:"user_id"` // 单次兑换码的兑换用户，多次兑换码不写入，按用户的兑换见 RedeemRedemption
 }
 
-// GenerateRedeemCode 生成4位随机兑换码
-func GenerateRedeemCode() string {
-	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去掉容易混淆的字符
-	const codeLength = 4
-	rand.Seed(time.Now().UnixNano())
-	code := make([]byte, codeLength)
-	for i := range code {
-		code[i] = charset[rand.Intn(len(charset))]
+// GenerateRedeemCode 使用 crypto/rand 生成指定长度的随机兑换码
+func GenerateRedeemCode(length int) (string, error) {
+	if length < MinRedeemCodeLength || length > MaxRedeemCodeLength {
+		return "", fmt.Errorf("兑换码长度需在 %d 到 %d 之间", MinRedeemCodeLength, MaxRedeemCodeLength)
+	}
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	// 字符集长度为 32，能整除 256，取模不会引入偏差
+	code := make([]byte, length)
+	for i, b := range buf {
+		code[i] = RedeemCodeCharset[int(b)%len(RedeemCodeCharset)]
 	}
-	return string(code)
+	return string(code), nil
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RedeemRedemption 兑换记录，唯一索引保证每个用户对同一兑换码只能兑换一次
+type RedeemRedemption struct {
+	ID        string    `gorm:"type:varchar(50);primaryKey" json:"id"`
+	CodeID    string    `gorm:"type:varchar(50);uniqueIndex:idx_redeem_redemptions_code_user" json:"codeId"`
+	UserID    string    `gorm:"type:varchar(50);uniqueIndex:idx_redeem_redemptions_code_user;index" json:"-"`
+	Energy    int       `json:"energy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (RedeemRedemption) TableName() string {
+	return "redeem_redemptions"
+}
@@ -17,6 +17,13 @@ type SyncTasksRequest struct {
 	Quadrant     string     `json:"quadrant"`
 	RepeatType   string     `json:"repeatType"`
 	LastModified time.Time  `json:"lastModified"`
+	// 提醒、重复间隔和优先级，旧版客户端不提交时为空，合并时保留服务端的值
+	HasAlarm       *bool      `json:"hasAlarm"`
+	AlarmDate      *time.Time `json:"alarmDate"`
+	RepeatInterval *int       `json:"repeatInterval"`
+	Priority       *int       `json:"priority"`
+	// 各字段最后修改时间（可选），缺省时以 LastModified 作为所有字段的修改时间
+	FieldModified map[string]time.Time `json:"fieldModified"`
 }
 
 // 添加验证和时区转换方法
@@ -29,7 +36,46 @@ func (r *SyncTasksRequest) ConvertToUTC() {
 		utcTime := r.PlannedDate.UTC()
 		r.PlannedDate = &utcTime
 	}
+	if r.AlarmDate != nil {
+		utcTime := r.AlarmDate.UTC()
+		r.AlarmDate = &utcTime
+	}
 	r.LastModified = r.LastModified.UTC()
+	for field, modified := range r.FieldModified {
+		r.FieldModified[field] = modified.UTC()
+	}
+}
+
+// Alarm 返回客户端提交的提醒时间，未开启提醒时为空
+func (r *SyncTasksRequest) Alarm() *time.Time {
+	if r.HasAlarm == nil || !*r.HasAlarm {
+		return nil
+	}
+	return r.AlarmDate
+}
+
+// Interval 返回客户端提交的重复间隔，未提交时为 1
+func (r *SyncTasksRequest) Interval() int {
+	if r.RepeatInterval == nil || *r.RepeatInterval <= 0 {
+		return 1
+	}
+	return *r.RepeatInterval
+}
+
+// PriorityLevel 返回客户端提交的优先级，未提交时为 0（无优先级）
+func (r *SyncTasksRequest) PriorityLevel() int {
+	if r.Priority == nil {
+		return 0
+	}
+	return *r.Priority
+}
+
+// FieldTime 返回指定字段的修改时间
+func (r *SyncTasksRequest) FieldTime(field string) time.Time {
+	if modified, ok := r.FieldModified[field]; ok {
+		return modified
+	}
+	return r.LastModified
 }
 
 // SyncEmotionsRequest 情绪记录同步请求结构体
@@ -43,11 +89,24 @@ type SyncEmotionsRequest struct {
 	CopingStrategies string    `json:"copingStrategies"`
 	RecordDate       time.Time `json:"recordDate"`
 	LastModified     time.Time `json:"lastModified"`
+	// 各字段最后修改时间（可选），缺省时以 LastModified 作为所有字段的修改时间
+	FieldModified map[string]time.Time `json:"fieldModified"`
 }
 
 func (r *SyncEmotionsRequest) ConvertToUTC() {
 	r.RecordDate = r.RecordDate.UTC()
 	r.LastModified = r.LastModified.UTC()
+	for field, modified := range r.FieldModified {
+		r.FieldModified[field] = modified.UTC()
+	}
+}
+
+// FieldTime 返回指定字段的修改时间
+func (r *SyncEmotionsRequest) FieldTime(field string) time.Time {
+	if modified, ok := r.FieldModified[field]; ok {
+		return modified
+	}
+	return r.LastModified
 }
 
 // SyncTimeRecordsRequest 时间记录同步请求结构体
@@ -96,6 +155,12 @@ type TimeRecordWithTask struct {
 	TotalTime int    `json:"totalTime"` // 秒数
 }
 
+// SyncDeletionsRequest 删除记录同步请求结构体
+type SyncDeletionsRequest struct {
+	Type string `json:"type" binding:"required"` // emotion, task, subtask, timeRecord
+	ID   string `json:"id" binding:"required"`
+}
+
 // 添加子任务同步请求结构体
 type SyncSubtasksRequest struct {
 	ID           string    `json:"id"`
@@ -4,7 +4,21 @@ import "time"
 
 // SyncUpdatesResponse 同步更新响应结构体
 type SyncUpdatesResponse struct {
-	Emotions []EmotionResponse `json:"emotions"`
+	Emotions    []EmotionResponse    `json:"emotions"`
+	Tasks       []TaskResponse       `json:"tasks"`
+	Subtasks    []SubtaskResponse    `json:"subtasks"`
+	TimeRecords []TimeRecordResponse `json:"timeRecords"`
+	Deleted     DeletedResponse      `json:"deleted"`
+	Cursor      string               `json:"cursor"`  // 下一次增量同步使用的游标
+	HasMore     bool                 `json:"hasMore"` // 是否还有下一页
+}
+
+// DeletedResponse 自上次同步以来被删除的记录ID，按实体类型分组
+type DeletedResponse struct {
+	Emotions    []string `json:"emotions"`
+	Tasks       []string `json:"tasks"`
+	Subtasks    []string `json:"subtasks"`
+	TimeRecords []string `json:"timeRecords"`
 }
 
 // TaskResponse 任务响应结构体
@@ -19,6 +33,11 @@ type TaskResponse struct {
 	Quadrant     string     `json:"quadrant"`
 	RepeatType   string     `json:"repeatType"`
 	LastModified time.Time  `json:"lastModified"`
+	// 提醒和重复间隔
+	HasAlarm       bool       `json:"hasAlarm"`
+	AlarmDate      *time.Time `json:"alarmDate,omitempty"`
+	RepeatInterval int        `json:"repeatInterval"`
+	Priority       int        `json:"priority"`
 }
 
 // EmotionResponse 情绪记录响应结构体
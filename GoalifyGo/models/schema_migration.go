@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// SchemaMigration 已执行的数据迁移，每个迁移只执行一次
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey;type:varchar(100)" json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
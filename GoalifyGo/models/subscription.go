@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// 订阅等级
+const (
+	TierFree = "free"
+	TierPlus = "plus"
+	TierPro  = "pro"
+)
+
+// Subscription 用户订阅权益，在 StartsAt 与 ExpiresAt 之间生效，过期后自动回到免费等级
+type Subscription struct {
+	ID        string    `gorm:"type:varchar(50);primaryKey" json:"id"`
+	UserID    string    `gorm:"type:varchar(50);index:idx_subscriptions_user_expires" json:"-"`
+	Tier      string    `gorm:"type:varchar(20)" json:"tier"`   // plus, pro
+	Source    string    `gorm:"type:varchar(30)" json:"source"` // 订阅来源，如 appstore
+	StartsAt  time.Time `json:"startsAt"`
+	ExpiresAt time.Time `gorm:"index:idx_subscriptions_user_expires" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
@@ -9,5 +9,8 @@ type Subtask struct {
 	IsCompleted  bool      `gorm:"default:false" json:"isCompleted"`
 	TaskID       string    `gorm:"type:varchar(50)" json:"task_id"`
 	UserID       string    `gorm:"type:varchar(50)" json:"user_id"`
-	LastModified time.Time `json:"lastModified"`
+	Status       int       `gorm:"type:int;default:0" json:"status"` // 0: 正常 1: 删除
+	LastModified time.Time `json:"lastModified"`                     // 服务端写入时间
+	// 客户端提交的修改时间，只与客户端时间比较，避免与服务端时钟混用
+	ClientModified *time.Time `json:"-"`
 }
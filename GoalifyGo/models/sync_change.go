@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// SyncChange 同步变更日志，每个实体只保留最近一次变更对应的序号
+type SyncChange struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID     string    `gorm:"type:varchar(50);uniqueIndex:idx_sync_changes_entity;uniqueIndex:idx_sync_changes_user_seq" json:"-"`
+	Seq        int64     `gorm:"uniqueIndex:idx_sync_changes_user_seq" json:"seq"`
+	EntityType string    `gorm:"type:varchar(30);uniqueIndex:idx_sync_changes_entity" json:"entityType"`
+	EntityID   string    `gorm:"type:varchar(50);uniqueIndex:idx_sync_changes_entity" json:"entityId"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+func (SyncChange) TableName() string {
+	return "sync_changes"
+}
+
+// SyncChangeEvent 推送给客户端的同步变更通知
+type SyncChangeEvent struct {
+	EntityType string `json:"entityType"`
+	EntityID   string `json:"entityId"`
+	Cursor     string `json:"cursor"` // 包含该变更的同步游标
+}
@@ -0,0 +1,31 @@
+package models
+
+// 单条同步记录的处理状态
+const (
+	SyncItemApplied  = "applied"  // 已写入
+	SyncItemStale    = "stale"    // 服务端版本更新，未写入
+	SyncItemRejected = "rejected" // 数据无效，被拒绝
+)
+
+// 单条同步记录被拒绝的原因
+const (
+	SyncReasonInvalidID     = "invalid_id"     // 缺少记录ID
+	SyncReasonInvalidField  = "invalid_field"  // 字段取值无效
+	SyncReasonTaskNotFound  = "task_not_found" // 关联任务不存在或不属于当前用户
+	SyncReasonForbidden     = "forbidden"      // 记录ID属于其他用户
+	SyncReasonInternalError = "internal_error" // 服务端处理失败
+)
+
+// SyncItemResult 批量同步中单条记录的处理结果
+type SyncItemResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// SyncConflict 同步冲突信息，列出客户端被覆盖的字段以及服务端最终保留的版本
+type SyncConflict struct {
+	ID     string      `json:"id"`
+	Fields []string    `json:"fields"`
+	Server interface{} `json:"server"`
+}
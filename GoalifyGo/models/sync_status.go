@@ -0,0 +1,23 @@
+package models
+
+// 同步实体的记录状态，删除采用软删除（墓碑）方式以便同步到其他设备
+const (
+	StatusNormal  = 0 // 正常
+	StatusDeleted = 1 // 已删除
+)
+
+// 同步实体类型，与客户端 DeletedRecord.type 保持一致
+const (
+	EntityEmotion    = "emotion"
+	EntityTask       = "task"
+	EntitySubtask    = "subtask"
+	EntityTimeRecord = "timeRecord"
+)
+
+// SyncEntityModels 同步实体类型与数据模型的对应关系
+var SyncEntityModels = map[string]interface{}{
+	EntityEmotion:    &EmotionRecord{},
+	EntityTask:       &Task{},
+	EntitySubtask:    &Subtask{},
+	EntityTimeRecord: &TimeRecord{},
+}
@@ -6,16 +6,23 @@ import (
 
 // Task 任务模型
 type Task struct {
-	ID           string     `gorm:"type:varchar(50);primary_key" json:"id"`
-	Title        string     `gorm:"type:varchar(100)" json:"title"`
-	IsCompleted  bool       `json:"isCompleted"`
-	Notes        string     `gorm:"type:text" json:"notes"`
-	Deadline     *time.Time `json:"deadline"`
-	PlannedDate  *time.Time `json:"plannedDate,omitempty"`
-	Difficulty   int        `gorm:"default:1" json:"difficulty"`      // 难度
-	Quadrant     string     `gorm:"type:varchar(30)" json:"quadrant"` // 四象限
-	UserID       string     `gorm:"type:varchar(50)" json:"user_id"`
-	FocusTime    int        `gorm:"default:0" json:"focusTime"` // 专注时间
-	LastModified time.Time  `json:"lastModified"`
-	RepeatType   string     `gorm:"type:varchar(30)" json:"repeatType"` // 重复类型
+	ID             string          `gorm:"type:varchar(50);primary_key" json:"id"`
+	Title          string          `gorm:"type:varchar(100)" json:"title"`
+	IsCompleted    bool            `json:"isCompleted"`
+	Notes          string          `gorm:"type:text" json:"notes"`
+	Deadline       *time.Time      `json:"deadline"`
+	PlannedDate    *time.Time      `json:"plannedDate,omitempty"`
+	Difficulty     int             `gorm:"default:1" json:"difficulty"`      // 难度
+	Quadrant       string          `gorm:"type:varchar(30)" json:"quadrant"` // 四象限
+	UserID         string          `gorm:"type:varchar(50)" json:"user_id"`
+	FocusTime      int             `gorm:"default:0" json:"focusTime"` // 专注时间
+	LastModified   time.Time       `json:"lastModified"`
+	RepeatType     string          `gorm:"type:varchar(30)" json:"repeatType"` // 重复类型
+	RepeatInterval int             `gorm:"default:1" json:"repeatInterval"`    // 重复间隔，如每 2 周
+	AlarmDate      *time.Time      `json:"alarmDate,omitempty"`                // 提醒时间，为空表示不提醒
+	Priority       int             `gorm:"default:0" json:"priority"`          // 优先级，与提醒事项一致：1 高 5 中 9 低 0 无
+	Status         int             `gorm:"type:int;default:0" json:"status"`   // 0: 正常 1: 删除
+	FieldModified  FieldTimestamps `gorm:"type:json" json:"fieldModified"`     // 各字段最后修改时间
+	// 客户端提交的最后修改时间，字段没有单独的修改时间时以此作为该字段的修改时间
+	ClientModified *time.Time `json:"-"`
 }
@@ -10,7 +10,10 @@ type TimeRecord struct {
 	TaskID       string `gorm:"type:varchar(50);index:idx_time_records_task"`
 	StartTime    time.Time `gorm:"index:idx_time_records_user_start"`
 	EndTime      time.Time
-	LastModified time.Time
+	Status       int `gorm:"type:int;default:0"` // 0: 正常 1: 删除
+	LastModified time.Time // 服务端写入时间
+	// 客户端提交的修改时间，只与客户端时间比较，避免与服务端时钟混用
+	ClientModified *time.Time
 }
 
 // 表名
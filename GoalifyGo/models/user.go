@@ -16,7 +16,12 @@ type User struct {
 	ProviderID        string     `gorm:"type:varchar(50)" json:"providerId"`
 	AppleRefreshToken string     `gorm:"type:varchar(255)" json:"-"`
 	IsTestUser        bool       `gorm:"default:false" json:"isTestUser"`
-	Energy            int        `gorm:"default:20" json:"energy"` // 用户能量值，默认20
+	Energy            int        `gorm:"default:20" json:"energy"`                    // 用户能量值，默认20
+	SyncSeq           int64      `gorm:"default:0" json:"-"`                          // 同步变更序号，单调递增
+	SyncPrunedSeq     int64      `gorm:"default:0" json:"-"`                          // 已清理的变更日志中的最大序号，游标早于该序号时需要全量同步
+	LastEnergyGrantOn string     `gorm:"type:varchar(10);default:''" json:"-"`        // 最近一次免费恢复能量的本地日期，格式 2006-01-02
+	Timezone          string     `gorm:"type:varchar(64);default:''" json:"timezone"` // 服务端固定的 IANA 时区，按该时区的日期恢复能量
+	TimezoneChangedAt *time.Time `json:"-"`                                           // 最近一次修改时区的时间，用于限制修改频率
 }
 
 func (u *User) GetDisplayName() string {
@@ -3,19 +3,23 @@ package routes
 import (
 	"GoalifyGo/controllers"
 	"GoalifyGo/middleware"
-	"GoalifyGo/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.Engine, client *services.DeepseekClient) {
+func RegisterRoutes(r *gin.Engine, chatController *controllers.ChatController) {
 	authController := controllers.AuthController{}
-	chatService := services.NewChatService(client)
-	chatController := controllers.NewChatController(chatService)
 	emotionController := controllers.EmotionController{}
+	taskController := controllers.TaskController{}
+	subtaskController := controllers.SubtaskController{}
+	timeRecordController := controllers.TimeRecordController{}
 	syncController := controllers.SyncController{}
 	userController := controllers.UserController{}
 	redeemController := controllers.RedeemController{}
+	conversationController := controllers.ConversationController{}
+	planController := controllers.PlanController{}
+	pendingEmotionController := controllers.PendingEmotionController{}
+	purchaseController := controllers.PurchaseController{}
 
 	// 公开路由（无需认证）
 	public := r.Group("/api/v1")
@@ -23,29 +27,49 @@ func RegisterRoutes(r *gin.Engine, client *services.DeepseekClient) {
 		public.POST("/auth/wechat", authController.WechatLogin)
 		public.POST("/auth/apple", authController.AppleLogin)
 		public.POST("/auth/test-user", authController.CreateTestUser)
+		public.POST("/appstore/notifications", purchaseController.HandleAppStoreNotification) // App Store 服务器通知，由签名校验保证来源
 	}
 
 	// 需要认证的路由
 	private := r.Group("/api/v1")
-	private.Use(middleware.AuthMiddleware()) // 应用认证中间件
+	private.Use(middleware.AuthMiddleware())        // 应用认证中间件
+	private.Use(middleware.EnergyRegenMiddleware()) // 每日首次请求时恢复免费能量，需在认证之后
+	private.Use(middleware.IdempotencyMiddleware()) // 应用幂等中间件，需在认证之后
 	{
 		// Chat 相关接口
 		private.POST("/chat", chatController.SendMessage)
 		private.POST("/analysis", chatController.AnalyzeReview)
+		private.POST("/conversations", conversationController.CreateConversation)
+		private.GET("/conversations", conversationController.ListConversations)
+		private.GET("/conversations/:id", conversationController.GetConversation)
+		private.GET("/plans/:id", planController.GetPlan)
+		private.POST("/plans/:id/accept", planController.AcceptPlan)
+		private.GET("/emotions/pending", pendingEmotionController.ListPendingEmotions)
+		private.POST("/emotions/pending/:id/confirm", pendingEmotionController.ConfirmPendingEmotion)
+		private.POST("/emotions/pending/:id/discard", pendingEmotionController.DiscardPendingEmotion)
 		private.POST("/sync/emotions", emotionController.SyncEmotions)
+		private.POST("/sync/tasks", taskController.SyncTasks)
+		private.POST("/sync/subtasks", subtaskController.SyncSubtasks)
+		private.POST("/sync/time-records", timeRecordController.SyncTimeRecords)
+		private.POST("/sync/deletions", syncController.SyncDeletions)
 		private.GET("/sync/updates", syncController.GetUpdates)
+		private.GET("/sync/stream", syncController.StreamChanges)
 		private.GET("/user/energy", userController.GetEnergy)
+		private.GET("/user/energy/history", userController.GetEnergyHistory)
 		private.POST("/redeem", redeemController.RedeemCode)
+		private.POST("/purchases/appstore", purchaseController.VerifyAppStorePurchase)
 		private.GET("/user", userController.GetUser)
 		private.GET("/review-analyses", chatController.GetReviewAnalyses)
 	}
 
-	// 内部路由组（仅限服务器内部调用）
+	// 内部路由组（仅限服务器内部调用），需携带内部认证令牌
 	internal := r.Group("/internal")
-	//internal.Use(middleware.InternalAuthMiddleware()) // 添加内部认证中间件
+	internal.Use(middleware.InternalAuthMiddleware()) // 添加内部认证中间件
 	{
 		//internal.GET("/user/add-energy", userController.AddEnergy)
-		internal.GET("/redeem/generate", redeemController.CreateRedeemCode)
+		internal.POST("/redeem/generate", redeemController.CreateRedeemCode)
+		internal.POST("/redeem/campaigns", redeemController.CreateRedeemCampaign)
+		internal.GET("/redeem/campaigns/:id/export", redeemController.ExportRedeemCampaign)
 	}
 
 	// 测试路由
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/middleware"
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRedeemAdminRoutesRequireInternalAuth(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupDB(t, &models.RedeemCode{}, &models.RedeemCampaign{})
+
+	r := gin.New()
+	RegisterRoutes(r, nil)
+
+	const token = "internal-secret"
+	request := func(method, path, authToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if authToken != "" {
+			req.Header.Set(middleware.InternalAuthHeader, authToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		name       string
+		configured string
+		method     string
+		path       string
+		authToken  string
+		noBody     bool // 不带请求体
+		want       int
+	}{
+		{name: "token not configured", method: http.MethodPost, path: "/internal/redeem/campaigns", want: http.StatusForbidden},
+		{name: "missing header", configured: token, method: http.MethodPost, path: "/internal/redeem/campaigns", want: http.StatusForbidden},
+		{name: "query password", configured: token, method: http.MethodPost, path: "/internal/redeem/generate?password=secret", want: http.StatusForbidden},
+		{name: "wrong token", configured: token, method: http.MethodGet, path: "/internal/redeem/campaigns/c1/export", authToken: "guess", want: http.StatusForbidden},
+		{name: "generate", configured: token, method: http.MethodPost, path: "/internal/redeem/generate", authToken: token, want: http.StatusOK},
+		// 所有字段都可省略，不带请求体时使用默认值
+		{name: "generate without body", configured: token, method: http.MethodPost, path: "/internal/redeem/generate", authToken: token, noBody: true, want: http.StatusOK},
+		{name: "generate via GET", configured: token, method: http.MethodGet, path: "/internal/redeem/generate?energy=10", authToken: token, want: http.StatusNotFound},
+		{name: "create", configured: token, method: http.MethodPost, path: "/internal/redeem/campaigns", authToken: token, want: http.StatusOK},
+		{name: "export unknown campaign", configured: token, method: http.MethodGet, path: "/internal/redeem/campaigns/c1/export", authToken: token, want: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			middleware.ConfigureInternalAuth(config.Config{InternalAuthToken: tc.configured})
+			t.Cleanup(func() { middleware.ConfigureInternalAuth(config.Config{}) })
+
+			body := `{"energy":10,"count":2}`
+			if tc.noBody {
+				body = ""
+			}
+			if w := request(tc.method, tc.path, tc.authToken, body); w.Code != tc.want {
+				t.Errorf("status = %d, want %d, body=%s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
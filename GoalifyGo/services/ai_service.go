@@ -11,11 +11,13 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type ChatService struct {
-	client *DeepseekClient
-	wg     sync.WaitGroup
+	provider LLMProvider
+	profiles ModelProfiles
+	wg       sync.WaitGroup
 }
 
 type ChatRequest struct {
@@ -31,9 +33,10 @@ type ChatResponse struct {
 	Coach   string `json:"coach"`
 }
 
-func NewChatService(client *DeepseekClient) *ChatService {
+func NewChatService(provider LLMProvider, profiles ModelProfiles) *ChatService {
 	return &ChatService{
-		client: client,
+		provider: provider,
+		profiles: profiles,
 	}
 }
 
@@ -54,15 +57,46 @@ const (
 	ChatScene    AIScene = "chat"
 )
 
-// GenerateCoachResponse 根据教练类型和场景生成回复
-func (s *ChatService) GenerateCoachResponse(ctx context.Context, coach AICoach, scene AIScene, message string, historySummary string, uid string) (<-chan string, error) {
+// UsesHistorySummary 返回场景的提示词是否使用对话历史总结，其他场景不需要生成总结
+func (s AIScene) UsesHistorySummary() bool {
+	return s == EmotionScene
+}
+
+// ChatTurn 对话中的一轮消息
+type ChatTurn struct {
+	Role    string // user, assistant
+	Content string
+}
+
+// 传给模型的历史消息 token 预算
+const historyTokenBudget = 3000
+
+// estimateTokens 粗略估算文本的 token 数，中文约每字一个 token，按字符数估算偏保守
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// trimHistory 从最早的消息开始丢弃，直到历史消息总量不超过 token 预算
+func trimHistory(history []ChatTurn, budget int) []ChatTurn {
+	total := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		total += estimateTokens(history[i].Content)
+		if total > budget {
+			return history[i+1:]
+		}
+	}
+	return history
+}
+
+// GenerateCoachResponse 根据教练类型和场景生成回复，history 为同一对话中之前的消息（按时间升序）
+func (s *ChatService) GenerateCoachResponse(ctx context.Context, coach AICoach, scene AIScene, message string, history []ChatTurn, historySummary string, uid string) (<-chan StreamEvent, error) {
 	config.Logger.Debugw("生成教练响应",
 		"coach", coach,
 		"scene", scene,
 		"messageLength", len(message),
 	)
 
-	outputChan := make(chan string)
+	outputChan := make(chan StreamEvent)
 
 	s.wg.Add(1) // 增加 WaitGroup 计数
 	go func() {
@@ -78,13 +112,23 @@ func (s *ChatService) GenerateCoachResponse(ctx context.Context, coach AICoach,
 		}
 
 		// 如果有历史总结，添加到消息中
-		if historySummary != "" {
-			if scene == EmotionScene {
-				messages = append(messages, llms.MessageContent{
-					Role:  schema.ChatMessageTypeSystem,
-					Parts: []llms.ContentPart{llms.TextPart(fmt.Sprintf("以下是之前的对话记录总结，可作为上下文参考：\n%s", historySummary))},
-				})
+		if historySummary != "" && scene.UsesHistorySummary() {
+			messages = append(messages, llms.MessageContent{
+				Role:  schema.ChatMessageTypeSystem,
+				Parts: []llms.ContentPart{llms.TextPart(fmt.Sprintf("以下是之前的对话记录总结，可作为上下文参考：\n%s", historySummary))},
+			})
+		}
+
+		// 添加之前的对话轮次
+		for _, turn := range trimHistory(history, historyTokenBudget) {
+			role := schema.ChatMessageTypeHuman
+			if turn.Role == models.MessageRoleAssistant {
+				role = schema.ChatMessageTypeAI
 			}
+			messages = append(messages, llms.MessageContent{
+				Role:  role,
+				Parts: []llms.ContentPart{llms.TextPart(turn.Content)},
+			})
 		}
 
 		messages = append(messages, llms.MessageContent{
@@ -92,27 +136,24 @@ func (s *ChatService) GenerateCoachResponse(ctx context.Context, coach AICoach,
 			Parts: []llms.ContentPart{llms.TextPart(message)},
 		})
 
-		var fullResponse strings.Builder
+		// 场景配置优先于教练配置
+		temperature := defaultTemperature
+		options := s.profiles.resolve(string(scene), string(coach)).callOptions(&temperature)
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return sendStreamEvent(ctx, outputChan, StreamEvent{Content: string(chunk)})
+		}))
 
-		options := []llms.CallOption{
-			llms.WithTemperature(0.7),
-			llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-				text := string(chunk)
-				outputChan <- text
-				fullResponse.WriteString(text)
-				return nil
-			}),
-		}
-
-		if _, err := s.client.DsChat.GenerateContent(ctx, messages, options...); err != nil {
+		resp, err := s.provider.GenerateContent(ctx, messages, options...)
+		if err != nil {
 			config.Logger.Errorw("生成内容失败",
 				"error", err,
 				"coach", coach,
 				"scene", scene,
 			)
-			outputChan <- fmt.Sprintf("生成内容时出错: %v", err)
+			sendStreamEvent(ctx, outputChan, StreamEvent{Err: err})
 			return
 		}
+		sendStreamEvent(ctx, outputChan, StreamEvent{Usage: usageFromResponse(resp)})
 	}()
 
 	return outputChan, nil
@@ -245,8 +286,8 @@ func (s *ChatService) GenerateSummary(ctx context.Context, fullResponse string,
 			Role: schema.ChatMessageTypeSystem,
 			Parts: []llms.ContentPart{llms.TextPart(`请根据以下规则生成摘要：
 1.结合历史摘要和最新对话内容，生成不超过100字的对话摘要
-2.最新对话将以"Historical summary:"开头
-3.历史摘要将以"Latest dialogue:"开头`)},
+2.历史摘要将以"Historical summary:"开头
+3.最新对话将以"Latest dialogue:"开头`)},
 		},
 	}
 
@@ -266,7 +307,8 @@ func (s *ChatService) GenerateSummary(ctx context.Context, fullResponse string,
 	})
 
 	// 使用 GenerateContent 生成总结
-	response, err := s.client.DsChat.GenerateContent(ctx, messages)
+	options := s.profiles.resolve(ProfileSummary).callOptions(nil)
+	response, err := s.provider.GenerateContent(ctx, messages, options...)
 	if err != nil {
 		return "", fmt.Errorf("生成总结失败: %v", err)
 	}
@@ -281,8 +323,8 @@ func (s *ChatService) GenerateSummary(ctx context.Context, fullResponse string,
 	return summary, nil
 }
 
-func (s *ChatService) GenerateReviewAnalysis(ctx context.Context, period string, timeRecords []models.TimeRecordWithTask, emotions []models.EmotionRecord, previousSummary string) (<-chan string, error) {
-	outputChan := make(chan string)
+func (s *ChatService) GenerateReviewAnalysis(ctx context.Context, period string, timeRecords []models.TimeRecordWithTask, emotions []models.EmotionRecord, previousSummary string) (<-chan StreamEvent, error) {
+	outputChan := make(chan StreamEvent)
 
 	s.wg.Add(1) // 增加 WaitGroup 计数
 	go func() {
@@ -345,20 +387,19 @@ func (s *ChatService) GenerateReviewAnalysis(ctx context.Context, period string,
 			Parts: []llms.ContentPart{llms.TextPart(dataSummary)},
 		})
 
-		options := []llms.CallOption{
-			llms.WithTemperature(0.7),
-			llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-				text := string(chunk)
-				outputChan <- text
-				return nil
-			}),
-		}
+		temperature := defaultTemperature
+		options := s.profiles.resolve(ProfileReview).callOptions(&temperature)
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return sendStreamEvent(ctx, outputChan, StreamEvent{Content: string(chunk)})
+		}))
 
-		if _, err := s.client.DsChat.GenerateContent(ctx, messages, options...); err != nil {
+		resp, err := s.provider.GenerateContent(ctx, messages, options...)
+		if err != nil {
 			config.Logger.Errorw("生成复盘分析失败", "error", err)
-			outputChan <- fmt.Sprintf("生成复盘分析时出错: %v", err)
+			sendStreamEvent(ctx, outputChan, StreamEvent{Err: err})
 			return
 		}
+		sendStreamEvent(ctx, outputChan, StreamEvent{Usage: usageFromResponse(resp)})
 	}()
 
 	return outputChan, nil
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/services/fakellm"
+	"GoalifyGo/testutil"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// messageText 拼接消息中的文本内容
+func messageText(message llms.MessageContent) string {
+	var text strings.Builder
+	for _, part := range message.Parts {
+		if content, ok := part.(llms.TextContent); ok {
+			text.WriteString(content.Text)
+		}
+	}
+	return text.String()
+}
+
+// collectStream 读取流式事件直到通道关闭，返回拼接的内容和最后一个事件
+func collectStream(t *testing.T, stream <-chan StreamEvent) (string, StreamEvent) {
+	t.Helper()
+	var content strings.Builder
+	var last StreamEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				return content.String(), last
+			}
+			content.WriteString(event.Content)
+			last = event
+		case <-timeout:
+			t.Fatalf("流式事件通道没有关闭")
+		}
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	history := []ChatTurn{
+		{Role: models.MessageRoleUser, Content: strings.Repeat("一", 40)},
+		{Role: models.MessageRoleAssistant, Content: strings.Repeat("二", 30)},
+		{Role: models.MessageRoleUser, Content: strings.Repeat("三", 20)},
+		{Role: models.MessageRoleAssistant, Content: strings.Repeat("四", 10)},
+	}
+
+	cases := []struct {
+		budget int
+		want   int // 保留的最近消息数
+	}{
+		{budget: 100, want: 4},
+		{budget: 99, want: 3},
+		{budget: 60, want: 3},
+		{budget: 59, want: 2},
+		{budget: 9, want: 0},
+	}
+	for _, tc := range cases {
+		got := trimHistory(history, tc.budget)
+		if len(got) != tc.want {
+			t.Errorf("trimHistory(budget=%d) 保留 %d 条, want %d", tc.budget, len(got), tc.want)
+			continue
+		}
+		// 保留的是最近的消息
+		if tc.want > 0 && got[len(got)-1] != history[len(history)-1] {
+			t.Errorf("trimHistory(budget=%d) 丢弃了最近的消息", tc.budget)
+		}
+	}
+}
+
+func TestGenerateCoachResponseTrimsHistoryToBudget(t *testing.T) {
+	testutil.ObserveLogs(t)
+	model := fakellm.New(fakellm.Reply("好的"))
+	service := NewChatService(model, nil)
+
+	// 每条消息占预算的一半，只能保留最近两条
+	half := historyTokenBudget / 2
+	history := []ChatTurn{
+		{Role: models.MessageRoleUser, Content: "最早" + strings.Repeat("a", half-2)},
+		{Role: models.MessageRoleAssistant, Content: "较早" + strings.Repeat("b", half-2)},
+		{Role: models.MessageRoleUser, Content: "最近" + strings.Repeat("c", half-2)},
+	}
+
+	stream, err := service.GenerateCoachResponse(context.Background(), OrangeCoach, ChatScene, "新消息", history, "", "u1")
+	if err != nil {
+		t.Fatalf("GenerateCoachResponse: %v", err)
+	}
+	if content, last := collectStream(t, stream); content != "好的" || last.Usage == nil {
+		t.Fatalf("回复 = %q, 最后事件 = %+v", content, last)
+	}
+
+	calls := model.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("模型调用 %d 次, want 1", len(calls))
+	}
+	messages := calls[0].Messages
+	// 系统提示词、保留的两条历史消息和本轮消息
+	if len(messages) != 4 {
+		t.Fatalf("消息数 = %d, want 4", len(messages))
+	}
+	if !strings.HasPrefix(messageText(messages[1]), "较早") || messages[1].Role != schema.ChatMessageTypeAI {
+		t.Errorf("第一条历史消息 = %s %.10q, want 较早的助手消息", messages[1].Role, messageText(messages[1]))
+	}
+	if !strings.HasPrefix(messageText(messages[2]), "最近") || messages[2].Role != schema.ChatMessageTypeHuman {
+		t.Errorf("第二条历史消息 = %s %.10q, want 最近的用户消息", messages[2].Role, messageText(messages[2]))
+	}
+	if messageText(messages[3]) != "新消息" {
+		t.Errorf("最后一条消息 = %q, want 本轮消息", messageText(messages[3]))
+	}
+}
+
+func TestGenerateCoachResponseInjectsSummaryOnlyForEmotionScene(t *testing.T) {
+	testutil.ObserveLogs(t)
+	const summary = "用户最近因为考试感到焦虑"
+
+	cases := []struct {
+		coach AICoach
+		scene AIScene
+		want  bool
+	}{
+		{coach: OrangeCoach, scene: EmotionScene, want: true},
+		{coach: LogicCoach, scene: GoalScene, want: false},
+		{coach: OrangeCoach, scene: ChatScene, want: false},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.scene), func(t *testing.T) {
+			model := fakellm.New()
+			service := NewChatService(model, nil)
+			stream, err := service.GenerateCoachResponse(context.Background(), tc.coach, tc.scene, "你好", nil, summary, "u1")
+			if err != nil {
+				t.Fatalf("GenerateCoachResponse: %v", err)
+			}
+			collectStream(t, stream)
+
+			injected := false
+			for _, message := range model.Calls()[0].Messages {
+				if message.Role == schema.ChatMessageTypeSystem && strings.Contains(messageText(message), summary) {
+					injected = true
+				}
+			}
+			if injected != tc.want {
+				t.Errorf("注入对话总结 = %v, want %v", injected, tc.want)
+			}
+		})
+	}
+}
+
+func TestGenerateStreamsCloseWhenContextCancelled(t *testing.T) {
+	testutil.ObserveLogs(t)
+
+	start := map[string]func(ctx context.Context, service *ChatService) (<-chan StreamEvent, error){
+		"coach": func(ctx context.Context, service *ChatService) (<-chan StreamEvent, error) {
+			return service.GenerateCoachResponse(ctx, OrangeCoach, ChatScene, "你好", nil, "", "u1")
+		},
+		"review": func(ctx context.Context, service *ChatService) (<-chan StreamEvent, error) {
+			return service.GenerateReviewAnalysis(ctx, "day", nil, nil, "")
+		},
+	}
+	for name, generate := range start {
+		t.Run(name, func(t *testing.T) {
+			service := NewChatService(fakellm.New(fakellm.Reply(strings.Repeat("很长的回复", 50))), nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			stream, err := generate(ctx, service)
+			if err != nil {
+				t.Fatalf("启动生成失败: %v", err)
+			}
+			if event := <-stream; event.Content == "" {
+				t.Fatalf("第一个事件 = %+v, want 内容片段", event)
+			}
+
+			// 调用方断开后不再读取，生成协程应放弃发送并关闭通道
+			cancel()
+			done := make(chan struct{})
+			go func() {
+				service.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("取消后生成协程没有退出")
+			}
+			for event := range stream {
+				if event.Usage != nil {
+					t.Errorf("取消后不应返回用量: %+v", event)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateReviewAnalysisIncludesPreviousSummary(t *testing.T) {
+	testutil.ObserveLogs(t)
+	model := fakellm.New(fakellm.Reply("今天完成了计划"))
+	service := NewChatService(model, nil)
+
+	stream, err := service.GenerateReviewAnalysis(context.Background(), "day", nil, nil, "上次的复盘")
+	if err != nil {
+		t.Fatalf("GenerateReviewAnalysis: %v", err)
+	}
+	if content, last := collectStream(t, stream); content != "今天完成了计划" || last.Usage == nil {
+		t.Fatalf("回复 = %q, 最后事件 = %+v", content, last)
+	}
+
+	messages := model.Calls()[0].Messages
+	if !strings.Contains(messageText(messages[1]), "上次的复盘") {
+		t.Errorf("第二条消息 = %q, want 上一次的复盘总结", messageText(messages[1]))
+	}
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// App Store 内购相关错误
+var (
+	ErrAppStoreNotConfigured   = errors.New("未配置 App Store 内购")
+	ErrAppStoreBundleMismatch  = errors.New("交易不属于本应用")
+	ErrAppStoreEnvMismatch     = errors.New("交易环境不匹配")
+	ErrAppStoreUnknownProduct  = errors.New("未知的商品")
+	ErrAppStoreAccountMismatch = errors.New("交易不属于当前用户")
+	ErrAppStoreTransactionUsed = errors.New("交易已被其他用户使用")
+)
+
+// 订阅来源
+const subscriptionSourceAppStore = "appstore"
+
+// App Store 交易环境
+const (
+	appStoreEnvironmentProduction = "Production"
+	appStoreEnvironmentSandbox    = "Sandbox"
+)
+
+// App Store Server Notifications v2 通知类型
+const (
+	appStoreNotificationSubscribed         = "SUBSCRIBED"
+	appStoreNotificationDidRenew           = "DID_RENEW"
+	appStoreNotificationOfferRedeemed      = "OFFER_REDEEMED"
+	appStoreNotificationRefund             = "REFUND"
+	appStoreNotificationRevoke             = "REVOKE"
+	appStoreNotificationExpired            = "EXPIRED"
+	appStoreNotificationGracePeriodExpired = "GRACE_PERIOD_EXPIRED"
+)
+
+// AppStoreProduct 商品配置，能量包发放固定能量，订阅开通对应等级
+type AppStoreProduct struct {
+	Kind   string
+	Energy int
+	Tier   string
+}
+
+// appStoreConfig 内购配置，未配置根证书时为 nil
+type appStoreConfig struct {
+	verifier    *AppStoreVerifier
+	bundleID    string
+	environment string // 只接受该环境的交易，为空时不限制
+	products    map[string]AppStoreProduct
+}
+
+var appStore *appStoreConfig
+
+// ConfigureAppStore 根据配置加载根证书和商品；未配置根证书时内购接口不可用。
+// 未配置 APPSTORE_ENVIRONMENT 时，生产环境只接受 Production 交易，其他环境不限制
+func ConfigureAppStore(conf config.Config) error {
+	certPaths := config.SplitList(conf.AppStoreRootCerts)
+	if len(certPaths) == 0 {
+		appStore = nil
+		return nil
+	}
+	if conf.AppStoreBundleID == "" {
+		return errors.New("未配置 App Store Bundle ID")
+	}
+
+	verifier, err := NewAppStoreVerifier(certPaths)
+	if err != nil {
+		return err
+	}
+	products, err := ParseAppStoreProducts(conf.AppStoreProducts)
+	if err != nil {
+		return err
+	}
+
+	environment := conf.AppStoreEnvironment
+	switch {
+	case environment == "" && conf.Environment == "production":
+		environment = appStoreEnvironmentProduction
+	case environment == "", environment == appStoreEnvironmentProduction, environment == appStoreEnvironmentSandbox:
+	default:
+		return fmt.Errorf("无效的 App Store 环境: %s", environment)
+	}
+
+	appStore = &appStoreConfig{
+		verifier:    verifier,
+		bundleID:    conf.AppStoreBundleID,
+		environment: environment,
+		products:    products,
+	}
+	return nil
+}
+
+// checkAppStoreSource 校验交易或通知属于本应用和配置的环境
+func checkAppStoreSource(bundleID string, environment string) error {
+	if bundleID != appStore.bundleID {
+		return ErrAppStoreBundleMismatch
+	}
+	if appStore.environment != "" && environment != appStore.environment {
+		return ErrAppStoreEnvMismatch
+	}
+	return nil
+}
+
+// AppStoreVerifierInstance 返回配置的校验器，未配置时返回 ErrAppStoreNotConfigured
+func AppStoreVerifierInstance() (*AppStoreVerifier, error) {
+	if appStore == nil {
+		return nil, ErrAppStoreNotConfigured
+	}
+	return appStore.verifier, nil
+}
+
+// ParseAppStoreProducts 解析商品配置，格式为 "productId=energy:50" 或 "productId=tier:plus"，多项以逗号分隔
+func ParseAppStoreProducts(value string) (map[string]AppStoreProduct, error) {
+	products := make(map[string]AppStoreProduct)
+	for _, item := range config.SplitList(value) {
+		productID, spec, ok := strings.Cut(item, "=")
+		kind, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+		productID = strings.TrimSpace(productID)
+		if !ok || !hasArg || productID == "" {
+			return nil, fmt.Errorf("无效的商品配置: %s", item)
+		}
+
+		switch strings.TrimSpace(kind) {
+		case models.AppStoreKindEnergy:
+			energy, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil || energy <= 0 {
+				return nil, fmt.Errorf("无效的能量包数量: %s", item)
+			}
+			products[productID] = AppStoreProduct{Kind: models.AppStoreKindEnergy, Energy: energy}
+		case "tier":
+			tier := strings.TrimSpace(arg)
+			if tierRank[tier] == 0 {
+				return nil, fmt.Errorf("无效的订阅等级: %s", item)
+			}
+			products[productID] = AppStoreProduct{Kind: models.AppStoreKindSubscription, Tier: tier}
+		default:
+			return nil, fmt.Errorf("无效的商品类型: %s", item)
+		}
+	}
+	return products, nil
+}
+
+// PurchaseResult 交易处理结果
+type PurchaseResult struct {
+	Transaction      models.AppStoreTransaction `json:"transaction"`
+	AlreadyProcessed bool                       `json:"alreadyProcessed"` // 交易此前已发放过
+	Energy           int                        `json:"energy"`           // 处理后的能量余额
+	Entitlement      Entitlement                `json:"subscription"`
+}
+
+// ApplyAppStoreTransaction 为用户发放交易对应的能量或订阅，同一交易ID只发放一次。
+// 交易的 appAccountToken 必须是当前用户；没有 appAccountToken 时无法确认购买者，
+// 只接受原始交易此前已归属当前用户的交易（如订阅续费）
+func ApplyAppStoreTransaction(uid string, info *AppStoreTransactionInfo) (*PurchaseResult, error) {
+	if appStore == nil {
+		return nil, ErrAppStoreNotConfigured
+	}
+	if err := checkAppStoreSource(info.BundleID, info.Environment); err != nil {
+		return nil, err
+	}
+	if info.AppAccountToken != "" && !strings.EqualFold(info.AppAccountToken, uid) {
+		return nil, ErrAppStoreAccountMismatch
+	}
+	product, ok := appStore.products[info.ProductID]
+	if !ok {
+		return nil, ErrAppStoreUnknownProduct
+	}
+
+	result := &PurchaseResult{}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if info.AppAccountToken == "" {
+			owner, err := appStoreOriginalOwner(tx, info.OriginalTransactionID)
+			if err != nil {
+				return err
+			}
+			if owner != uid {
+				return ErrAppStoreAccountMismatch
+			}
+		}
+
+		transaction := models.AppStoreTransaction{
+			TransactionID:         info.TransactionID,
+			OriginalTransactionID: info.OriginalTransactionID,
+			UserID:                uid,
+			ProductID:             info.ProductID,
+			Kind:                  product.Kind,
+			Energy:                product.Energy,
+			Tier:                  product.Tier,
+			Environment:           info.Environment,
+			Status:                models.AppStoreTransactionCredited,
+			PurchasedAt:           appStoreTime(info.PurchaseDate),
+			ExpiresAt:             appStoreTimePtr(info.ExpiresDate),
+			CreatedAt:             time.Now(),
+		}
+		// 已退款的交易即使在退款通知之后才提交，也只记录不发放
+		if info.RevocationDate > 0 {
+			transaction.Status = models.AppStoreTransactionRevoked
+			transaction.RevokedAt = appStoreTimePtr(info.RevocationDate)
+		}
+
+		// 以交易ID为主键插入，已存在时不发放，并发重复提交只有一个能插入成功
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&transaction)
+		if created.Error != nil {
+			return fmt.Errorf("保存交易失败: %w", created.Error)
+		}
+		if created.RowsAffected == 0 {
+			if err := tx.Where("transaction_id = ?", info.TransactionID).First(&transaction).Error; err != nil {
+				return fmt.Errorf("查询交易失败: %w", err)
+			}
+			// 退款通知先于提交到达时记录的交易没有所属用户，只记录为已撤销，不再发放
+			unclaimedRevoked := transaction.UserID == "" && transaction.Status == models.AppStoreTransactionRevoked
+			if transaction.UserID != uid && !unclaimedRevoked {
+				return ErrAppStoreTransactionUsed
+			}
+			result.AlreadyProcessed = true
+		} else if transaction.Status == models.AppStoreTransactionCredited {
+			if err := creditAppStoreTransaction(tx, &transaction); err != nil {
+				return err
+			}
+		}
+		result.Transaction = transaction
+
+		var user models.User
+		if err := tx.Select("id", "energy").Where("id = ?", uid).First(&user).Error; err != nil {
+			return err
+		}
+		result.Energy = user.Energy
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entitlement, err := GetEntitlement(uid)
+	if err != nil {
+		return nil, err
+	}
+	result.Entitlement = entitlement
+	return result, nil
+}
+
+// appStoreOriginalOwner 返回原始交易此前归属的用户，没有记录时返回空字符串
+func appStoreOriginalOwner(tx *gorm.DB, originalTransactionID string) (string, error) {
+	var transaction models.AppStoreTransaction
+	err := tx.Where("original_transaction_id = ? AND user_id <> ?", originalTransactionID, "").
+		Order("created_at asc").
+		First(&transaction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("查询交易失败: %w", err)
+	}
+	return transaction.UserID, nil
+}
+
+// creditAppStoreTransaction 发放新交易的能量或订阅
+func creditAppStoreTransaction(tx *gorm.DB, transaction *models.AppStoreTransaction) error {
+	switch transaction.Kind {
+	case models.AppStoreKindEnergy:
+		_, err := ChangeEnergy(tx, transaction.UserID, transaction.Energy, models.EnergyReasonPurchase, transaction.TransactionID)
+		return err
+	case models.AppStoreKindSubscription:
+		if transaction.ExpiresAt == nil {
+			return errors.New("订阅交易缺少到期时间")
+		}
+		return extendAppStoreSubscription(tx, transaction, *transaction.ExpiresAt)
+	}
+	return nil
+}
+
+// extendAppStoreSubscription 开通或续期订阅；同一订阅（原始交易ID相同）的续费只会延长到期时间
+func extendAppStoreSubscription(tx *gorm.DB, transaction *models.AppStoreTransaction, expiresAt time.Time) error {
+	now := time.Now()
+	subscription := models.Subscription{
+		ID:        subscriptionSourceAppStore + "_" + transaction.OriginalTransactionID,
+		UserID:    transaction.UserID,
+		Tier:      transaction.Tier,
+		Source:    subscriptionSourceAppStore,
+		StartsAt:  transaction.PurchasedAt,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"tier":       subscription.Tier,
+			"expires_at": gorm.Expr("CASE WHEN expires_at < ? THEN ? ELSE expires_at END", expiresAt, expiresAt),
+			"updated_at": now,
+		}),
+	}).Create(&subscription).Error
+	if err != nil {
+		return fmt.Errorf("保存订阅失败: %w", err)
+	}
+	return nil
+}
+
+// revokeAppStoreTransaction 撤销已发放的交易：能量包在余额范围内扣回，订阅在撤销时间失效
+func revokeAppStoreTransaction(tx *gorm.DB, transaction *models.AppStoreTransaction, revokedAt time.Time) error {
+	if transaction.Status == models.AppStoreTransactionRevoked {
+		return nil
+	}
+
+	// 条件更新保证重复的退款通知只处理一次
+	updated := tx.Model(&models.AppStoreTransaction{}).
+		Where("transaction_id = ? AND status = ?", transaction.TransactionID, models.AppStoreTransactionCredited).
+		Updates(map[string]interface{}{
+			"status":     models.AppStoreTransactionRevoked,
+			"revoked_at": revokedAt,
+		})
+	if updated.Error != nil {
+		return fmt.Errorf("更新交易状态失败: %w", updated.Error)
+	}
+	if updated.RowsAffected == 0 {
+		return nil
+	}
+	transaction.Status = models.AppStoreTransactionRevoked
+	transaction.RevokedAt = &revokedAt
+
+	switch transaction.Kind {
+	case models.AppStoreKindEnergy:
+		// 已消耗的能量无法收回，最多扣到 0
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "energy").
+			Where("id = ?", transaction.UserID).
+			First(&user).Error; err != nil {
+			return err
+		}
+		clawback := transaction.Energy
+		if user.Energy < clawback {
+			clawback = user.Energy
+		}
+		if clawback <= 0 {
+			return nil
+		}
+		_, err := ChangeEnergy(tx, transaction.UserID, -clawback, models.EnergyReasonPurchaseRefund, transaction.TransactionID)
+		return err
+	case models.AppStoreKindSubscription:
+		err := tx.Model(&models.Subscription{}).
+			Where("id = ? AND expires_at > ?", subscriptionSourceAppStore+"_"+transaction.OriginalTransactionID, revokedAt).
+			Updates(map[string]interface{}{
+				"expires_at": revokedAt,
+				"updated_at": time.Now(),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("更新订阅失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// HandleAppStoreNotification 处理 App Store 服务器通知：续费发放订阅，退款和撤销收回权益，过期更新到期时间
+func HandleAppStoreNotification(notification *AppStoreNotification) error {
+	if appStore == nil {
+		return ErrAppStoreNotConfigured
+	}
+	if err := checkAppStoreSource(notification.Data.BundleID, notification.Data.Environment); err != nil {
+		return err
+	}
+	if notification.Data.SignedTransactionInfo == "" {
+		// 部分通知（如 TEST）不包含交易信息
+		config.Logger.Infow("忽略无交易信息的 App Store 通知", "type", notification.NotificationType, "notificationUUID", notification.NotificationUUID)
+		return nil
+	}
+
+	info, err := appStore.verifier.VerifyTransaction(notification.Data.SignedTransactionInfo)
+	if err != nil {
+		return err
+	}
+	if err := checkAppStoreSource(info.BundleID, info.Environment); err != nil {
+		return err
+	}
+
+	switch notification.NotificationType {
+	case appStoreNotificationSubscribed, appStoreNotificationDidRenew, appStoreNotificationOfferRedeemed:
+		uid, err := resolveAppStoreUser(info)
+		if err != nil {
+			return err
+		}
+		_, err = ApplyAppStoreTransaction(uid, info)
+		return err
+	case appStoreNotificationRefund, appStoreNotificationRevoke:
+		return RevokeAppStoreTransaction(info)
+	case appStoreNotificationExpired, appStoreNotificationGracePeriodExpired:
+		return expireAppStoreSubscription(info)
+	default:
+		config.Logger.Infow("忽略 App Store 通知", "type", notification.NotificationType, "subtype", notification.Subtype, "notificationUUID", notification.NotificationUUID)
+		return nil
+	}
+}
+
+// RevokeAppStoreTransaction 按退款或撤销通知收回交易对应的权益
+func RevokeAppStoreTransaction(info *AppStoreTransactionInfo) error {
+	revokedAt := time.Now()
+	if info.RevocationDate > 0 {
+		revokedAt = appStoreTime(info.RevocationDate)
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// 尚未发放的交易先记录为已撤销，之后客户端提交退款前签名的交易时不会再发放
+		product := appStore.products[info.ProductID]
+		tombstone := models.AppStoreTransaction{
+			TransactionID:         info.TransactionID,
+			OriginalTransactionID: info.OriginalTransactionID,
+			ProductID:             info.ProductID,
+			Kind:                  product.Kind,
+			Energy:                product.Energy,
+			Tier:                  product.Tier,
+			Environment:           info.Environment,
+			Status:                models.AppStoreTransactionRevoked,
+			PurchasedAt:           appStoreTime(info.PurchaseDate),
+			ExpiresAt:             appStoreTimePtr(info.ExpiresDate),
+			RevokedAt:             &revokedAt,
+			CreatedAt:             time.Now(),
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tombstone)
+		if created.Error != nil {
+			return fmt.Errorf("保存交易失败: %w", created.Error)
+		}
+		if created.RowsAffected > 0 {
+			config.Logger.Infow("退款交易尚未发放", "transactionID", info.TransactionID)
+			return nil
+		}
+
+		var transaction models.AppStoreTransaction
+		if err := tx.Where("transaction_id = ?", info.TransactionID).First(&transaction).Error; err != nil {
+			return fmt.Errorf("查询交易失败: %w", err)
+		}
+		return revokeAppStoreTransaction(tx, &transaction, revokedAt)
+	})
+}
+
+// expireAppStoreSubscription 订阅过期时将到期时间同步为交易的到期时间
+func expireAppStoreSubscription(info *AppStoreTransactionInfo) error {
+	if info.ExpiresDate == 0 {
+		return nil
+	}
+	err := config.DB.Model(&models.Subscription{}).
+		Where("id = ? AND expires_at > ?", subscriptionSourceAppStore+"_"+info.OriginalTransactionID, appStoreTime(info.ExpiresDate)).
+		Updates(map[string]interface{}{
+			"expires_at": appStoreTime(info.ExpiresDate),
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("更新订阅失败: %w", err)
+	}
+	return nil
+}
+
+// resolveAppStoreUser 优先使用交易中的 appAccountToken，否则按原始交易ID查找此前处理过的交易
+func resolveAppStoreUser(info *AppStoreTransactionInfo) (string, error) {
+	if info.AppAccountToken != "" {
+		var user models.User
+		err := config.DB.Select("id").Where("id = ?", strings.ToLower(info.AppAccountToken)).First(&user).Error
+		if err == nil {
+			return user.ID, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+	}
+
+	owner, err := appStoreOriginalOwner(config.DB, info.OriginalTransactionID)
+	if err != nil {
+		return "", err
+	}
+	if owner == "" {
+		return "", fmt.Errorf("无法确定交易所属用户 %s", info.TransactionID)
+	}
+	return owner, nil
+}
+
+// appStoreTime 将 App Store 的毫秒时间戳转换为时间
+func appStoreTime(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
+
+func appStoreTimePtr(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	t := appStoreTime(ms)
+	return &t
+}
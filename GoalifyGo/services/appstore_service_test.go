@@ -0,0 +1,354 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	testBundleID            = "com.goalify.app"
+	testEnergyProduct       = "com.goalify.energy50"
+	testSubscriptionProduct = "com.goalify.plus.monthly"
+	testEnergyAmount        = 50
+	appStoreTestEnergy      = 10
+)
+
+// setupAppStore 配置测试用的 App Store 内购，并创建用户 user-1 和 user-2
+func setupAppStore(t *testing.T, chain *testCertChain) *gorm.DB {
+	t.Helper()
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.EnergyLedgerEntry{}, &models.Subscription{}, &models.AppStoreTransaction{})
+	for _, uid := range []string{"user-1", "user-2"} {
+		if err := db.Create(&models.User{ID: uid, Energy: appStoreTestEnergy}).Error; err != nil {
+			t.Fatalf("创建测试用户失败: %v", err)
+		}
+	}
+
+	previous := appStore
+	appStore = &appStoreConfig{
+		bundleID:    testBundleID,
+		environment: appStoreEnvironmentProduction,
+		products: map[string]AppStoreProduct{
+			testEnergyProduct:       {Kind: models.AppStoreKindEnergy, Energy: testEnergyAmount},
+			testSubscriptionProduct: {Kind: models.AppStoreKindSubscription, Tier: models.TierPlus},
+		},
+	}
+	if chain != nil {
+		appStore.verifier = chain.verifier(t)
+	}
+	t.Cleanup(func() { appStore = previous })
+	return db
+}
+
+// userEnergy 读取用户能量
+func userEnergy(t *testing.T, db *gorm.DB, uid string) int {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, "id = ?", uid).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	return user.Energy
+}
+
+// testSubscriptionInfo 返回一笔订阅交易，到期时间为 expiresAt
+func testSubscriptionInfo(transactionID string, originalTransactionID string, uid string, expiresAt time.Time) *AppStoreTransactionInfo {
+	info := testTransactionInfo(transactionID, uid)
+	info.OriginalTransactionID = originalTransactionID
+	info.ProductID = testSubscriptionProduct
+	info.Type = "Auto-Renewable Subscription"
+	info.ExpiresDate = expiresAt.UnixMilli()
+	return info
+}
+
+func TestApplyAppStoreTransactionCreditsOnce(t *testing.T) {
+	db := setupAppStore(t, nil)
+	info := testTransactionInfo("1000000001", "user-1")
+
+	result, err := ApplyAppStoreTransaction("user-1", info)
+	if err != nil {
+		t.Fatalf("ApplyAppStoreTransaction: %v", err)
+	}
+	if result.AlreadyProcessed || result.Energy != appStoreTestEnergy+testEnergyAmount {
+		t.Fatalf("result = %+v, want energy %d", result, appStoreTestEnergy+testEnergyAmount)
+	}
+
+	// 重放同一交易不会重复发放
+	result, err = ApplyAppStoreTransaction("user-1", info)
+	if err != nil {
+		t.Fatalf("重放交易: %v", err)
+	}
+	if !result.AlreadyProcessed || result.Energy != appStoreTestEnergy+testEnergyAmount {
+		t.Errorf("重放 result = %+v, want already processed without credit", result)
+	}
+
+	// 其他用户提交同一交易
+	if _, err := ApplyAppStoreTransaction("user-2", info); !errors.Is(err, ErrAppStoreAccountMismatch) {
+		t.Errorf("其他用户提交 error = %v, want ErrAppStoreAccountMismatch", err)
+	}
+	if energy := userEnergy(t, db, "user-2"); energy != appStoreTestEnergy {
+		t.Errorf("user-2 energy = %d, want %d", energy, appStoreTestEnergy)
+	}
+}
+
+func TestApplyAppStoreTransactionRejects(t *testing.T) {
+	cases := []struct {
+		name string
+		uid  string
+		info func() *AppStoreTransactionInfo
+		want error
+	}{
+		{
+			name: "bundle",
+			uid:  "user-1",
+			info: func() *AppStoreTransactionInfo {
+				info := testTransactionInfo("1000000001", "user-1")
+				info.BundleID = "com.other.app"
+				return info
+			},
+			want: ErrAppStoreBundleMismatch,
+		},
+		{
+			name: "sandbox in production",
+			uid:  "user-1",
+			info: func() *AppStoreTransactionInfo {
+				info := testTransactionInfo("1000000001", "user-1")
+				info.Environment = appStoreEnvironmentSandbox
+				return info
+			},
+			want: ErrAppStoreEnvMismatch,
+		},
+		{
+			name: "unknown product",
+			uid:  "user-1",
+			info: func() *AppStoreTransactionInfo {
+				info := testTransactionInfo("1000000001", "user-1")
+				info.ProductID = "com.goalify.energy5000"
+				return info
+			},
+			want: ErrAppStoreUnknownProduct,
+		},
+		{
+			name: "other user's token",
+			uid:  "user-2",
+			info: func() *AppStoreTransactionInfo { return testTransactionInfo("1000000001", "user-1") },
+			want: ErrAppStoreAccountMismatch,
+		},
+		{
+			// 没有 appAccountToken 的新交易无法确认购买者
+			name: "empty token",
+			uid:  "user-2",
+			info: func() *AppStoreTransactionInfo { return testTransactionInfo("1000000001", "") },
+			want: ErrAppStoreAccountMismatch,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupAppStore(t, nil)
+			if _, err := ApplyAppStoreTransaction(tc.uid, tc.info()); !errors.Is(err, tc.want) {
+				t.Errorf("error = %v, want %v", err, tc.want)
+			}
+			var count int64
+			db.Model(&models.AppStoreTransaction{}).Count(&count)
+			if count != 0 || userEnergy(t, db, tc.uid) != appStoreTestEnergy {
+				t.Errorf("被拒绝的交易不应保存或发放")
+			}
+		})
+	}
+}
+
+func TestApplyAppStoreTransactionRenewalWithoutToken(t *testing.T) {
+	db := setupAppStore(t, nil)
+	now := time.Now()
+	firstExpiry := now.Add(30 * 24 * time.Hour).Truncate(time.Millisecond)
+	renewedExpiry := firstExpiry.Add(30 * 24 * time.Hour)
+
+	if _, err := ApplyAppStoreTransaction("user-1", testSubscriptionInfo("2000000001", "2000000001", "user-1", firstExpiry)); err != nil {
+		t.Fatalf("首次订阅: %v", err)
+	}
+
+	// 续费交易没有 appAccountToken，原始交易已归属 user-1
+	renewal := testSubscriptionInfo("2000000002", "2000000001", "", renewedExpiry)
+	if _, err := ApplyAppStoreTransaction("user-2", renewal); !errors.Is(err, ErrAppStoreAccountMismatch) {
+		t.Errorf("其他用户提交续费 error = %v, want ErrAppStoreAccountMismatch", err)
+	}
+	result, err := ApplyAppStoreTransaction("user-1", renewal)
+	if err != nil {
+		t.Fatalf("续费: %v", err)
+	}
+	if result.Entitlement.Tier != models.TierPlus || !result.Entitlement.ExpiresAt.Equal(renewedExpiry) {
+		t.Errorf("entitlement = %+v, want plus until %v", result.Entitlement, renewedExpiry)
+	}
+
+	// 较早的续费交易不会缩短到期时间
+	if _, err := ApplyAppStoreTransaction("user-1", testSubscriptionInfo("2000000003", "2000000001", "", firstExpiry)); err != nil {
+		t.Fatalf("补交较早的续费: %v", err)
+	}
+	var subscription models.Subscription
+	if err := db.First(&subscription, "id = ?", subscriptionSourceAppStore+"_2000000001").Error; err != nil {
+		t.Fatalf("查询订阅失败: %v", err)
+	}
+	if !subscription.ExpiresAt.Equal(renewedExpiry) {
+		t.Errorf("expires_at = %v, want %v", subscription.ExpiresAt, renewedExpiry)
+	}
+}
+
+func TestAppStoreRefund(t *testing.T) {
+	refundedAt := time.Now().Add(-time.Minute)
+
+	t.Run("refund before purchase", func(t *testing.T) {
+		setupAppStore(t, nil)
+		info := testTransactionInfo("1000000001", "user-1")
+
+		// 退款通知先到达，之后客户端提交退款前签名的交易
+		refunded := *info
+		refunded.RevocationDate = refundedAt.UnixMilli()
+		if err := RevokeAppStoreTransaction(&refunded); err != nil {
+			t.Fatalf("RevokeAppStoreTransaction: %v", err)
+		}
+		result, err := ApplyAppStoreTransaction("user-1", info)
+		if err != nil {
+			t.Fatalf("ApplyAppStoreTransaction: %v", err)
+		}
+		if result.Transaction.Status != models.AppStoreTransactionRevoked || result.Energy != appStoreTestEnergy {
+			t.Errorf("result = %+v, want revoked without credit", result)
+		}
+	})
+
+	t.Run("submitted with revocation date", func(t *testing.T) {
+		db := setupAppStore(t, nil)
+		info := testTransactionInfo("1000000001", "user-1")
+		info.RevocationDate = refundedAt.UnixMilli()
+
+		result, err := ApplyAppStoreTransaction("user-1", info)
+		if err != nil {
+			t.Fatalf("ApplyAppStoreTransaction: %v", err)
+		}
+		if result.Transaction.Status != models.AppStoreTransactionRevoked || userEnergy(t, db, "user-1") != appStoreTestEnergy {
+			t.Errorf("result = %+v, want revoked without credit", result)
+		}
+	})
+
+	t.Run("refund after purchase", func(t *testing.T) {
+		db := setupAppStore(t, nil)
+		info := testTransactionInfo("1000000001", "user-1")
+		if _, err := ApplyAppStoreTransaction("user-1", info); err != nil {
+			t.Fatalf("ApplyAppStoreTransaction: %v", err)
+		}
+
+		refunded := *info
+		refunded.RevocationDate = refundedAt.UnixMilli()
+		for i := 0; i < 2; i++ {
+			// 重复的退款通知只扣回一次
+			if err := RevokeAppStoreTransaction(&refunded); err != nil {
+				t.Fatalf("RevokeAppStoreTransaction: %v", err)
+			}
+		}
+		if energy := userEnergy(t, db, "user-1"); energy != appStoreTestEnergy {
+			t.Errorf("energy = %d, want %d", energy, appStoreTestEnergy)
+		}
+	})
+}
+
+func TestHandleAppStoreNotification(t *testing.T) {
+	chain := newTestCertChain(t, testChainOptions{})
+
+	notification := func(signedTransaction string) *AppStoreNotification {
+		n := &AppStoreNotification{NotificationType: appStoreNotificationRefund, NotificationUUID: "uuid-1"}
+		n.Data.BundleID = testBundleID
+		n.Data.Environment = appStoreEnvironmentProduction
+		n.Data.SignedTransactionInfo = signedTransaction
+		return n
+	}
+
+	t.Run("refund", func(t *testing.T) {
+		db := setupAppStore(t, chain)
+		info := testTransactionInfo("1000000001", "user-1")
+		if _, err := ApplyAppStoreTransaction("user-1", info); err != nil {
+			t.Fatalf("ApplyAppStoreTransaction: %v", err)
+		}
+
+		info.RevocationDate = time.Now().UnixMilli()
+		if err := HandleAppStoreNotification(notification(chain.sign(t, info))); err != nil {
+			t.Fatalf("HandleAppStoreNotification: %v", err)
+		}
+		if energy := userEnergy(t, db, "user-1"); energy != appStoreTestEnergy {
+			t.Errorf("energy = %d, want %d", energy, appStoreTestEnergy)
+		}
+	})
+
+	t.Run("sandbox notification", func(t *testing.T) {
+		setupAppStore(t, chain)
+		n := notification(chain.sign(t, testTransactionInfo("1000000001", "user-1")))
+		n.Data.Environment = appStoreEnvironmentSandbox
+		if err := HandleAppStoreNotification(n); !errors.Is(err, ErrAppStoreEnvMismatch) {
+			t.Errorf("error = %v, want ErrAppStoreEnvMismatch", err)
+		}
+	})
+
+	t.Run("sandbox transaction", func(t *testing.T) {
+		setupAppStore(t, chain)
+		info := testTransactionInfo("1000000001", "user-1")
+		info.Environment = appStoreEnvironmentSandbox
+		if err := HandleAppStoreNotification(notification(chain.sign(t, info))); !errors.Is(err, ErrAppStoreEnvMismatch) {
+			t.Errorf("error = %v, want ErrAppStoreEnvMismatch", err)
+		}
+	})
+
+	t.Run("invalid inner transaction", func(t *testing.T) {
+		setupAppStore(t, chain)
+		// 内层交易签名无效时返回错误，由接口返回非 200 让 App Store 重试
+		untrusted := newTestCertChain(t, testChainOptions{})
+		err := HandleAppStoreNotification(notification(untrusted.sign(t, testTransactionInfo("1000000001", "user-1"))))
+		if !errors.Is(err, ErrInvalidSignedPayload) {
+			t.Errorf("error = %v, want ErrInvalidSignedPayload", err)
+		}
+	})
+}
+
+func TestConfigureAppStoreEnvironment(t *testing.T) {
+	previous := appStore
+	t.Cleanup(func() { appStore = previous })
+	rootPath := newTestCertChain(t, testChainOptions{}).writeRootPEM(t)
+
+	cases := []struct {
+		name        string
+		environment string
+		appStoreEnv string
+		want        string
+		wantErr     bool
+	}{
+		{name: "production defaults to Production", environment: "production", want: appStoreEnvironmentProduction},
+		{name: "development accepts any", environment: "development", want: ""},
+		{name: "explicit sandbox", environment: "production", appStoreEnv: appStoreEnvironmentSandbox, want: appStoreEnvironmentSandbox},
+		{name: "invalid", appStoreEnv: "staging", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ConfigureAppStore(config.Config{
+				Environment:         tc.environment,
+				AppStoreBundleID:    testBundleID,
+				AppStoreRootCerts:   rootPath,
+				AppStoreEnvironment: tc.appStoreEnv,
+			})
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("应返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigureAppStore: %v", err)
+			}
+			if appStore.environment != tc.want {
+				t.Errorf("environment = %q, want %q", appStore.environment, tc.want)
+			}
+		})
+	}
+}
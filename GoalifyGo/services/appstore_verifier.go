@@ -0,0 +1,221 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Apple 在 App Store 签名证书链中使用的扩展 OID
+var (
+	appStoreLeafOID         = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	appStoreIntermediateOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+// ErrInvalidSignedPayload App Store 签名数据校验失败
+var ErrInvalidSignedPayload = errors.New("无效的 App Store 签名数据")
+
+// AppStoreTransactionInfo 解码后的 App Store 交易（JWSTransactionDecodedPayload）
+type AppStoreTransactionInfo struct {
+	TransactionID         string `json:"transactionId"`
+	OriginalTransactionID string `json:"originalTransactionId"`
+	BundleID              string `json:"bundleId"`
+	ProductID             string `json:"productId"`
+	Type                  string `json:"type"`
+	PurchaseDate          int64  `json:"purchaseDate"`   // 毫秒时间戳
+	ExpiresDate           int64  `json:"expiresDate"`    // 订阅到期时间，毫秒时间戳
+	RevocationDate        int64  `json:"revocationDate"` // 退款或撤销时间，毫秒时间戳
+	Quantity              int    `json:"quantity"`
+	AppAccountToken       string `json:"appAccountToken"` // 客户端购买时传入的用户ID
+	Environment           string `json:"environment"`
+	SignedDate            int64  `json:"signedDate"` // 签名时间，毫秒时间戳
+}
+
+// Valid 实现 jwt.Claims，交易数据没有 exp 等标准字段
+func (AppStoreTransactionInfo) Valid() error {
+	return nil
+}
+
+func (info *AppStoreTransactionInfo) signedAt() int64 {
+	return info.SignedDate
+}
+
+// AppStoreNotification 解码后的 App Store Server Notifications v2 通知
+type AppStoreNotification struct {
+	NotificationType string `json:"notificationType"`
+	Subtype          string `json:"subtype"`
+	NotificationUUID string `json:"notificationUUID"`
+	SignedDate       int64  `json:"signedDate"` // 签名时间，毫秒时间戳
+	Data             struct {
+		BundleID              string `json:"bundleId"`
+		Environment           string `json:"environment"`
+		SignedTransactionInfo string `json:"signedTransactionInfo"`
+	} `json:"data"`
+}
+
+// Valid 实现 jwt.Claims
+func (AppStoreNotification) Valid() error {
+	return nil
+}
+
+func (notification *AppStoreNotification) signedAt() int64 {
+	return notification.SignedDate
+}
+
+// signedClaims 带签名时间的 App Store 签名数据
+type signedClaims interface {
+	jwt.Claims
+	signedAt() int64
+}
+
+// AppStoreVerifier 使用配置的根证书校验 App Store 签名数据（JWS）
+type AppStoreVerifier struct {
+	roots *x509.CertPool
+}
+
+// NewAppStoreVerifier 从证书文件加载根证书，支持 PEM 和 DER 格式
+func NewAppStoreVerifier(certPaths []string) (*AppStoreVerifier, error) {
+	roots := x509.NewCertPool()
+	for _, path := range certPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取根证书失败 %s: %w", path, err)
+		}
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("解析根证书失败 %s: %w", path, err)
+		}
+		for _, cert := range certs {
+			roots.AddCert(cert)
+		}
+	}
+	return &AppStoreVerifier{roots: roots}, nil
+}
+
+// parseCertificates 解析 PEM 或 DER 格式的证书
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		data = rest
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	return x509.ParseCertificates(data)
+}
+
+// VerifyTransaction 校验并解码签名交易
+func (v *AppStoreVerifier) VerifyTransaction(signed string) (*AppStoreTransactionInfo, error) {
+	var info AppStoreTransactionInfo
+	if err := v.verify(signed, &info); err != nil {
+		return nil, err
+	}
+	if info.TransactionID == "" || info.ProductID == "" {
+		return nil, fmt.Errorf("%w: 缺少交易ID或商品ID", ErrInvalidSignedPayload)
+	}
+	return &info, nil
+}
+
+// VerifyNotification 校验并解码服务器通知
+func (v *AppStoreVerifier) VerifyNotification(signed string) (*AppStoreNotification, error) {
+	var notification AppStoreNotification
+	if err := v.verify(signed, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// verify 校验 x5c 证书链可追溯到配置的根证书，并用叶子证书公钥校验 ES256 签名。
+// 证书链按签名时间（signedDate）校验，与 Apple 的做法一致：证书过期前签发的数据在过期后仍然有效
+func (v *AppStoreVerifier) verify(signed string, claims signedClaims) error {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
+	_, err := parser.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		// 解析签名前数据已解码，但尚未校验，签名时间只用于选择证书的校验时间
+		verifyAt := time.Now()
+		if ms := claims.signedAt(); ms > 0 {
+			verifyAt = time.UnixMilli(ms)
+		}
+		return v.leafKey(token, verifyAt)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignedPayload, err)
+	}
+	return nil
+}
+
+// leafKey 校验 JWS 头部的证书链在 verifyAt 时有效，并返回叶子证书公钥
+func (v *AppStoreVerifier) leafKey(token *jwt.Token, verifyAt time.Time) (interface{}, error) {
+	chain, ok := token.Header["x5c"].([]interface{})
+	if !ok || len(chain) < 2 {
+		return nil, errors.New("缺少证书链")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, item := range chain {
+		encoded, ok := item.(string)
+		if !ok {
+			return nil, errors.New("无效的证书链")
+		}
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("无效的证书编码: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("无效的证书: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("证书链校验失败: %w", err)
+	}
+
+	if !hasExtension(leaf, appStoreLeafOID) || !hasExtension(certs[1], appStoreIntermediateOID) {
+		return nil, errors.New("证书不是 App Store 签名证书")
+	}
+
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("叶子证书不是 ECDSA 公钥")
+	}
+	return key, nil
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// asn1Null 测试证书中 Apple 扩展的值
+var asn1Null = []byte{0x05, 0x00}
+
+// testCertChain 本地生成的 App Store 签名证书链
+type testCertChain struct {
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	leaf         *x509.Certificate
+	leafKey      crypto.Signer
+}
+
+// testChainOptions 生成证书链的选项，零值为合法的证书链
+type testChainOptions struct {
+	omitLeafOID         bool
+	omitIntermediateOID bool
+	leafCurve           elliptic.Curve // 为空时使用 P-256
+	leafNotBefore       time.Time      // 为空时为一年前
+	leafNotAfter        time.Time      // 为空时为一年后
+}
+
+var testCertSerial int64
+
+// issueTestCert 用 parent 签发证书，parent 为空时自签名
+func issueTestCert(t *testing.T, template *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	testCertSerial++
+	template.SerialNumber = big.NewInt(testCertSerial)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("签发测试证书失败: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("解析测试证书失败: %v", err)
+	}
+	return cert
+}
+
+func newTestKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("生成测试密钥失败: %v", err)
+	}
+	return key
+}
+
+// newTestCertChain 生成自签名根证书、带 Apple 中间证书 OID 的中间证书和带 App Store 收据 OID 的叶子证书
+func newTestCertChain(t *testing.T, opts testChainOptions) *testCertChain {
+	t.Helper()
+
+	now := time.Now()
+	rootKey := newTestKey(t, elliptic.P256())
+	root := issueTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             now.Add(-10 * 365 * 24 * time.Hour),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, rootKey, nil, nil)
+
+	intermediateTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test WWDR Intermediate"},
+		NotBefore:             now.Add(-5 * 365 * 24 * time.Hour),
+		NotAfter:              now.Add(5 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if !opts.omitIntermediateOID {
+		intermediateTemplate.ExtraExtensions = []pkix.Extension{{Id: appStoreIntermediateOID, Value: asn1Null}}
+	}
+	intermediateKey := newTestKey(t, elliptic.P256())
+	intermediate := issueTestCert(t, intermediateTemplate, intermediateKey, root, rootKey)
+
+	curve := opts.leafCurve
+	if curve == nil {
+		curve = elliptic.P256()
+	}
+	notBefore, notAfter := opts.leafNotBefore, opts.leafNotAfter
+	if notBefore.IsZero() {
+		notBefore = now.Add(-365 * 24 * time.Hour)
+	}
+	if notAfter.IsZero() {
+		notAfter = now.Add(365 * 24 * time.Hour)
+	}
+	leafTemplate := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Test App Store Receipt Signing"},
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	if !opts.omitLeafOID {
+		leafTemplate.ExtraExtensions = []pkix.Extension{{Id: appStoreLeafOID, Value: asn1Null}}
+	}
+	leafKey := newTestKey(t, curve)
+	leaf := issueTestCert(t, leafTemplate, leafKey, intermediate, intermediateKey)
+
+	return &testCertChain{root: root, intermediate: intermediate, leaf: leaf, leafKey: leafKey}
+}
+
+// writeRootPEM 将根证书写入临时 PEM 文件并返回路径
+func (c *testCertChain) writeRootPEM(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "root.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.root.Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("写入根证书失败: %v", err)
+	}
+	return path
+}
+
+// verifier 返回信任该证书链根证书的校验器
+func (c *testCertChain) verifier(t *testing.T) *AppStoreVerifier {
+	t.Helper()
+	verifier, err := NewAppStoreVerifier([]string{c.writeRootPEM(t)})
+	if err != nil {
+		t.Fatalf("创建校验器失败: %v", err)
+	}
+	return verifier
+}
+
+// sign 用叶子证书私钥以 ES256 签名，并在头部附带 x5c 证书链
+func (c *testCertChain) sign(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+	return c.signWith(t, jwt.SigningMethodES256, c.leafKey, claims)
+}
+
+func (c *testCertChain) signWith(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["x5c"] = []string{
+		base64.StdEncoding.EncodeToString(c.leaf.Raw),
+		base64.StdEncoding.EncodeToString(c.intermediate.Raw),
+		base64.StdEncoding.EncodeToString(c.root.Raw),
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签名测试数据失败: %v", err)
+	}
+	return signed
+}
+
+// testTransactionInfo 返回一笔合法的能量包交易
+func testTransactionInfo(transactionID string, uid string) *AppStoreTransactionInfo {
+	now := time.Now()
+	return &AppStoreTransactionInfo{
+		TransactionID:         transactionID,
+		OriginalTransactionID: transactionID,
+		BundleID:              testBundleID,
+		ProductID:             testEnergyProduct,
+		Type:                  "Consumable",
+		PurchaseDate:          now.UnixMilli(),
+		Quantity:              1,
+		AppAccountToken:       uid,
+		Environment:           appStoreEnvironmentProduction,
+		SignedDate:            now.UnixMilli(),
+	}
+}
+
+func TestAppStoreVerifierVerifyTransaction(t *testing.T) {
+	chain := newTestCertChain(t, testChainOptions{})
+	verifier := chain.verifier(t)
+
+	info := testTransactionInfo("1000000001", "user-1")
+	got, err := verifier.VerifyTransaction(chain.sign(t, info))
+	if err != nil {
+		t.Fatalf("VerifyTransaction: %v", err)
+	}
+	if *got != *info {
+		t.Errorf("decoded = %+v, want %+v", got, info)
+	}
+}
+
+func TestAppStoreVerifierRejectsInvalidPayload(t *testing.T) {
+	now := time.Now()
+	info := testTransactionInfo("1000000001", "user-1")
+
+	cases := []struct {
+		name string
+		opts testChainOptions
+		// untrusted 为 true 时校验器信任另一条证书链的根证书
+		untrusted bool
+		// sign 生成待校验的签名数据，为空时以 ES256 正常签名
+		sign func(t *testing.T, chain *testCertChain) string
+	}{
+		{name: "wrong root", untrusted: true},
+		{name: "leaf without receipt OID", opts: testChainOptions{omitLeafOID: true}},
+		{name: "intermediate without WWDR OID", opts: testChainOptions{omitIntermediateOID: true}},
+		{
+			name: "ES384",
+			opts: testChainOptions{leafCurve: elliptic.P384()},
+			sign: func(t *testing.T, chain *testCertChain) string {
+				return chain.signWith(t, jwt.SigningMethodES384, chain.leafKey, info)
+			},
+		},
+		{
+			// 以证书内容作为 HMAC 密钥伪造签名
+			name: "HS256",
+			sign: func(t *testing.T, chain *testCertChain) string {
+				return chain.signWith(t, jwt.SigningMethodHS256, chain.leaf.Raw, info)
+			},
+		},
+		{
+			name: "tampered payload",
+			sign: func(t *testing.T, chain *testCertChain) string {
+				forged := *info
+				forged.ProductID = "com.goalify.energy5000"
+				valid := strings.Split(chain.sign(t, info), ".")
+				payload := strings.Split(chain.sign(t, &forged), ".")[1]
+				return valid[0] + "." + payload + "." + valid[2]
+			},
+		},
+		{
+			name: "missing chain",
+			sign: func(t *testing.T, chain *testCertChain) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, info).SignedString(chain.leafKey)
+				if err != nil {
+					t.Fatalf("签名测试数据失败: %v", err)
+				}
+				return signed
+			},
+		},
+		{
+			// 叶子证书已过期，签名时间也在过期之后
+			name: "signed after leaf expired",
+			opts: testChainOptions{leafNotBefore: now.Add(-48 * time.Hour), leafNotAfter: now.Add(-24 * time.Hour)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := newTestCertChain(t, tc.opts)
+			verifier := chain.verifier(t)
+			if tc.untrusted {
+				verifier = newTestCertChain(t, testChainOptions{}).verifier(t)
+			}
+
+			signed := chain.sign
+			if tc.sign != nil {
+				signed = func(t *testing.T, _ jwt.Claims) string { return tc.sign(t, chain) }
+			}
+			if _, err := verifier.VerifyTransaction(signed(t, info)); !errors.Is(err, ErrInvalidSignedPayload) {
+				t.Errorf("VerifyTransaction error = %v, want ErrInvalidSignedPayload", err)
+			}
+		})
+	}
+}
+
+func TestAppStoreVerifierUsesSignedDate(t *testing.T) {
+	now := time.Now()
+	// 叶子证书一天前已过期
+	chain := newTestCertChain(t, testChainOptions{
+		leafNotBefore: now.Add(-72 * time.Hour),
+		leafNotAfter:  now.Add(-24 * time.Hour),
+	})
+	verifier := chain.verifier(t)
+
+	// 证书有效期内签名的数据在证书过期后仍然有效
+	info := testTransactionInfo("1000000001", "user-1")
+	info.SignedDate = now.Add(-48 * time.Hour).UnixMilli()
+	if _, err := verifier.VerifyTransaction(chain.sign(t, info)); err != nil {
+		t.Errorf("证书有效期内签名的交易应通过校验: %v", err)
+	}
+
+	// 没有签名时间时按当前时间校验
+	info.SignedDate = 0
+	if _, err := verifier.VerifyTransaction(chain.sign(t, info)); !errors.Is(err, ErrInvalidSignedPayload) {
+		t.Errorf("VerifyTransaction error = %v, want ErrInvalidSignedPayload", err)
+	}
+}
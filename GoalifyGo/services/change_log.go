@@ -0,0 +1,149 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 同步游标前缀，用于区分游标版本
+const syncCursorPrefix = "v1:"
+
+// RecordChange 在事务中为实体分配新的同步序号并写入变更日志。
+// 递增 users.sync_seq 会持有该用户行锁直到事务结束，保证同一用户的序号提交顺序与分配顺序一致。
+func RecordChange(tx *gorm.DB, uid string, entityType string, entityID string) (int64, error) {
+	if err := tx.Model(&models.User{}).Where("id = ?", uid).
+		UpdateColumn("sync_seq", gorm.Expr("sync_seq + 1")).Error; err != nil {
+		return 0, fmt.Errorf("分配同步序号失败: %w", err)
+	}
+
+	var seq int64
+	if err := tx.Model(&models.User{}).Where("id = ?", uid).
+		Pluck("sync_seq", &seq).Error; err != nil {
+		return 0, fmt.Errorf("读取同步序号失败: %w", err)
+	}
+
+	change := models.SyncChange{
+		UserID:     uid,
+		Seq:        seq,
+		EntityType: entityType,
+		EntityID:   entityID,
+		ChangedAt:  time.Now(),
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"seq", "changed_at"}),
+	}).Create(&change).Error; err != nil {
+		return 0, fmt.Errorf("写入变更日志失败: %w", err)
+	}
+
+	return seq, nil
+}
+
+// ListChanges 按序号升序返回 afterSeq 之后的变更
+func ListChanges(uid string, afterSeq int64, limit int) ([]models.SyncChange, error) {
+	var changes []models.SyncChange
+	err := config.DB.Where("user_id = ? AND seq > ?", uid, afterSeq).
+		Order("seq asc").
+		Limit(limit).
+		Find(&changes).Error
+	return changes, err
+}
+
+// CurrentSeq 返回用户当前的同步序号
+func CurrentSeq(uid string) (int64, error) {
+	var seq int64
+	err := config.DB.Model(&models.User{}).Where("id = ?", uid).Pluck("sync_seq", &seq).Error
+	return seq, err
+}
+
+// ErrFullResyncRequired 客户端上次同步之后的删除记录已被清理，需要清空本地同步数据后重新全量同步
+var ErrFullResyncRequired = errors.New("距离上次同步时间过久，需要重新全量同步")
+
+// CheckCursorRetained 检查游标之后的变更是否都还在变更日志中，已被清理时返回 ErrFullResyncRequired
+func CheckCursorRetained(uid string, afterSeq int64) error {
+	var prunedSeq int64
+	if err := config.DB.Model(&models.User{}).Where("id = ?", uid).Pluck("sync_pruned_seq", &prunedSeq).Error; err != nil {
+		return err
+	}
+	if afterSeq < prunedSeq {
+		return ErrFullResyncRequired
+	}
+	return nil
+}
+
+// EncodeSyncCursor 将同步序号编码为不透明游标
+func EncodeSyncCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncCursorPrefix + strconv.FormatInt(seq, 10)))
+}
+
+// DecodeSyncCursor 解析不透明游标，空游标表示从头开始
+func DecodeSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), syncCursorPrefix) {
+		return 0, fmt.Errorf("无效的同步游标")
+	}
+
+	seq, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncCursorPrefix), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("无效的同步游标")
+	}
+	return seq, nil
+}
+
+// 全量同步游标前缀
+const fullSyncCursorPrefix = "full:v1:"
+
+// FullSyncCursor 全量同步分页位置：当前实体类型下标、该类型下最后返回的ID，以及开始全量同步时的变更序号
+type FullSyncCursor struct {
+	Seq       int64
+	TypeIndex int
+	LastID    string
+}
+
+// EncodeFullSyncCursor 将全量同步分页位置编码为不透明游标
+func EncodeFullSyncCursor(cursor FullSyncCursor) string {
+	raw := fmt.Sprintf("%s%d:%d:%s", fullSyncCursorPrefix, cursor.Seq, cursor.TypeIndex, cursor.LastID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// IsFullSyncCursor 判断游标是否为全量同步分页游标
+func IsFullSyncCursor(cursor string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	return err == nil && strings.HasPrefix(string(raw), fullSyncCursorPrefix)
+}
+
+// DecodeFullSyncCursor 解析全量同步游标
+func DecodeFullSyncCursor(cursor string) (FullSyncCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), fullSyncCursorPrefix) {
+		return FullSyncCursor{}, fmt.Errorf("无效的同步游标")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(string(raw), fullSyncCursorPrefix), ":", 3)
+	if len(parts) != 3 {
+		return FullSyncCursor{}, fmt.Errorf("无效的同步游标")
+	}
+
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || seq < 0 {
+		return FullSyncCursor{}, fmt.Errorf("无效的同步游标")
+	}
+	typeIndex, err := strconv.Atoi(parts[1])
+	if err != nil || typeIndex < 0 {
+		return FullSyncCursor{}, fmt.Errorf("无效的同步游标")
+	}
+
+	return FullSyncCursor{Seq: seq, TypeIndex: typeIndex, LastID: parts[2]}, nil
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 能量恢复默认配置
+const (
+	defaultEnergyDailyGrant = 3
+	defaultEnergyDailyCap   = 20
+	defaultTimezone         = "Asia/Shanghai"
+)
+
+// EnergyRegenAllowance 每日恢复规则：每天首次请求时恢复 DailyGrant 点，恢复后不超过 Cap
+type EnergyRegenAllowance struct {
+	DailyGrant int
+	Cap        int
+}
+
+// Enabled 是否开启每日恢复
+func (a EnergyRegenAllowance) Enabled() bool {
+	return a.DailyGrant > 0 && a.Cap > 0
+}
+
+// defaultEnergyRegenAllowances 默认的各等级每日恢复规则：付费等级恢复更多、上限更高
+func defaultEnergyRegenAllowances() map[string]EnergyRegenAllowance {
+	return map[string]EnergyRegenAllowance{
+		models.TierFree: {DailyGrant: defaultEnergyDailyGrant, Cap: defaultEnergyDailyCap},
+		models.TierPlus: {DailyGrant: 5, Cap: 40},
+		models.TierPro:  {DailyGrant: 10, Cap: 60},
+	}
+}
+
+// EnergyRegenPolicy 每日免费能量恢复策略
+type EnergyRegenPolicy struct {
+	Allowances      map[string]EnergyRegenAllowance // 各订阅等级的恢复规则
+	DefaultLocation *time.Location
+}
+
+// Allowance 返回该等级的恢复规则，未配置的等级按免费等级恢复
+func (p EnergyRegenPolicy) Allowance(tier string) EnergyRegenAllowance {
+	if allowance, ok := p.Allowances[tier]; ok {
+		return allowance
+	}
+	return p.Allowances[models.TierFree]
+}
+
+// Enabled 是否有任一等级开启每日恢复
+func (p EnergyRegenPolicy) Enabled() bool {
+	for _, allowance := range p.Allowances {
+		if allowance.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+var energyRegenPolicy = EnergyRegenPolicy{
+	Allowances:      defaultEnergyRegenAllowances(),
+	DefaultLocation: time.UTC,
+}
+
+// ConfigureEnergyRegen 根据配置设置每日能量恢复策略。免费等级使用 ENERGY_DAILY_GRANT 和 ENERGY_DAILY_CAP，
+// 各等级还可以通过 ENERGY_REGEN_RULES 覆盖，格式为 "tier.grant=n" 或 "tier.cap=n"，多项以逗号分隔，
+// 如 "plus.grant=6,pro.cap=100"，grant 为 0 表示该等级不恢复
+func ConfigureEnergyRegen(conf config.Config) error {
+	allowances := defaultEnergyRegenAllowances()
+	free := allowances[models.TierFree]
+	if conf.EnergyDailyGrant != 0 {
+		free.DailyGrant = conf.EnergyDailyGrant
+	}
+	if conf.EnergyDailyCap != 0 {
+		free.Cap = conf.EnergyDailyCap
+	}
+	allowances[models.TierFree] = free
+
+	for _, item := range strings.Split(conf.EnergyRegenRules, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, valueStr, ok := strings.Cut(item, "=")
+		tier, field, hasField := strings.Cut(strings.TrimSpace(key), ".")
+		if !ok || !hasField {
+			return fmt.Errorf("无效的能量恢复规则: %s", item)
+		}
+		allowance, known := allowances[tier]
+		if !known {
+			return fmt.Errorf("未知的订阅等级: %s", tier)
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(valueStr))
+		if err != nil || value < 0 {
+			return fmt.Errorf("无效的能量恢复规则: %s", item)
+		}
+		switch field {
+		case "grant":
+			allowance.DailyGrant = value
+		case "cap":
+			allowance.Cap = value
+		default:
+			return fmt.Errorf("未知的能量恢复规则: %s", field)
+		}
+		allowances[tier] = allowance
+	}
+
+	timezone := conf.DefaultTimezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("无效的默认时区 %s: %w", timezone, err)
+	}
+
+	energyRegenPolicy = EnergyRegenPolicy{
+		Allowances:      allowances,
+		DefaultLocation: loc,
+	}
+	return nil
+}
+
+// CurrentEnergyRegenPolicy 返回当前的每日能量恢复策略
+func CurrentEnergyRegenPolicy() EnergyRegenPolicy {
+	return energyRegenPolicy
+}
+
+// 用户时区修改后至少间隔该时长才能再次修改，避免通过轮换时区在一天内多次恢复能量
+const timezoneChangeInterval = 7 * 24 * time.Hour
+
+// UserLocation 返回用户固定的时区，未设置或无效时使用默认时区
+func UserLocation(user models.User) *time.Location {
+	if user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
+	}
+	return energyRegenPolicy.DefaultLocation
+}
+
+// pinUserTimezone 返回用户固定的时区。首次使用时保存客户端上报的时区；之后上报的时区不同时，
+// 距上次修改超过 timezoneChangeInterval 才更新，否则继续使用已保存的时区
+func pinUserTimezone(tx *gorm.DB, user *models.User, requested string, now time.Time) (*time.Location, error) {
+	if requested == "" || requested == user.Timezone {
+		return UserLocation(*user), nil
+	}
+	loc, err := time.LoadLocation(requested)
+	if err != nil {
+		return UserLocation(*user), nil
+	}
+	if user.TimezoneChangedAt != nil && now.Sub(*user.TimezoneChangedAt) < timezoneChangeInterval {
+		return UserLocation(*user), nil
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"timezone":            requested,
+		"timezone_changed_at": now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("保存用户时区失败: %w", err)
+	}
+	user.Timezone = requested
+	user.TimezoneChangedAt = &now
+	return loc, nil
+}
+
+// energyRegenKey 当天已处理过每日恢复的标记，过期时间为用户本地的下一个零点
+func energyRegenKey(uid string) string {
+	return "energy:regen:" + uid
+}
+
+// NextEnergyRefill 返回下一次可以恢复能量的时间，即用户本地时间的下一个零点
+func NextEnergyRefill(now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// RegenerateEnergy 在用户本地日期的首次请求时按订阅等级恢复当天的免费能量，返回恢复的点数。
+// 本地日期按服务端固定的用户时区计算，requestedTimezone 为客户端上报的时区，只在允许修改时生效。
+// 同一天内重复调用不会重复恢复，当天处理过后由 Redis 标记直接返回，不再访问数据库；余额已达上限时当天不再恢复。
+func RegenerateEnergy(uid string, requestedTimezone string) (int, error) {
+	policy := energyRegenPolicy
+	if !policy.Enabled() {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	exists, err := config.RedisClient.Exists(ctx, energyRegenKey(uid)).Result()
+	if err != nil {
+		// Redis 不可用时退回数据库判断，数据库中的日期条件保证不会重复恢复
+		config.Logger.Warnw("读取每日恢复标记失败", "error", err, "uid", uid)
+	} else if exists > 0 {
+		return 0, nil
+	}
+
+	entitlement, err := GetEntitlement(uid)
+	if err != nil {
+		return 0, fmt.Errorf("恢复每日能量失败: %w", err)
+	}
+	allowance := policy.Allowance(entitlement.Tier)
+
+	now := time.Now()
+	var granted int
+	var loc *time.Location
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "energy", "timezone", "timezone_changed_at").
+			Where("id = ?", uid).
+			First(&user).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if loc, err = pinUserTimezone(tx, &user, requestedTimezone, now); err != nil {
+			return err
+		}
+		today := now.In(loc).Format("2006-01-02")
+
+		// 按日期条件更新，只有当天第一个请求能更新成功
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND last_energy_grant_on < ?", uid, today).
+			UpdateColumn("last_energy_grant_on", today)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		amount := allowance.DailyGrant
+		if remaining := allowance.Cap - user.Energy; remaining < amount {
+			amount = remaining
+		}
+		if amount <= 0 {
+			return nil
+		}
+
+		if _, err := ChangeEnergy(tx, uid, amount, models.EnergyReasonDailyGrant, today); err != nil {
+			return err
+		}
+		granted = amount
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("恢复每日能量失败: %w", err)
+	}
+
+	if err := config.RedisClient.Set(ctx, energyRegenKey(uid), 1, NextEnergyRefill(now, loc).Sub(now)).Err(); err != nil {
+		config.Logger.Warnw("保存每日恢复标记失败", "error", err, "uid", uid)
+	}
+	return granted, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const regenTestUID = "regen-user"
+
+// setupRegenFixture 创建余额为 energy 的测试用户
+func setupRegenFixture(t *testing.T, energy int) *gorm.DB {
+	t.Helper()
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, append(energyTestModels, &models.Subscription{})...)
+	if err := db.Create(&models.User{ID: regenTestUID, Energy: energy}).Error; err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+	return db
+}
+
+// loadRegenUser 读取测试用户
+func loadRegenUser(t *testing.T, db *gorm.DB) models.User {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, "id = ?", regenTestUID).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	return user
+}
+
+// regenerate 调用 RegenerateEnergy 并检查恢复的点数
+func regenerate(t *testing.T, timezone string, want int) {
+	t.Helper()
+	granted, err := RegenerateEnergy(regenTestUID, timezone)
+	if err != nil {
+		t.Fatalf("恢复每日能量失败: %v", err)
+	}
+	if granted != want {
+		t.Errorf("RegenerateEnergy(%q) = %d, want %d", timezone, granted, want)
+	}
+}
+
+func TestRegenerateEnergySkipsDatabaseAfterFirstRequest(t *testing.T) {
+	db := setupRegenFixture(t, 5)
+	redis := testutil.SetupRedis(t)
+
+	regenerate(t, "Asia/Shanghai", defaultEnergyDailyGrant)
+	if ttl := redis.TTL(energyRegenKey(regenTestUID)); ttl <= 0 || ttl > 24*time.Hour {
+		t.Errorf("每日恢复标记的过期时间 = %v, want (0, 24h]", ttl)
+	}
+
+	// 清掉数据库中的日期后仍不应恢复，说明后续请求由 Redis 标记直接返回
+	if err := db.Model(&models.User{}).Where("id = ?", regenTestUID).
+		UpdateColumn("last_energy_grant_on", "").Error; err != nil {
+		t.Fatalf("重置恢复日期失败: %v", err)
+	}
+	regenerate(t, "Asia/Shanghai", 0)
+
+	redis.FlushAll()
+	regenerate(t, "Asia/Shanghai", defaultEnergyDailyGrant)
+	if user := loadRegenUser(t, db); user.Energy != 5+2*defaultEnergyDailyGrant {
+		t.Errorf("余额 = %d, want %d", user.Energy, 5+2*defaultEnergyDailyGrant)
+	}
+}
+
+func TestRegenerateEnergyPinsTimezone(t *testing.T) {
+	db := setupRegenFixture(t, 5)
+	redis := testutil.SetupRedis(t)
+
+	// UTC-12 与 UTC+14 相差 26 小时，任何时刻两地的日期都不同
+	const behind, ahead = "Etc/GMT+12", "Pacific/Kiritimati"
+
+	regenerate(t, behind, defaultEnergyDailyGrant)
+	if user := loadRegenUser(t, db); user.Timezone != behind || user.TimezoneChangedAt == nil {
+		t.Fatalf("首次使用时应保存时区, got %q", user.Timezone)
+	}
+
+	// 换到日期更晚的时区不能立即再领一次
+	redis.FlushAll()
+	regenerate(t, ahead, 0)
+	if user := loadRegenUser(t, db); user.Timezone != behind {
+		t.Errorf("修改间隔内不应更新时区, got %q", user.Timezone)
+	}
+
+	// 超过修改间隔后允许更新时区
+	changedAt := time.Now().Add(-timezoneChangeInterval - time.Hour)
+	if err := db.Model(&models.User{}).Where("id = ?", regenTestUID).
+		UpdateColumn("timezone_changed_at", changedAt).Error; err != nil {
+		t.Fatalf("修改时区变更时间失败: %v", err)
+	}
+	redis.FlushAll()
+	regenerate(t, ahead, defaultEnergyDailyGrant)
+	if user := loadRegenUser(t, db); user.Timezone != ahead {
+		t.Errorf("超过修改间隔后应更新时区, got %q", user.Timezone)
+	}
+}
+
+func TestRegenerateEnergyIgnoresInvalidTimezone(t *testing.T) {
+	db := setupRegenFixture(t, 5)
+	testutil.SetupRedis(t)
+
+	regenerate(t, "Not/AZone", defaultEnergyDailyGrant)
+	if user := loadRegenUser(t, db); user.Timezone != "" {
+		t.Errorf("无效时区不应保存, got %q", user.Timezone)
+	}
+}
+
+func TestRegenerateEnergyByTier(t *testing.T) {
+	allowances := defaultEnergyRegenAllowances()
+	cases := []struct {
+		name   string
+		tier   string
+		energy int
+		want   int
+	}{
+		{name: "free", tier: models.TierFree, energy: 5, want: allowances[models.TierFree].DailyGrant},
+		{name: "free near cap", tier: models.TierFree, energy: allowances[models.TierFree].Cap - 1, want: 1},
+		{name: "plus", tier: models.TierPlus, energy: 5, want: allowances[models.TierPlus].DailyGrant},
+		// 免费等级已达上限，Plus 等级的上限更高仍可恢复
+		{name: "plus above free cap", tier: models.TierPlus, energy: allowances[models.TierFree].Cap, want: allowances[models.TierPlus].DailyGrant},
+		{name: "pro near cap", tier: models.TierPro, energy: allowances[models.TierPro].Cap - 2, want: 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupRegenFixture(t, tc.energy)
+			testutil.SetupRedis(t)
+			if tc.tier != models.TierFree {
+				now := time.Now()
+				if err := db.Create(&models.Subscription{
+					ID:        "sub-" + tc.tier,
+					UserID:    regenTestUID,
+					Tier:      tc.tier,
+					StartsAt:  now.Add(-time.Hour),
+					ExpiresAt: now.Add(30 * 24 * time.Hour),
+				}).Error; err != nil {
+					t.Fatalf("创建订阅失败: %v", err)
+				}
+			}
+
+			regenerate(t, "", tc.want)
+		})
+	}
+}
+
+func TestConfigureEnergyRegen(t *testing.T) {
+	previous := energyRegenPolicy
+	t.Cleanup(func() { energyRegenPolicy = previous })
+
+	conf := config.Config{
+		EnergyDailyGrant: 4,
+		EnergyRegenRules: "plus.grant=6, pro.cap=100,pro.grant=0",
+		DefaultTimezone:  "UTC",
+	}
+	if err := ConfigureEnergyRegen(conf); err != nil {
+		t.Fatalf("ConfigureEnergyRegen: %v", err)
+	}
+	policy := CurrentEnergyRegenPolicy()
+	if got := policy.Allowance(models.TierFree); got != (EnergyRegenAllowance{DailyGrant: 4, Cap: defaultEnergyDailyCap}) {
+		t.Errorf("free = %+v", got)
+	}
+	if got := policy.Allowance(models.TierPlus); got.DailyGrant != 6 {
+		t.Errorf("plus = %+v, want grant 6", got)
+	}
+	if got := policy.Allowance(models.TierPro); got.Cap != 100 || got.Enabled() {
+		t.Errorf("pro = %+v, want cap 100 and disabled", got)
+	}
+
+	for _, rules := range []string{"plus=6", "gold.grant=1", "plus.bonus=1", "plus.grant=-1"} {
+		conf.EnergyRegenRules = rules
+		if err := ConfigureEnergyRegen(conf); err == nil {
+			t.Errorf("ConfigureEnergyRegen(%q) 应返回错误", rules)
+		}
+	}
+}
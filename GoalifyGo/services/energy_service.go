@@ -0,0 +1,288 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInsufficientEnergy 能量值不足
+var ErrInsufficientEnergy = errors.New("能量值不足")
+
+// 预扣超过该时长仍未确认时视为请求已中断（如服务器崩溃），由后台任务退还；
+// 仍在进行的长时间生成完成后由 CommitEnergy 重新扣除
+const energyReservationTimeout = 10 * time.Minute
+
+// ChangeEnergy 在事务中变更用户能量并追加一条流水，返回变更后的余额。
+// 扣减后余额为负时返回 ErrInsufficientEnergy 和当前余额，不做任何修改。
+func ChangeEnergy(tx *gorm.DB, uid string, delta int, reason string, referenceID string) (int, error) {
+	// 余额检查和扣减在同一条条件更新中完成，并发请求不会同时通过检查，也不会丢失更新；
+	// 更新同时持有用户行锁直到事务结束，保证流水顺序与余额一致
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND energy + ? >= 0", uid, delta).
+		UpdateColumn("energy", gorm.Expr("energy + ?", delta))
+	if result.Error != nil {
+		return 0, fmt.Errorf("更新能量失败: %w", result.Error)
+	}
+
+	var balances []int
+	if err := tx.Model(&models.User{}).Where("id = ?", uid).Pluck("energy", &balances).Error; err != nil {
+		return 0, fmt.Errorf("读取能量失败: %w", err)
+	}
+	if len(balances) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	balance := balances[0]
+	if result.RowsAffected == 0 {
+		return balance, ErrInsufficientEnergy
+	}
+
+	if err := ensureOpeningEntry(tx, uid, balance-delta); err != nil {
+		return balance, err
+	}
+
+	entry := models.EnergyLedgerEntry{
+		UserID:       uid,
+		Delta:        delta,
+		Reason:       reason,
+		ReferenceID:  referenceID,
+		BalanceAfter: balance,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return balance, fmt.Errorf("写入能量流水失败: %w", err)
+	}
+	return balance, nil
+}
+
+// ensureOpeningEntry 用户还没有流水时，先以当前余额写入期初流水，使流水合计与余额一致
+func ensureOpeningEntry(tx *gorm.DB, uid string, balance int) error {
+	var count int64
+	if err := tx.Model(&models.EnergyLedgerEntry{}).Where("user_id = ?", uid).Limit(1).Count(&count).Error; err != nil {
+		return fmt.Errorf("查询能量流水失败: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	entry := models.EnergyLedgerEntry{
+		UserID:       uid,
+		Delta:        balance,
+		Reason:       models.EnergyReasonInitial,
+		BalanceAfter: balance,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("写入期初能量流水失败: %w", err)
+	}
+	return nil
+}
+
+// CreateUser 创建用户，并以初始能量写入期初流水
+func CreateUser(user *models.User) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		// 未指定能量时使用数据库默认值，以实际写入的余额为准
+		var balances []int
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Pluck("energy", &balances).Error; err != nil {
+			return fmt.Errorf("读取能量失败: %w", err)
+		}
+		if len(balances) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ensureOpeningEntry(tx, user.ID, balances[0])
+	})
+}
+
+// ListEnergyHistory 按时间倒序返回用户的能量流水，beforeID 大于 0 时只返回该ID之前的流水。
+// 期初流水在迁移和创建用户时写入，这里只读。
+func ListEnergyHistory(uid string, beforeID uint64, limit int) ([]models.EnergyLedgerEntry, error) {
+	query := config.DB.Where("user_id = ?", uid)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var entries []models.EnergyLedgerEntry
+	err := query.Order("id desc").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// ReserveEnergy 预扣能量，返回预扣记录和扣除后的余额；余额不足时返回 ErrInsufficientEnergy 和当前余额。
+// amount 为 0 时不预扣，返回的预扣记录为 nil。
+func ReserveEnergy(uid string, amount int, reason string) (*models.EnergyReservation, int, error) {
+	var reservation *models.EnergyReservation
+	var balance int
+	if amount <= 0 {
+		err := config.DB.Model(&models.User{}).Where("id = ?", uid).Pluck("energy", &balance).Error
+		return nil, balance, err
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		reservation = &models.EnergyReservation{
+			ID:        uuid.New().String(),
+			UserID:    uid,
+			Amount:    amount,
+			Reason:    reason,
+			Status:    models.EnergyReservationReserved,
+			CreatedAt: time.Now(),
+		}
+
+		var err error
+		if balance, err = ChangeEnergy(tx, uid, -amount, reason, reservation.ID); err != nil {
+			return err
+		}
+		return tx.Create(reservation).Error
+	})
+	if err != nil {
+		return nil, balance, err
+	}
+	return reservation, balance, nil
+}
+
+// CommitEnergy 确认预扣，能量不再退还。
+// 生成超过 energyReservationTimeout 时预扣可能已被后台任务退还，此时重新扣除能量；
+// 余额不足无法重新扣除时记录安全事件并返回 ErrInsufficientEnergy。
+func CommitEnergy(reservation *models.EnergyReservation) error {
+	if reservation == nil {
+		return nil
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.EnergyReservation{}).
+			Where("id = ? AND status = ?", reservation.ID, models.EnergyReservationReserved).
+			Updates(map[string]interface{}{
+				"status":      models.EnergyReservationCommitted,
+				"resolved_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("确认能量预扣失败: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		// 预扣已被超时退还，状态更新成功才重新扣除，避免重复扣除
+		result = tx.Model(&models.EnergyReservation{}).
+			Where("id = ? AND status = ?", reservation.ID, models.EnergyReservationReleased).
+			Updates(map[string]interface{}{
+				"status":      models.EnergyReservationCommitted,
+				"resolved_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("确认能量预扣失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if _, err := ChangeEnergy(tx, reservation.UserID, -reservation.Amount, reservation.Reason, reservation.ID); err != nil {
+			return fmt.Errorf("重新扣除超时退还的能量失败: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrInsufficientEnergy) {
+		config.LogSecurityEvent("energy_reservation_unpaid",
+			"uid", reservation.UserID,
+			"reservationID", reservation.ID,
+			"amount", reservation.Amount,
+			"reason", reservation.Reason)
+	}
+	return err
+}
+
+// ReleaseEnergy 退还预扣的能量，已确认或已退还的预扣不会重复处理
+func ReleaseEnergy(reservation *models.EnergyReservation) error {
+	if reservation == nil {
+		return nil
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return releaseReservation(tx, reservation)
+	})
+}
+
+// releaseReservation 在事务中把预扣状态改为已退还并加回能量，状态更新成功才退还，避免重复退还
+func releaseReservation(tx *gorm.DB, reservation *models.EnergyReservation) error {
+	result := tx.Model(&models.EnergyReservation{}).
+		Where("id = ? AND status = ?", reservation.ID, models.EnergyReservationReserved).
+		Updates(map[string]interface{}{
+			"status":      models.EnergyReservationReleased,
+			"resolved_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("退还能量预扣失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	if _, err := ChangeEnergy(tx, reservation.UserID, reservation.Amount, models.EnergyReasonRefund, reservation.ID); err != nil {
+		return fmt.Errorf("退还能量失败: %w", err)
+	}
+	return nil
+}
+
+// EnergyReservationSweeper 定期退还超时未确认的能量预扣，覆盖服务器崩溃或重启时中断的请求
+type EnergyReservationSweeper struct {
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewEnergyReservationSweeper() *EnergyReservationSweeper {
+	return &EnergyReservationSweeper{
+		interval: time.Minute,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start 在后台启动退还任务
+func (s *EnergyReservationSweeper) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.sweep()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// sweep 退还超时的预扣
+func (s *EnergyReservationSweeper) sweep() {
+	cutoff := time.Now().Add(-energyReservationTimeout)
+
+	var expired []models.EnergyReservation
+	if err := config.DB.Where("status = ? AND created_at < ?", models.EnergyReservationReserved, cutoff).
+		Limit(500).
+		Find(&expired).Error; err != nil {
+		config.Logger.Errorw("查询超时能量预扣失败", "error", err)
+		return
+	}
+
+	for i := range expired {
+		if err := ReleaseEnergy(&expired[i]); err != nil {
+			config.Logger.Errorw("退还超时能量预扣失败", "error", err, "reservationID", expired[i].ID, "uid", expired[i].UserID)
+			continue
+		}
+		config.Logger.Infow("退还超时能量预扣", "reservationID", expired[i].ID, "uid", expired[i].UserID, "amount", expired[i].Amount)
+	}
+}
+
+// Stop 停止退还任务并等待当前处理完成
+func (s *EnergyReservationSweeper) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
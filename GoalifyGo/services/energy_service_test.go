@@ -0,0 +1,236 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// energyTestModels 能量相关测试需要的表
+var energyTestModels = []interface{}{&models.User{}, &models.EnergyLedgerEntry{}, &models.EnergyReservation{}}
+
+func TestEnergyConcurrentChanges(t *testing.T) {
+	backends := []struct {
+		name  string
+		setup func(testing.TB, ...interface{}) *gorm.DB
+	}{
+		{name: "sqlite", setup: testutil.SetupDB},
+		// 设置 TEST_MYSQL_DSN 时在真实 MySQL 上验证条件更新和行锁
+		{name: "mysql", setup: testutil.SetupMySQL},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			testutil.ObserveLogs(t)
+			db := backend.setup(t, energyTestModels...)
+			runConcurrentEnergyChanges(t, db)
+		})
+	}
+}
+
+// runConcurrentEnergyChanges 并发预扣、退还、扣减和增加同一用户的能量，
+// 检查余额不为负、没有丢失更新，且流水合计等于余额
+func runConcurrentEnergyChanges(t *testing.T, db *gorm.DB) {
+	const (
+		uid     = "energy-user"
+		initial = 30
+		workers = 60
+	)
+	if err := db.Create(&models.User{ID: uid, Energy: initial}).Error; err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		applied  int // 成功变更的合计
+		changes  int // 成功写入的流水条数
+		rejected int // 余额不足被拒绝的次数
+	)
+	record := func(delta int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err == nil:
+			applied += delta
+			changes++
+		case errors.Is(err, ErrInsufficientEnergy):
+			rejected++
+		default:
+			t.Errorf("变更能量失败: %v", err)
+		}
+	}
+	change := func(delta int, reason string) error {
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := ChangeEnergy(tx, uid, delta, reason, "")
+			return err
+		})
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			switch i % 3 {
+			case 0:
+				reservation, _, err := ReserveEnergy(uid, 4, models.EnergyReasonChat)
+				record(-4, err)
+				if err == nil && i%2 == 0 {
+					record(4, ReleaseEnergy(reservation))
+				}
+			case 1:
+				record(-7, change(-7, models.EnergyReasonChat))
+			default:
+				record(3, change(3, models.EnergyReasonAdminGrant))
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var user models.User
+	if err := db.First(&user, "id = ?", uid).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	if user.Energy < 0 {
+		t.Errorf("余额为负: %d", user.Energy)
+	}
+	if want := initial + applied; user.Energy != want {
+		t.Errorf("余额 = %d, want %d（丢失了更新）", user.Energy, want)
+	}
+	if rejected == 0 {
+		t.Errorf("没有请求因余额不足被拒绝，测试没有覆盖并发扣减的竞争")
+	}
+
+	var entries []models.EnergyLedgerEntry
+	if err := db.Where("user_id = ?", uid).Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("查询能量流水失败: %v", err)
+	}
+	// 第一条为期初流水
+	if len(entries) != changes+1 {
+		t.Errorf("流水条数 = %d, want %d", len(entries), changes+1)
+	}
+	sum := 0
+	for _, entry := range entries {
+		sum += entry.Delta
+		if entry.BalanceAfter < 0 {
+			t.Errorf("流水 %d 的余额为负: %d", entry.ID, entry.BalanceAfter)
+		}
+		if entry.BalanceAfter != sum {
+			t.Errorf("流水 %d 的余额 = %d, 按顺序累计为 %d", entry.ID, entry.BalanceAfter, sum)
+		}
+	}
+	if sum != user.Energy {
+		t.Errorf("流水合计 = %d, 余额 = %d", sum, user.Energy)
+	}
+}
+
+func TestCommitEnergyAfterSweep(t *testing.T) {
+	cases := []struct {
+		name       string
+		spend      int // 退还后、确认前另外消耗的能量
+		wantErr    error
+		wantEnergy int
+		wantStatus string
+	}{
+		{name: "re-deducts", wantEnergy: 6, wantStatus: models.EnergyReservationCommitted},
+		{name: "insufficient", spend: 8, wantErr: ErrInsufficientEnergy, wantEnergy: 2, wantStatus: models.EnergyReservationReleased},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := testutil.ObserveLogs(t)
+			db := testutil.SetupDB(t, energyTestModels...)
+			const uid = "energy-user"
+			if err := db.Create(&models.User{ID: uid, Energy: 10}).Error; err != nil {
+				t.Fatalf("创建测试用户失败: %v", err)
+			}
+
+			reservation, _, err := ReserveEnergy(uid, 4, models.EnergyReasonChat)
+			if err != nil {
+				t.Fatalf("预扣能量失败: %v", err)
+			}
+			// 生成超过超时时长，预扣被后台任务退还
+			if err := db.Model(reservation).Update("created_at", time.Now().Add(-2*energyReservationTimeout)).Error; err != nil {
+				t.Fatalf("修改预扣时间失败: %v", err)
+			}
+			NewEnergyReservationSweeper().sweep()
+			if tc.spend > 0 {
+				if err := db.Transaction(func(tx *gorm.DB) error {
+					_, err := ChangeEnergy(tx, uid, -tc.spend, models.EnergyReasonChat, "")
+					return err
+				}); err != nil {
+					t.Fatalf("扣减能量失败: %v", err)
+				}
+			}
+
+			if err := CommitEnergy(reservation); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("CommitEnergy error = %v, want %v", err, tc.wantErr)
+			}
+			// 重复确认不会再次扣除
+			if tc.wantErr == nil {
+				if err := CommitEnergy(reservation); err != nil {
+					t.Fatalf("重复确认失败: %v", err)
+				}
+			}
+
+			var user models.User
+			if err := db.First(&user, "id = ?", uid).Error; err != nil {
+				t.Fatalf("查询用户失败: %v", err)
+			}
+			if user.Energy != tc.wantEnergy {
+				t.Errorf("energy = %d, want %d", user.Energy, tc.wantEnergy)
+			}
+			var stored models.EnergyReservation
+			if err := db.First(&stored, "id = ?", reservation.ID).Error; err != nil {
+				t.Fatalf("查询预扣失败: %v", err)
+			}
+			if stored.Status != tc.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tc.wantStatus)
+			}
+			if got := len(testutil.SecurityEvents(logs, "energy_reservation_unpaid")); (got > 0) != (tc.wantErr != nil) {
+				t.Errorf("energy_reservation_unpaid 安全事件 = %d", got)
+			}
+		})
+	}
+}
+
+func TestCreateUserWritesOpeningEntry(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, energyTestModels...)
+
+	// 未指定能量时使用默认值
+	user := models.User{ID: "new-user"}
+	if err := CreateUser(&user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	entries, err := ListEnergyHistory(user.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("ListEnergyHistory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Reason != models.EnergyReasonInitial || entries[0].BalanceAfter != 20 {
+		t.Fatalf("entries = %+v, want 1 opening entry of 20", entries)
+	}
+
+	// 查询流水不写入数据
+	var count int64
+	if _, err := ListEnergyHistory("missing-user", 0, 10); err != nil {
+		t.Fatalf("ListEnergyHistory: %v", err)
+	}
+	if err := db.Model(&models.EnergyLedgerEntry{}).Count(&count).Error; err != nil {
+		t.Fatalf("统计能量流水失败: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("流水条数 = %d, want 1", count)
+	}
+}
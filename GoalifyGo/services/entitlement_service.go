@@ -0,0 +1,116 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 等级从低到高的顺序，同时有多个有效订阅时取最高等级
+var tierRank = map[string]int{
+	models.TierFree: 0,
+	models.TierPlus: 1,
+	models.TierPro:  2,
+}
+
+// EnergyCostRules 各等级每种操作消耗的能量，0 表示不消耗
+type EnergyCostRules map[string]map[string]int
+
+// 默认能量消耗规则：Plus 月度复盘减免，Pro 不消耗能量
+var defaultEnergyCostRules = EnergyCostRules{
+	models.TierFree: {
+		models.EnergyReasonChat:        1,
+		models.EnergyReasonReviewDay:   1,
+		models.EnergyReasonReviewWeek:  1,
+		models.EnergyReasonReviewMonth: 3,
+	},
+	models.TierPlus: {
+		models.EnergyReasonChat:        1,
+		models.EnergyReasonReviewDay:   1,
+		models.EnergyReasonReviewWeek:  1,
+		models.EnergyReasonReviewMonth: 1,
+	},
+	models.TierPro: {
+		models.EnergyReasonChat:        0,
+		models.EnergyReasonReviewDay:   0,
+		models.EnergyReasonReviewWeek:  0,
+		models.EnergyReasonReviewMonth: 0,
+	},
+}
+
+var energyCostRules = defaultEnergyCostRules
+
+// ConfigureEnergyCosts 在默认规则上应用 ENERGY_COST_RULES 配置，
+// 格式为 "tier.action=cost"，多项以逗号分隔，如 "plus.chat=0,free.review_month=2"
+func ConfigureEnergyCosts(value string) error {
+	rules := make(EnergyCostRules, len(defaultEnergyCostRules))
+	for tier, costs := range defaultEnergyCostRules {
+		rules[tier] = make(map[string]int, len(costs))
+		for action, cost := range costs {
+			rules[tier][action] = cost
+		}
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, costStr, ok := strings.Cut(item, "=")
+		tier, action, hasAction := strings.Cut(strings.TrimSpace(key), ".")
+		if !ok || !hasAction {
+			return fmt.Errorf("无效的能量消耗规则: %s", item)
+		}
+		if _, known := rules[tier]; !known {
+			return fmt.Errorf("未知的订阅等级: %s", tier)
+		}
+		if _, known := rules[tier][action]; !known {
+			return fmt.Errorf("未知的能量消耗操作: %s", action)
+		}
+		cost, err := strconv.Atoi(strings.TrimSpace(costStr))
+		if err != nil || cost < 0 {
+			return fmt.Errorf("无效的能量消耗: %s", item)
+		}
+		rules[tier][action] = cost
+	}
+
+	energyCostRules = rules
+	return nil
+}
+
+// Entitlement 用户当前的订阅权益
+type Entitlement struct {
+	Tier      string     `json:"tier"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // 免费等级为空
+}
+
+// EnergyCost 返回该等级执行某种操作消耗的能量
+func (e Entitlement) EnergyCost(action string) int {
+	if cost, ok := energyCostRules[e.Tier][action]; ok {
+		return cost
+	}
+	return energyCostRules[models.TierFree][action]
+}
+
+// GetEntitlement 返回用户当前生效的订阅权益，没有有效订阅（包括已过期）时为免费等级
+func GetEntitlement(uid string) (Entitlement, error) {
+	now := time.Now()
+	var subscriptions []models.Subscription
+	if err := config.DB.Where("user_id = ? AND starts_at <= ? AND expires_at > ?", uid, now, now).
+		Find(&subscriptions).Error; err != nil {
+		return Entitlement{}, fmt.Errorf("查询订阅失败: %w", err)
+	}
+
+	entitlement := Entitlement{Tier: models.TierFree}
+	for _, subscription := range subscriptions {
+		if tierRank[subscription.Tier] > tierRank[entitlement.Tier] {
+			expiresAt := subscription.ExpiresAt
+			entitlement = Entitlement{Tier: subscription.Tier, ExpiresAt: &expiresAt}
+		}
+	}
+	return entitlement, nil
+}
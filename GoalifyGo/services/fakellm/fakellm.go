@@ -0,0 +1,223 @@
+// Package fakellm 提供进程内的确定性 llms.Model 实现，仅供测试通过 NewChatService 注入，不访问网络。
+package fakellm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// DefaultReply 没有预设回复时返回的内容
+const DefaultReply = "这是离线模型的回复。"
+
+// Script 一次调用的预设回复
+type Script struct {
+	Chunks []string // 依次流式返回的片段，拼接后即为完整回复
+	Err    error    // 注入的错误，为空时正常结束
+	ErrAt  int      // 返回 ErrAt 个片段后再返回 Err，0 表示在第一个片段之前失败
+	Usage  Usage    // 结束时返回的 token 用量
+}
+
+// Usage 预设的 token 用量，写入 GenerationInfo，键名与 OpenAI 兼容后端一致
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Call 一次调用的记录
+type Call struct {
+	Messages []llms.MessageContent
+	Options  llms.CallOptions
+}
+
+// Model 按顺序消费预设回复的 llms.Model，预设回复用完后返回 Fallback
+type Model struct {
+	mu       sync.Mutex
+	scripts  []Script
+	calls    []Call
+	Fallback Script
+}
+
+// New 创建按顺序返回 scripts 的模型
+func New(scripts ...Script) *Model {
+	return &Model{
+		scripts:  scripts,
+		Fallback: Reply(DefaultReply),
+	}
+}
+
+// Enqueue 追加预设回复
+func (m *Model) Enqueue(scripts ...Script) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scripts = append(m.scripts, scripts...)
+}
+
+// Calls 返回已发生的调用记录
+func (m *Model) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// next 记录本次调用并取出下一条预设回复
+func (m *Model) next(messages []llms.MessageContent, opts llms.CallOptions) Script {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, Call{Messages: messages, Options: opts})
+	if len(m.scripts) == 0 {
+		return m.Fallback
+	}
+	script := m.scripts[0]
+	m.scripts = m.scripts[1:]
+	return script
+}
+
+// GenerateContent 实现 llms.Model，设置了 StreamingFunc 时逐个片段回调
+func (m *Model) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	script := m.next(messages, opts)
+
+	var content strings.Builder
+	for i, chunk := range script.Chunks {
+		if script.Err != nil && i == script.ErrAt {
+			return nil, script.Err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if opts.StreamingFunc != nil {
+			if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+		content.WriteString(chunk)
+	}
+	if script.Err != nil {
+		return nil, script.Err
+	}
+
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{
+			{
+				Content:    content.String(),
+				StopReason: "stop",
+				GenerationInfo: map[string]any{
+					"PromptTokens":     script.Usage.PromptTokens,
+					"CompletionTokens": script.Usage.CompletionTokens,
+					"TotalTokens":      script.Usage.PromptTokens + script.Usage.CompletionTokens,
+				},
+			},
+		},
+	}, nil
+}
+
+// Call 实现 llms.Model
+func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	resp, err := m.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Role:  schema.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{llms.TextPart(prompt)},
+		},
+	}, options...)
+	if err != nil {
+		return "", err
+	}
+	return resp.Choices[0].Content, nil
+}
+
+// ErrInjected 默认注入的生成错误
+var ErrInjected = errors.New("fakellm: injected error")
+
+// Reply 将完整回复按字符切分为多个片段
+func Reply(text string) Script {
+	return Script{Chunks: Split(text, 8)}
+}
+
+// FailAfter 返回 n 个片段后失败的预设回复，err 为空时使用 ErrInjected
+func FailAfter(text string, n int, err error) Script {
+	if err == nil {
+		err = ErrInjected
+	}
+	script := Reply(text)
+	script.Err = err
+	script.ErrAt = n
+	return script
+}
+
+// Split 按 size 个字符切分文本
+func Split(text string, size int) []string {
+	if size <= 0 {
+		size = 1
+	}
+	runes := []rune(text)
+	chunks := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); start += size {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
+
+// JSONBlock 将 payload 序列化并用 [[JSON_START]] 和 [[JSON_END]] 包裹
+func JSONBlock(payload interface{}) (string, error) {
+	data, err := json.MarshalIndent(payload, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("fakellm: 序列化结构化数据失败: %w", err)
+	}
+	return fmt.Sprintf("[[JSON_START]]\n%s\n[[JSON_END]]", data), nil
+}
+
+// StructuredReply 在 text 之后附带 payload 结构化数据的回复
+func StructuredReply(text string, payload interface{}) (Script, error) {
+	block, err := JSONBlock(payload)
+	if err != nil {
+		return Script{}, err
+	}
+	return Reply(text + "\n" + block), nil
+}
+
+// TaskPlanReply 带一个任务计划的 Logic 教练回复
+func TaskPlanReply() (Script, error) {
+	return StructuredReply("目标很清晰，按计划执行就好。", map[string]interface{}{
+		"tasks": []map[string]interface{}{
+			{
+				"title":              "每周健身三次",
+				"notes":              "循序渐进，注意拉伸",
+				"priority":           5,
+				"dueDate":            "2024-03-25T18:00:00Z",
+				"hasAlarm":           true,
+				"alarmDate":          "2024-03-25T17:30:00Z",
+				"recurrenceRule":     "weekly",
+				"recurrenceInterval": 1,
+			},
+		},
+	})
+}
+
+// EmotionRecordReply 带一条情绪记录的 Orange 教练回复
+func EmotionRecordReply() (Script, error) {
+	return StructuredReply("听起来你很担心明天的演讲，这很正常。", map[string]interface{}{
+		"emotion_record": map[string]interface{}{
+			"emotionType":      "焦虑",
+			"intensity":        1,
+			"trigger":          "担心明天的演讲会失败",
+			"unhealthyBeliefs": "我必须完美表现",
+			"healthyEmotion":   "适度担心",
+			"copingStrategies": "提前演练两遍",
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// LLMProvider 大模型后端，DeepSeek、OpenAI 兼容接口和本地 Ollama 都通过它接入
+type LLMProvider interface {
+	GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error)
+}
+
+// 支持的大模型后端
+const (
+	ProviderDeepseek = "deepseek"
+	ProviderOpenAI   = "openai"
+	ProviderOllama   = "ollama"
+)
+
+const (
+	defaultDeepseekModel = "deepseek/deepseek-v3"
+	defaultOllamaURL     = "http://localhost:11434"
+)
+
+// NewLLMProvider 根据配置创建大模型后端，未配置时默认使用 DeepSeek
+func NewLLMProvider(conf config.Config) (LLMProvider, error) {
+	switch strings.ToLower(conf.LLMProvider) {
+	case "", ProviderDeepseek:
+		model := conf.LLMModel
+		if model == "" {
+			model = defaultDeepseekModel
+		}
+		llm, err := openai.New(
+			openai.WithToken(conf.DeepseekAPIKey),
+			openai.WithBaseURL(conf.DeepseekAPIEndpoint),
+			openai.WithModel(model),
+			openai.WithResponseFormat(&openai.ResponseFormat{
+				Type: "json_object",
+			}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Deepseek client: %w", err)
+		}
+		return llm, nil
+
+	case ProviderOpenAI:
+		if conf.LLMBaseURL == "" || conf.LLMModel == "" {
+			return nil, fmt.Errorf("OpenAI 兼容后端需要配置 LLM_BASE_URL 和 LLM_MODEL")
+		}
+		llm, err := openai.New(
+			openai.WithToken(conf.LLMAPIKey),
+			openai.WithBaseURL(conf.LLMBaseURL),
+			openai.WithModel(conf.LLMModel),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OpenAI compatible client: %w", err)
+		}
+		return llm, nil
+
+	case ProviderOllama:
+		if conf.LLMModel == "" {
+			return nil, fmt.Errorf("Ollama 后端需要配置 LLM_MODEL")
+		}
+		serverURL := conf.LLMBaseURL
+		if serverURL == "" {
+			serverURL = defaultOllamaURL
+		}
+		llm, err := ollama.New(
+			ollama.WithServerURL(serverURL),
+			ollama.WithModel(conf.LLMModel),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Ollama client: %w", err)
+		}
+		return llm, nil
+
+	default:
+		return nil, fmt.Errorf("不支持的大模型后端: %s", conf.LLMProvider)
+	}
+}
+
+// 模型配置的键，除教练（logic, orange）和场景（goal, emotion, chat）外还包括以下用途
+const (
+	ProfileSummary = "summary"
+	ProfileReview  = "review"
+)
+
+// 未配置温度时使用的默认值
+const defaultTemperature = 0.7
+
+// ModelProfile 某个教练、场景或用途使用的模型和温度
+type ModelProfile struct {
+	Model       string   // 为空时使用后端的默认模型
+	Temperature *float64 // 为空时使用默认温度
+}
+
+// ModelProfiles 按教练、场景或用途配置的模型
+type ModelProfiles map[string]ModelProfile
+
+// ParseModelProfiles 解析 LLM_PROFILES 配置，格式为 "key=model@temperature"，多项以逗号分隔，
+// model 和 @temperature 均可省略，如 "orange=deepseek-chat@0.8,chat=qwen2:7b,summary=@0.3"
+func ParseModelProfiles(value string) (ModelProfiles, error) {
+	profiles := make(ModelProfiles)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, spec, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("无效的模型配置: %s", item)
+		}
+
+		model, temperature, hasTemperature := strings.Cut(spec, "@")
+		profile := ModelProfile{Model: strings.TrimSpace(model)}
+		if hasTemperature {
+			t, err := strconv.ParseFloat(strings.TrimSpace(temperature), 64)
+			if err != nil || t < 0 || t > 2 {
+				return nil, fmt.Errorf("无效的模型温度: %s", item)
+			}
+			profile.Temperature = &t
+		}
+		profiles[key] = profile
+	}
+	return profiles, nil
+}
+
+// resolve 按顺序查找第一个已配置的键，均未配置时返回空配置
+func (p ModelProfiles) resolve(keys ...string) ModelProfile {
+	for _, key := range keys {
+		if profile, ok := p[key]; ok {
+			return profile
+		}
+	}
+	return ModelProfile{}
+}
+
+// callOptions 将模型配置转换为调用参数，fallbackTemperature 为 nil 时不指定温度
+func (m ModelProfile) callOptions(fallbackTemperature *float64) []llms.CallOption {
+	var options []llms.CallOption
+	if m.Model != "" {
+		options = append(options, llms.WithModel(m.Model))
+	}
+	if m.Temperature != nil {
+		options = append(options, llms.WithTemperature(*m.Temperature))
+	} else if fallbackTemperature != nil {
+		options = append(options, llms.WithTemperature(*fallbackTemperature))
+	}
+	return options
+}
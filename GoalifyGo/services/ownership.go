@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotOwner 记录不属于当前用户
+var ErrNotOwner = errors.New("记录不属于当前用户")
+
+// SaveOwned 按主键更新记录除删除状态外的全部字段，但只会更新属于 uid 的记录。
+// 与 tx.Save 不同，记录不存在或属于其他用户时不会插入或覆盖，而是返回 ErrNotOwner。
+// 删除状态只由删除同步写入，普通写入不会清除墓碑。
+func SaveOwned(tx *gorm.DB, uid string, value interface{}) error {
+	result := tx.Model(value).Where("user_id = ?", uid).Select("*").Omit("status").Updates(value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// IsOwnedByOther 检查记录ID是否已被其他用户占用
+func IsOwnedByOther(tx *gorm.DB, model interface{}, id string, uid string) (bool, error) {
+	var count int64
+	if err := tx.Model(model).Where("id = ? AND user_id <> ?", id, uid).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSaveOwnedDoesNotTouchOtherUsersRow(t *testing.T) {
+	db := testutil.SetupDB(t, &models.Task{})
+	original := models.Task{ID: "T1", UserID: "victim", Title: "victim task", LastModified: time.Now()}
+	if err := db.Create(&original).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	hijack := models.Task{ID: "T1", UserID: "attacker", Title: "hijacked", LastModified: time.Now()}
+	if err := SaveOwned(db, "attacker", &hijack); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("SaveOwned error = %v, want ErrNotOwner", err)
+	}
+
+	var stored models.Task
+	if err := db.First(&stored, "id = ?", "T1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != "victim" || stored.Title != "victim task" {
+		t.Fatalf("row changed: %+v", stored)
+	}
+
+	// 不存在的记录同样不会被插入
+	missing := models.Task{ID: "T2", UserID: "attacker", Title: "new"}
+	if err := SaveOwned(db, "attacker", &missing); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("SaveOwned on missing row error = %v, want ErrNotOwner", err)
+	}
+	var count int64
+	db.Model(&models.Task{}).Where("id = ?", "T2").Count(&count)
+	if count != 0 {
+		t.Fatal("SaveOwned inserted a missing row")
+	}
+}
+
+func TestSaveOwnedKeepsTombstone(t *testing.T) {
+	db := testutil.SetupDB(t, &models.Subtask{})
+	if err := db.Create(&models.Subtask{ID: "S1", UserID: "u", Title: "old", Status: models.StatusDeleted}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入内容不包含 status（零值），不能清除删除状态
+	if err := SaveOwned(db, "u", &models.Subtask{ID: "S1", UserID: "u", Title: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Subtask
+	db.First(&stored, "id = ?", "S1")
+	if stored.Status != models.StatusDeleted {
+		t.Fatalf("status = %d, tombstone was cleared", stored.Status)
+	}
+}
+
+func TestIsOwnedByOther(t *testing.T) {
+	db := testutil.SetupDB(t, &models.EmotionRecord{})
+	if err := db.Create(&models.EmotionRecord{ID: "E1", UserID: "victim"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		id, uid string
+		want    bool
+	}{
+		{"E1", "attacker", true},
+		{"E1", "victim", false},
+		{"E2", "attacker", false},
+	}
+	for _, tc := range cases {
+		got, err := IsOwnedByOther(db, &models.EmotionRecord{}, tc.id, tc.uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("IsOwnedByOther(%s, %s) = %v, want %v", tc.id, tc.uid, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"GoalifyGo/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 兑换相关错误
+var (
+	ErrRedeemCodeNotFound       = errors.New("兑换码不存在")
+	ErrRedeemCodeUsed           = errors.New("兑换码已使用")
+	ErrRedeemCodeExpired        = errors.New("兑换码已过期")
+	ErrRedeemCodeAlreadyClaimed = errors.New("已兑换过该兑换码")
+	ErrInvalidRedeemOptions     = errors.New("无效的兑换码参数")
+)
+
+// 单个批次最多生成的兑换码数量
+const maxRedeemCampaignCodes = 10000
+
+// 生成兑换码时遇到重复的最大重试轮数
+const redeemCodeGenerateRounds = 5
+
+// RedeemCampaignOptions 创建兑换码批次的参数
+type RedeemCampaignOptions struct {
+	Name       string
+	Energy     int
+	Count      int
+	CodeLength int
+	MaxUses    int
+	ExpiresAt  *time.Time
+}
+
+// NormalizeRedeemCode 统一兑换码格式，用户输入不区分大小写
+func NormalizeRedeemCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CreateRedeemCampaign 创建兑换码批次并批量生成兑换码
+func CreateRedeemCampaign(opts RedeemCampaignOptions) (*models.RedeemCampaign, []models.RedeemCode, error) {
+	if opts.Energy <= 0 {
+		return nil, nil, fmt.Errorf("%w: 能量值必须大于 0", ErrInvalidRedeemOptions)
+	}
+	if opts.Count <= 0 || opts.Count > maxRedeemCampaignCodes {
+		return nil, nil, fmt.Errorf("%w: 兑换码数量需在 1 到 %d 之间", ErrInvalidRedeemOptions, maxRedeemCampaignCodes)
+	}
+	if opts.CodeLength == 0 {
+		opts.CodeLength = models.DefaultRedeemCodeLength
+	}
+	if opts.MaxUses <= 0 {
+		opts.MaxUses = 1
+	}
+	if err := validateRedeemCodeOptions(opts.CodeLength, opts.ExpiresAt); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	campaign := models.RedeemCampaign{
+		ID:         utils.GenerateID(),
+		Name:       opts.Name,
+		Energy:     opts.Energy,
+		CodeCount:  opts.Count,
+		CodeLength: opts.CodeLength,
+		MaxUses:    opts.MaxUses,
+		ExpiresAt:  opts.ExpiresAt,
+		CreatedAt:  now,
+	}
+
+	var codes []models.RedeemCode
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		values, err := generateUniqueRedeemCodes(tx, opts.Count, opts.CodeLength)
+		if err != nil {
+			return err
+		}
+
+		codes = make([]models.RedeemCode, 0, len(values))
+		for _, value := range values {
+			codes = append(codes, models.RedeemCode{
+				ID:         utils.GenerateID(),
+				CampaignID: &campaign.ID,
+				Code:       value,
+				Energy:     opts.Energy,
+				MaxUses:    opts.MaxUses,
+				ExpiresAt:  opts.ExpiresAt,
+				CreatedAt:  now,
+			})
+		}
+
+		if err := tx.Create(&campaign).Error; err != nil {
+			return fmt.Errorf("创建兑换码批次失败: %w", err)
+		}
+		if err := tx.CreateInBatches(&codes, 500).Error; err != nil {
+			return fmt.Errorf("保存兑换码失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &campaign, codes, nil
+}
+
+// CreateSingleRedeemCode 创建一个不属于任何批次的单次兑换码
+func CreateSingleRedeemCode(energy int, codeLength int, expiresAt *time.Time) (*models.RedeemCode, error) {
+	if energy <= 0 {
+		return nil, fmt.Errorf("%w: 能量值必须大于 0", ErrInvalidRedeemOptions)
+	}
+	if codeLength == 0 {
+		codeLength = models.DefaultRedeemCodeLength
+	}
+	if err := validateRedeemCodeOptions(codeLength, expiresAt); err != nil {
+		return nil, err
+	}
+
+	var redeemCode models.RedeemCode
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		values, err := generateUniqueRedeemCodes(tx, 1, codeLength)
+		if err != nil {
+			return err
+		}
+		redeemCode = models.RedeemCode{
+			ID:        utils.GenerateID(),
+			Code:      values[0],
+			Energy:    energy,
+			MaxUses:   1,
+			ExpiresAt: expiresAt,
+			CreatedAt: time.Now(),
+		}
+		return tx.Create(&redeemCode).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redeemCode, nil
+}
+
+// validateRedeemCodeOptions 检查兑换码长度和过期时间
+func validateRedeemCodeOptions(codeLength int, expiresAt *time.Time) error {
+	if codeLength < models.MinRedeemCodeLength || codeLength > models.MaxRedeemCodeLength {
+		return fmt.Errorf("%w: 兑换码长度需在 %d 到 %d 之间", ErrInvalidRedeemOptions, models.MinRedeemCodeLength, models.MaxRedeemCodeLength)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: 过期时间必须晚于当前时间", ErrInvalidRedeemOptions)
+	}
+	return nil
+}
+
+// generateUniqueRedeemCodes 生成 count 个互不重复且数据库中不存在的兑换码
+func generateUniqueRedeemCodes(tx *gorm.DB, count int, length int) ([]string, error) {
+	unique := make(map[string]struct{}, count)
+	for round := 0; round < redeemCodeGenerateRounds && len(unique) < count; round++ {
+		pending := make([]string, 0, count-len(unique))
+		for len(unique)+len(pending) < count {
+			code, err := models.GenerateRedeemCode(length)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := unique[code]; exists {
+				continue
+			}
+			pending = append(pending, code)
+		}
+
+		// 剔除数据库中已存在的兑换码，剩余数量在下一轮补齐
+		var existing []string
+		if err := tx.Model(&models.RedeemCode{}).Where("code IN ?", pending).Pluck("code", &existing).Error; err != nil {
+			return nil, fmt.Errorf("查询兑换码失败: %w", err)
+		}
+		taken := make(map[string]struct{}, len(existing))
+		for _, code := range existing {
+			taken[code] = struct{}{}
+		}
+		for _, code := range pending {
+			if _, exists := taken[code]; !exists {
+				unique[code] = struct{}{}
+			}
+		}
+	}
+	if len(unique) < count {
+		return nil, errors.New("兑换码空间不足，请增加兑换码长度")
+	}
+
+	codes := make([]string, 0, count)
+	for code := range unique {
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// RedeemEnergyCode 为用户兑换能量码，返回兑换后的能量余额和兑换码。
+// 兑换码可被多个用户兑换直到次数用完，每个用户对同一兑换码只能兑换一次。
+func RedeemEnergyCode(uid string, code string) (int, *models.RedeemCode, error) {
+	var redeemCode models.RedeemCode
+	var newEnergy int
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定兑换码，并发兑换时按顺序检查剩余次数
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ?", NormalizeRedeemCode(code)).
+			First(&redeemCode).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRedeemCodeNotFound
+			}
+			return err
+		}
+
+		now := time.Now()
+		if redeemCode.ExpiresAt != nil && !redeemCode.ExpiresAt.After(now) {
+			return ErrRedeemCodeExpired
+		}
+		if redeemCode.UseCount >= redeemCode.MaxUses {
+			return ErrRedeemCodeUsed
+		}
+
+		redemption := models.RedeemRedemption{
+			ID:        utils.GenerateID(),
+			CodeID:    redeemCode.ID,
+			UserID:    uid,
+			Energy:    redeemCode.Energy,
+			CreatedAt: now,
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&redemption)
+		if created.Error != nil {
+			return fmt.Errorf("保存兑换记录失败: %w", created.Error)
+		}
+		if created.RowsAffected == 0 {
+			return ErrRedeemCodeAlreadyClaimed
+		}
+
+		redeemCode.UseCount++
+		updates := map[string]interface{}{"use_count": redeemCode.UseCount}
+		if redeemCode.UseCount >= redeemCode.MaxUses {
+			redeemCode.UsedAt = &now
+			updates["used_at"] = redeemCode.UsedAt
+		}
+		// 只有单次兑换码记录兑换用户，多次兑换码的兑换用户见兑换记录
+		if redeemCode.MaxUses == 1 {
+			redeemCode.UserID = &uid
+			updates["user_id"] = redeemCode.UserID
+		}
+		if err := tx.Model(&redeemCode).Updates(updates).Error; err != nil {
+			return fmt.Errorf("更新兑换码状态失败: %w", err)
+		}
+
+		var err error
+		newEnergy, err = ChangeEnergy(tx, uid, redeemCode.Energy, models.EnergyReasonRedeem, redeemCode.ID)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return newEnergy, &redeemCode, nil
+}
+
+// ListRedeemCampaignCodes 返回批次下的全部兑换码
+func ListRedeemCampaignCodes(campaignID string) (*models.RedeemCampaign, []models.RedeemCode, error) {
+	var campaign models.RedeemCampaign
+	if err := config.DB.Where("id = ?", campaignID).First(&campaign).Error; err != nil {
+		return nil, nil, err
+	}
+	var codes []models.RedeemCode
+	if err := config.DB.Where("campaign_id = ?", campaignID).Order("created_at asc, code asc").Find(&codes).Error; err != nil {
+		return nil, nil, err
+	}
+	return &campaign, codes, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// redeemTestModels 兑换测试需要的表
+var redeemTestModels = []interface{}{&models.User{}, &models.EnergyLedgerEntry{}, &models.RedeemCode{}, &models.RedeemRedemption{}}
+
+// setupRedeemUsers 创建能量为 10 的测试用户
+func setupRedeemUsers(t *testing.T, db *gorm.DB, uids ...string) {
+	t.Helper()
+	for _, uid := range uids {
+		if err := db.Create(&models.User{ID: uid, Energy: 10}).Error; err != nil {
+			t.Fatalf("创建测试用户失败: %v", err)
+		}
+	}
+}
+
+// assertRedeemCode 检查兑换码的已兑换次数和兑换记录数
+func assertRedeemCode(t *testing.T, db *gorm.DB, id string, useCount int) models.RedeemCode {
+	t.Helper()
+
+	var code models.RedeemCode
+	if err := db.First(&code, "id = ?", id).Error; err != nil {
+		t.Fatalf("查询兑换码失败: %v", err)
+	}
+	if code.UseCount != useCount {
+		t.Errorf("use_count = %d, want %d", code.UseCount, useCount)
+	}
+	var redemptions int64
+	if err := db.Model(&models.RedeemRedemption{}).Where("code_id = ?", id).Count(&redemptions).Error; err != nil {
+		t.Fatalf("统计兑换记录失败: %v", err)
+	}
+	if int(redemptions) != useCount {
+		t.Errorf("兑换记录数 = %d, want %d", redemptions, useCount)
+	}
+	return code
+}
+
+func TestRedeemEnergyCodeMaxUses(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, redeemTestModels...)
+	setupRedeemUsers(t, db, "user-a", "user-b", "user-c")
+	if err := db.Create(&models.RedeemCode{ID: "multi", Code: "MULTIUSE01", Energy: 20, MaxUses: 2}).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	cases := []struct {
+		uid        string
+		code       string
+		wantErr    error
+		wantEnergy int
+	}{
+		{uid: "user-a", code: "MULTIUSE01", wantEnergy: 30},
+		// 兑换码不区分大小写
+		{uid: "user-b", code: " multiuse01 ", wantEnergy: 30},
+		// 次数用完后其他用户也不能兑换
+		{uid: "user-c", code: "MULTIUSE01", wantErr: ErrRedeemCodeUsed, wantEnergy: 10},
+	}
+	for _, tc := range cases {
+		energy, _, err := RedeemEnergyCode(tc.uid, tc.code)
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("%s 兑换的错误 = %v, want %v", tc.uid, err, tc.wantErr)
+		}
+		if err == nil && energy != tc.wantEnergy {
+			t.Errorf("%s 兑换后返回的能量 = %d, want %d", tc.uid, energy, tc.wantEnergy)
+		}
+		if got := userEnergy(t, db, tc.uid); got != tc.wantEnergy {
+			t.Errorf("%s 的能量 = %d, want %d", tc.uid, got, tc.wantEnergy)
+		}
+	}
+
+	code := assertRedeemCode(t, db, "multi", 2)
+	if code.UsedAt == nil {
+		t.Errorf("次数用完后应记录 used_at")
+	}
+	// 多次兑换码的兑换用户只记录在兑换记录中
+	if code.UserID != nil {
+		t.Errorf("多次兑换码的 user_id = %q, want nil", *code.UserID)
+	}
+}
+
+func TestRedeemEnergyCodeOncePerUser(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, redeemTestModels...)
+	setupRedeemUsers(t, db, "redeem-user")
+	if err := db.Create(&models.RedeemCode{ID: "multi", Code: "MULTIUSE01", Energy: 20, MaxUses: 10}).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	if _, _, err := RedeemEnergyCode("redeem-user", "MULTIUSE01"); err != nil {
+		t.Fatalf("第一次兑换失败: %v", err)
+	}
+	// 兑换记录的唯一索引拒绝同一用户的第二次兑换，即使兑换码还有剩余次数
+	if _, _, err := RedeemEnergyCode("redeem-user", "MULTIUSE01"); !errors.Is(err, ErrRedeemCodeAlreadyClaimed) {
+		t.Fatalf("第二次兑换的错误 = %v, want %v", err, ErrRedeemCodeAlreadyClaimed)
+	}
+
+	code := assertRedeemCode(t, db, "multi", 1)
+	if code.UsedAt != nil {
+		t.Errorf("还有剩余次数时不应记录 used_at")
+	}
+	if got := userEnergy(t, db, "redeem-user"); got != 30 {
+		t.Errorf("能量 = %d, want 30", got)
+	}
+}
+
+func TestRedeemEnergyCodeExpired(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, redeemTestModels...)
+	setupRedeemUsers(t, db, "redeem-user")
+	past := time.Now().Add(-time.Minute)
+	if err := db.Create(&models.RedeemCode{ID: "expired", Code: "EXPIRED001", Energy: 20, MaxUses: 5, ExpiresAt: &past}).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	if _, _, err := RedeemEnergyCode("redeem-user", "EXPIRED001"); !errors.Is(err, ErrRedeemCodeExpired) {
+		t.Fatalf("兑换过期兑换码的错误 = %v, want %v", err, ErrRedeemCodeExpired)
+	}
+
+	assertRedeemCode(t, db, "expired", 0)
+	if got := userEnergy(t, db, "redeem-user"); got != 10 {
+		t.Errorf("能量 = %d, want 10", got)
+	}
+}
+
+func TestRedeemEnergyCodeConcurrent(t *testing.T) {
+	backends := []struct {
+		name  string
+		setup func(testing.TB, ...interface{}) *gorm.DB
+	}{
+		{name: "sqlite", setup: testutil.SetupDB},
+		// 设置 TEST_MYSQL_DSN 时在真实 MySQL 上验证 FOR UPDATE 行锁
+		{name: "mysql", setup: testutil.SetupMySQL},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			testutil.ObserveLogs(t)
+			db := backend.setup(t, redeemTestModels...)
+			runConcurrentRedemptions(t, db)
+		})
+	}
+}
+
+// runConcurrentRedemptions 多个用户同时兑换同一个单次兑换码，检查只有一个用户兑换成功
+func runConcurrentRedemptions(t *testing.T, db *gorm.DB) {
+	const workers = 20
+	uids := make([]string, workers)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("redeem-user-%d", i)
+	}
+	setupRedeemUsers(t, db, uids...)
+	if err := db.Create(&models.RedeemCode{ID: "single", Code: "SINGLECODE", Energy: 20, MaxUses: 1}).Error; err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		winners []string
+	)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, uid := range uids {
+		wg.Add(1)
+		go func(uid string) {
+			defer wg.Done()
+			<-start
+			_, _, err := RedeemEnergyCode(uid, "SINGLECODE")
+			switch {
+			case err == nil:
+				mu.Lock()
+				winners = append(winners, uid)
+				mu.Unlock()
+			case !errors.Is(err, ErrRedeemCodeUsed):
+				t.Errorf("%s 兑换失败: %v", uid, err)
+			}
+		}(uid)
+	}
+	close(start)
+	wg.Wait()
+
+	if len(winners) != 1 {
+		t.Fatalf("兑换成功 %d 次, want 1: %v", len(winners), winners)
+	}
+	code := assertRedeemCode(t, db, "single", 1)
+	if code.UserID == nil || *code.UserID != winners[0] {
+		t.Errorf("user_id = %v, want %s", code.UserID, winners[0])
+	}
+	for _, uid := range uids {
+		want := 10
+		if uid == winners[0] {
+			want = 30
+		}
+		if got := userEnergy(t, db, uid); got != want {
+			t.Errorf("%s 的能量 = %d, want %d", uid, got, want)
+		}
+	}
+}
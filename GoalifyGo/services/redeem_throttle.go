@@ -0,0 +1,212 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 兑换失败限流配置：窗口内失败次数达到上限后锁定，锁定时长随锁定次数指数增长。
+// 进行中的尝试也占用失败名额，成功后退还
+const (
+	redeemUserMaxFailures = 5
+	redeemIPMaxFailures   = 20
+	// 连续失败之间超过该时长后重新计数
+	redeemFailureWindow = 15 * time.Minute
+	// 首次锁定时长，之后每次锁定翻倍
+	redeemBaseLockout = time.Minute
+	redeemMaxLockout  = 24 * time.Hour
+	// 锁定次数的保留时长，期间再次锁定会延续指数增长
+	redeemLockoutMemory = 24 * time.Hour
+)
+
+// redeemSubject 限流对象：用户或客户端 IP
+type redeemSubject struct {
+	kind        string // user, ip
+	id          string
+	maxFailures int
+}
+
+func redeemSubjects(uid string, clientIP string) []redeemSubject {
+	return []redeemSubject{
+		{kind: "user", id: uid, maxFailures: redeemUserMaxFailures},
+		{kind: "ip", id: clientIP, maxFailures: redeemIPMaxFailures},
+	}
+}
+
+func (s redeemSubject) failuresKey() string {
+	return fmt.Sprintf("redeem:failures:%s:%s", s.kind, s.id)
+}
+
+func (s redeemSubject) lockKey() string {
+	return fmt.Sprintf("redeem:lock:%s:%s", s.kind, s.id)
+}
+
+func (s redeemSubject) lockoutsKey() string {
+	return fmt.Sprintf("redeem:lockouts:%s:%s", s.kind, s.id)
+}
+
+// RedeemAttempt 一次已预留名额的兑换尝试，兑换结束后必须调用 Fail 或 Succeed
+type RedeemAttempt struct {
+	uid      string
+	clientIP string
+	reserved []redeemSubject
+}
+
+// ReserveRedeemAttempt 在查询兑换码之前为用户和 IP 预留一次尝试名额。
+// 用户或 IP 被锁定，或窗口内的失败和进行中的尝试已达上限时拒绝，返回建议的重试等待时长。
+// 计数用 INCR 原子预留，并发请求不会越过上限；Redis 不可用时不阻塞兑换，只记录错误。
+func ReserveRedeemAttempt(uid string, clientIP string) (*RedeemAttempt, time.Duration) {
+	ctx := context.Background()
+	attempt := &RedeemAttempt{uid: uid, clientIP: clientIP}
+	subjects := redeemSubjects(uid, clientIP)
+
+	if remaining := redeemLockRemaining(ctx, subjects); remaining > 0 {
+		return nil, remaining
+	}
+
+	for _, subject := range subjects {
+		var attempts *redis.IntCmd
+		_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			attempts = pipe.Incr(ctx, subject.failuresKey())
+			pipe.Expire(ctx, subject.failuresKey(), redeemFailureWindow)
+			return nil
+		})
+		if err != nil {
+			config.Logger.Errorw("预留兑换尝试失败", "error", err, "key", subject.failuresKey())
+			continue
+		}
+		if attempts.Val() > int64(subject.maxFailures) {
+			// 超出上限，退还本次和之前已预留的名额
+			releaseRedeemSubject(ctx, subject)
+			attempt.Succeed()
+			if remaining := redeemLockRemaining(ctx, subjects); remaining > 0 {
+				return nil, remaining
+			}
+			return nil, time.Second
+		}
+		attempt.reserved = append(attempt.reserved, subject)
+	}
+	return attempt, 0
+}
+
+// redeemLockRemaining 返回用户或 IP 剩余的锁定时长，未锁定时为 0
+func redeemLockRemaining(ctx context.Context, subjects []redeemSubject) time.Duration {
+	var remaining time.Duration
+	for _, subject := range subjects {
+		ttl, err := config.RedisClient.PTTL(ctx, subject.lockKey()).Result()
+		if err != nil {
+			config.Logger.Errorw("读取兑换锁定状态失败", "error", err, "key", subject.lockKey())
+			continue
+		}
+		if ttl > remaining {
+			remaining = ttl
+		}
+	}
+	return remaining
+}
+
+// Fail 将预留的尝试记为失败，失败次数达到上限时锁定并返回锁定时长
+func (a *RedeemAttempt) Fail() time.Duration {
+	ctx := context.Background()
+	var lockout time.Duration
+	for _, subject := range a.reserved {
+		failures, err := config.RedisClient.Get(ctx, subject.failuresKey()).Int64()
+		if err != nil && err != redis.Nil {
+			config.Logger.Errorw("读取兑换失败次数失败", "error", err, "key", subject.failuresKey())
+			continue
+		}
+		if failures < int64(subject.maxFailures) {
+			continue
+		}
+
+		duration, level, err := lockRedeemSubject(ctx, subject)
+		if err != nil {
+			config.Logger.Errorw("锁定兑换失败", "error", err, "key", subject.lockKey())
+			continue
+		}
+		// 并发失败时由第一个请求锁定
+		if duration == 0 {
+			continue
+		}
+		config.LogSecurityEvent("redeem_bruteforce_lockout",
+			"uid", a.uid,
+			"clientIP", a.clientIP,
+			"subject", subject.kind,
+			"failures", failures,
+			"lockoutLevel", level,
+			"lockout", duration.String(),
+		)
+		if duration > lockout {
+			lockout = duration
+		}
+	}
+	a.reserved = nil
+	return lockout
+}
+
+// Succeed 兑换成功后退还预留的名额，成功的尝试不计入失败次数
+func (a *RedeemAttempt) Succeed() {
+	ctx := context.Background()
+	for _, subject := range a.reserved {
+		releaseRedeemSubject(ctx, subject)
+	}
+	a.reserved = nil
+}
+
+// releaseRedeemSubject 退还一次预留的名额
+func releaseRedeemSubject(ctx context.Context, subject redeemSubject) {
+	attempts, err := config.RedisClient.Decr(ctx, subject.failuresKey()).Result()
+	if err != nil {
+		config.Logger.Errorw("退还兑换尝试失败", "error", err, "key", subject.failuresKey())
+		return
+	}
+	// 锁定时已清空计数，之后退还的名额不能让计数变为负数
+	if attempts < 0 {
+		if err := config.RedisClient.Del(ctx, subject.failuresKey()).Err(); err != nil {
+			config.Logger.Errorw("清空兑换失败次数失败", "error", err, "key", subject.failuresKey())
+		}
+	}
+}
+
+// lockRedeemSubject 锁定限流对象并清空失败计数，返回锁定时长和第几次锁定；已被锁定时返回 0
+func lockRedeemSubject(ctx context.Context, subject redeemSubject) (time.Duration, int64, error) {
+	// 先占住锁，并发失败的请求只会锁定一次，不会重复升级锁定时长
+	locked, err := config.RedisClient.SetNX(ctx, subject.lockKey(), 0, redeemBaseLockout).Result()
+	if err != nil || !locked {
+		return 0, 0, err
+	}
+
+	var lockouts *redis.IntCmd
+	_, err = config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		lockouts = pipe.Incr(ctx, subject.lockoutsKey())
+		pipe.Expire(ctx, subject.lockoutsKey(), redeemLockoutMemory)
+		pipe.Del(ctx, subject.failuresKey())
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	level := lockouts.Val()
+	duration := redeemLockoutDuration(level)
+	if err := config.RedisClient.Set(ctx, subject.lockKey(), level, duration).Err(); err != nil {
+		return 0, 0, err
+	}
+	return duration, level, nil
+}
+
+// redeemLockoutDuration 第 level 次锁定的时长：从 redeemBaseLockout 开始翻倍，不超过 redeemMaxLockout
+func redeemLockoutDuration(level int64) time.Duration {
+	duration := redeemBaseLockout
+	for i := int64(1); i < level && duration < redeemMaxLockout; i++ {
+		duration *= 2
+	}
+	if duration > redeemMaxLockout {
+		duration = redeemMaxLockout
+	}
+	return duration
+}
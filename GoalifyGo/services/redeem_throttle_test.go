@@ -0,0 +1,135 @@
+package services
+
+import (
+	"GoalifyGo/testutil"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failRedeemAttempts 以 uid 和 clientIP 连续失败 n 次，返回最后一次失败的锁定时长
+func failRedeemAttempts(t *testing.T, uid string, clientIP string, n int) time.Duration {
+	t.Helper()
+	var lockout time.Duration
+	for i := 0; i < n; i++ {
+		attempt, retryAfter := ReserveRedeemAttempt(uid, clientIP)
+		if attempt == nil {
+			t.Fatalf("第 %d 次尝试被拒绝, retryAfter = %v", i+1, retryAfter)
+		}
+		lockout = attempt.Fail()
+	}
+	return lockout
+}
+
+func TestRedeemLockoutEscalation(t *testing.T) {
+	logs := testutil.ObserveLogs(t)
+	redis := testutil.SetupRedis(t)
+
+	const uid = "redeem-user"
+	user := redeemSubjects(uid, "")[0]
+	want := []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		16 * time.Minute, 32 * time.Minute, 64 * time.Minute, 128 * time.Minute,
+		256 * time.Minute, 512 * time.Minute, 1024 * time.Minute,
+		24 * time.Hour, 24 * time.Hour,
+	}
+	for i, duration := range want {
+		// 每轮换一个 IP，只触发用户维度的锁定
+		clientIP := fmt.Sprintf("10.0.0.%d", i+1)
+		if got := failRedeemAttempts(t, uid, clientIP, redeemUserMaxFailures-1); got != 0 {
+			t.Fatalf("第 %d 轮未达上限就锁定了 %v", i+1, got)
+		}
+		if got := failRedeemAttempts(t, uid, clientIP, 1); got != duration {
+			t.Errorf("第 %d 次锁定时长 = %v, want %v", i+1, got, duration)
+		}
+		if ttl := redis.TTL(user.lockKey()); ttl != duration {
+			t.Errorf("第 %d 次锁定的过期时间 = %v, want %v", i+1, ttl, duration)
+		}
+
+		// 锁定期间不再预留名额
+		if attempt, retryAfter := ReserveRedeemAttempt(uid, clientIP); attempt != nil || retryAfter <= 0 {
+			t.Fatalf("锁定期间应拒绝尝试, retryAfter = %v", retryAfter)
+		}
+		// 模拟锁定到期
+		redis.Del(user.lockKey())
+	}
+
+	events := testutil.SecurityEvents(logs, "redeem_bruteforce_lockout")
+	if len(events) != len(want) {
+		t.Fatalf("安全事件数 = %d, want %d", len(events), len(want))
+	}
+	last := events[len(events)-1].ContextMap()
+	if last["uid"] != uid || last["subject"] != "user" || last["lockoutLevel"] != int64(len(want)) || last["lockout"] != (24*time.Hour).String() {
+		t.Errorf("最后一次锁定的安全事件 = %v", last)
+	}
+}
+
+func TestRedeemIPLockoutAcrossUsers(t *testing.T) {
+	logs := testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	// 同一 IP 轮换账号试探，每个账号都不超过用户上限
+	const clientIP = "10.0.0.1"
+	var lockout time.Duration
+	for i := 0; i < redeemIPMaxFailures; i++ {
+		lockout = failRedeemAttempts(t, fmt.Sprintf("user-%d", i), clientIP, 1)
+	}
+	if lockout != redeemBaseLockout {
+		t.Errorf("IP 锁定时长 = %v, want %v", lockout, redeemBaseLockout)
+	}
+	if attempt, _ := ReserveRedeemAttempt("another-user", clientIP); attempt != nil {
+		t.Errorf("IP 锁定后其他用户也应被拒绝")
+	}
+	events := testutil.SecurityEvents(logs, "redeem_bruteforce_lockout")
+	if len(events) != 1 || events[0].ContextMap()["subject"] != "ip" {
+		t.Errorf("安全事件 = %v, want 一次 IP 锁定", events)
+	}
+}
+
+func TestReserveRedeemAttemptConcurrent(t *testing.T) {
+	testutil.ObserveLogs(t)
+	testutil.SetupRedis(t)
+
+	const (
+		uid      = "redeem-user"
+		clientIP = "10.0.0.1"
+		workers  = 50
+	)
+
+	var (
+		mu       sync.Mutex
+		attempts []*RedeemAttempt
+	)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if attempt, _ := ReserveRedeemAttempt(uid, clientIP); attempt != nil {
+				mu.Lock()
+				attempts = append(attempts, attempt)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	// 先查询后计数时并发请求都能通过检查，原子预留后最多通过上限次
+	if len(attempts) != redeemUserMaxFailures {
+		t.Fatalf("并发预留成功 %d 次, want %d", len(attempts), redeemUserMaxFailures)
+	}
+
+	// 成功的尝试退还名额，之后可以继续兑换
+	for _, attempt := range attempts {
+		attempt.Succeed()
+	}
+	attempt, retryAfter := ReserveRedeemAttempt(uid, clientIP)
+	if attempt == nil {
+		t.Fatalf("退还名额后应允许尝试, retryAfter = %v", retryAfter)
+	}
+	attempt.Succeed()
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// StreamEvent 流式生成中的一个事件：内容片段、结束时的用量或生成错误，三者只有一个有值
+type StreamEvent struct {
+	Content string
+	Usage   *TokenUsage
+	Err     error
+}
+
+// TokenUsage 模型调用的 token 用量
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// sendStreamEvent 发送流式事件，调用方已断开（ctx 结束）时放弃发送，避免生成协程永久阻塞
+func sendStreamEvent(ctx context.Context, out chan<- StreamEvent, event StreamEvent) error {
+	select {
+	case out <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// usageFromResponse 从模型响应中读取 token 用量，未返回用量时各项为 0
+func usageFromResponse(resp *llms.ContentResponse) *TokenUsage {
+	usage := &TokenUsage{}
+	if resp == nil || len(resp.Choices) == 0 {
+		return usage
+	}
+
+	info := resp.Choices[0].GenerationInfo
+	usage.PromptTokens = intFromInfo(info, "PromptTokens")
+	usage.CompletionTokens = intFromInfo(info, "CompletionTokens")
+	usage.TotalTokens = intFromInfo(info, "TotalTokens")
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
+
+func intFromInfo(info map[string]any, key string) int {
+	switch v := info[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 教练回复中结构化数据的起止标记
+const (
+	jsonStartMarker = "[[JSON_START]]"
+	jsonEndMarker   = "[[JSON_END]]"
+)
+
+// ErrNoStructuredBlock 回复中没有结构化数据块
+var ErrNoStructuredBlock = errors.New("未找到结构化数据")
+
+// 任务计划校验规则
+const (
+	maxPlanTasks      = 15
+	maxPlanTitleRunes = 15
+	maxPlanNotesRunes = 100
+)
+
+var (
+	validPlanPriorities      = map[int]bool{0: true, 1: true, 5: true, 9: true}
+	validPlanRecurrenceRules = map[string]bool{"none": true, "daily": true, "weekly": true, "monthly": true, "yearly": true}
+)
+
+// ExtractStructuredBlock 提取回复中最后一个 [[JSON_START]] 与 [[JSON_END]] 之间的内容
+func ExtractStructuredBlock(text string) (string, error) {
+	start := strings.LastIndex(text, jsonStartMarker)
+	if start < 0 {
+		return "", ErrNoStructuredBlock
+	}
+	rest := text[start+len(jsonStartMarker):]
+	end := strings.Index(rest, jsonEndMarker)
+	if end < 0 {
+		return "", ErrNoStructuredBlock
+	}
+	return strings.TrimSpace(rest[:end]), nil
+}
+
+// ParseTaskPlan 从 Logic 教练的回复中解析并校验任务计划。
+// 无效的任务会被丢弃并在 invalid 中返回原因，只有没有任何有效任务时才返回错误。
+func ParseTaskPlan(text string) (tasks models.PlanTasks, invalid []error, err error) {
+	block, err := ExtractStructuredBlock(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payload struct {
+		Tasks models.PlanTasks `json:"tasks"`
+	}
+	if err := json.Unmarshal([]byte(block), &payload); err != nil {
+		return nil, nil, fmt.Errorf("任务计划格式错误: %w", err)
+	}
+
+	if len(payload.Tasks) == 0 {
+		return nil, nil, fmt.Errorf("任务计划为空")
+	}
+	if len(payload.Tasks) > maxPlanTasks {
+		return nil, nil, fmt.Errorf("任务数量超过%d个", maxPlanTasks)
+	}
+	for i := range payload.Tasks {
+		if err := validatePlanTask(&payload.Tasks[i]); err != nil {
+			invalid = append(invalid, fmt.Errorf("第%d个任务无效: %w", i+1, err))
+			continue
+		}
+		tasks = append(tasks, payload.Tasks[i])
+	}
+	if len(tasks) == 0 {
+		return nil, invalid, fmt.Errorf("任务计划中没有有效任务")
+	}
+	return tasks, invalid, nil
+}
+
+// validatePlanTask 校验单个计划任务，并补全默认值
+func validatePlanTask(task *models.PlanTask) error {
+	task.Title = strings.TrimSpace(task.Title)
+	if task.Title == "" {
+		return fmt.Errorf("标题为空")
+	}
+	if utf8.RuneCountInString(task.Title) > maxPlanTitleRunes {
+		return fmt.Errorf("标题超过%d字", maxPlanTitleRunes)
+	}
+	if utf8.RuneCountInString(task.Notes) > maxPlanNotesRunes {
+		return fmt.Errorf("备注超过%d字", maxPlanNotesRunes)
+	}
+	if !validPlanPriorities[task.Priority] {
+		return fmt.Errorf("无效的优先级: %d", task.Priority)
+	}
+
+	if task.RecurrenceRule == "" {
+		task.RecurrenceRule = "none"
+	}
+	if !validPlanRecurrenceRules[task.RecurrenceRule] {
+		return fmt.Errorf("无效的重复规则: %s", task.RecurrenceRule)
+	}
+	if task.RecurrenceInterval <= 0 {
+		task.RecurrenceInterval = 1
+	}
+
+	if task.DueDate != "" {
+		if _, err := ParsePlanTime(task.DueDate); err != nil {
+			return fmt.Errorf("无效的计划时间: %s", task.DueDate)
+		}
+	}
+	if task.HasAlarm {
+		if task.AlarmDate == "" {
+			return fmt.Errorf("缺少提醒时间")
+		}
+		if _, err := ParsePlanTime(task.AlarmDate); err != nil {
+			return fmt.Errorf("无效的提醒时间: %s", task.AlarmDate)
+		}
+	}
+	return nil
+}
+
+// ParsePlanTime 解析任务计划中的 ISO8601 时间并转换为 UTC
+func ParsePlanTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// 情绪记录校验规则
+const (
+	maxEmotionTypeRunes    = 50
+	maxHealthyEmotionRunes = 50
+)
+
+// ParseEmotionRecord 从 Orange 教练的回复中解析并校验情绪记录
+func ParseEmotionRecord(text string) (*models.PendingEmotion, error) {
+	block, err := ExtractStructuredBlock(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		EmotionRecord *struct {
+			EmotionType      string `json:"emotionType"`
+			Intensity        int    `json:"intensity"`
+			Trigger          string `json:"trigger"`
+			UnhealthyBeliefs string `json:"unhealthyBeliefs"`
+			HealthyEmotion   string `json:"healthyEmotion"`
+			CopingStrategies string `json:"copingStrategies"`
+		} `json:"emotion_record"`
+	}
+	if err := json.Unmarshal([]byte(block), &payload); err != nil {
+		return nil, fmt.Errorf("情绪记录格式错误: %w", err)
+	}
+	record := payload.EmotionRecord
+	if record == nil {
+		return nil, ErrNoStructuredBlock
+	}
+
+	record.EmotionType = strings.TrimSpace(record.EmotionType)
+	if record.EmotionType == "" {
+		return nil, fmt.Errorf("情绪类型为空")
+	}
+	if utf8.RuneCountInString(record.EmotionType) > maxEmotionTypeRunes {
+		return nil, fmt.Errorf("情绪类型超过%d字", maxEmotionTypeRunes)
+	}
+	if utf8.RuneCountInString(record.HealthyEmotion) > maxHealthyEmotionRunes {
+		return nil, fmt.Errorf("健康情绪超过%d字", maxHealthyEmotionRunes)
+	}
+	// 情绪强度只允许 1 消极 2 中性 3 积极
+	if record.Intensity < 1 || record.Intensity > 3 {
+		return nil, fmt.Errorf("无效的情绪强度: %d", record.Intensity)
+	}
+
+	return &models.PendingEmotion{
+		EmotionType:      record.EmotionType,
+		Intensity:        record.Intensity,
+		Trigger:          record.Trigger,
+		UnhealthyBeliefs: record.UnhealthyBeliefs,
+		HealthyEmotion:   record.HealthyEmotion,
+		CopingStrategies: record.CopingStrategies,
+	}, nil
+}
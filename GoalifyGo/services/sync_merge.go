@@ -0,0 +1,147 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"time"
+)
+
+// MergeResult 字段级合并结果
+type MergeResult struct {
+	Changed   bool     // 服务端记录是否被修改
+	Conflicts []string // 客户端修改了但因服务端版本更新而被丢弃的字段
+}
+
+// clientFallbackTime 返回字段没有单独修改时间时使用的客户端时间。
+// 只使用客户端提交的时间，不与服务端写入时间比较；旧数据没有客户端时间时采用客户端的值。
+func clientFallbackTime(clientModified *time.Time) time.Time {
+	if clientModified == nil {
+		return time.Time{}
+	}
+	return *clientModified
+}
+
+// laterClientTime 返回两个客户端修改时间中较晚的一个
+func laterClientTime(current *time.Time, incoming time.Time) *time.Time {
+	if current != nil && current.After(incoming) {
+		return current
+	}
+	return &incoming
+}
+
+// mergeField 按字段修改时间合并单个字段：客户端时间更晚则采用客户端的值，否则保留服务端的值并记录冲突
+func mergeField[T any](result *MergeResult, fieldModified models.FieldTimestamps, fallback time.Time,
+	field string, current *T, incoming T, incomingAt time.Time, equal func(a, b T) bool) {
+	if equal(*current, incoming) {
+		return
+	}
+
+	currentAt, ok := fieldModified[field]
+	if !ok {
+		currentAt = fallback
+	}
+
+	if incomingAt.After(currentAt) {
+		*current = incoming
+		fieldModified[field] = incomingAt
+		result.Changed = true
+		return
+	}
+	result.Conflicts = append(result.Conflicts, field)
+}
+
+func equalValue[T comparable](a, b T) bool {
+	return a == b
+}
+
+func equalTime(a, b time.Time) bool {
+	return a.Equal(b)
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// MergeEmotion 将客户端的情绪记录按字段合并到服务端记录
+func MergeEmotion(existing *models.EmotionRecord, req *models.SyncEmotionsRequest) MergeResult {
+	var result MergeResult
+
+	// 已删除的记录不会被普通写入恢复，避免离线设备的旧修改复活已删除的数据
+	if existing.Status == models.StatusDeleted {
+		return result
+	}
+
+	if existing.FieldModified == nil {
+		existing.FieldModified = make(models.FieldTimestamps)
+	}
+	fm, fallback := existing.FieldModified, clientFallbackTime(existing.ClientModified)
+
+	mergeField(&result, fm, fallback, "emotionType", &existing.EmotionType, req.EmotionType, req.FieldTime("emotionType"), equalValue[string])
+	mergeField(&result, fm, fallback, "intensity", &existing.Intensity, req.Intensity, req.FieldTime("intensity"), equalValue[int])
+	mergeField(&result, fm, fallback, "trigger", &existing.Trigger, req.Trigger, req.FieldTime("trigger"), equalValue[string])
+	mergeField(&result, fm, fallback, "unhealthyBeliefs", &existing.UnhealthyBeliefs, req.UnhealthyBeliefs, req.FieldTime("unhealthyBeliefs"), equalValue[string])
+	mergeField(&result, fm, fallback, "healthyEmotion", &existing.HealthyEmotion, req.HealthyEmotion, req.FieldTime("healthyEmotion"), equalValue[string])
+	mergeField(&result, fm, fallback, "copingStrategies", &existing.CopingStrategies, req.CopingStrategies, req.FieldTime("copingStrategies"), equalValue[string])
+	mergeField(&result, fm, fallback, "recordDate", &existing.RecordDate, req.RecordDate, req.FieldTime("recordDate"), equalTime)
+
+	if result.Changed {
+		existing.ClientModified = laterClientTime(existing.ClientModified, req.LastModified)
+	}
+	return result
+}
+
+// MergeTask 将客户端的任务按字段合并到服务端记录
+func MergeTask(existing *models.Task, req *models.SyncTasksRequest) MergeResult {
+	var result MergeResult
+
+	// 已删除的任务不会被普通写入恢复
+	if existing.Status == models.StatusDeleted {
+		return result
+	}
+
+	if existing.FieldModified == nil {
+		existing.FieldModified = make(models.FieldTimestamps)
+	}
+	fm, fallback := existing.FieldModified, clientFallbackTime(existing.ClientModified)
+
+	mergeField(&result, fm, fallback, "title", &existing.Title, req.Title, req.FieldTime("title"), equalValue[string])
+	mergeField(&result, fm, fallback, "isCompleted", &existing.IsCompleted, req.IsCompleted, req.FieldTime("isCompleted"), equalValue[bool])
+	mergeField(&result, fm, fallback, "notes", &existing.Notes, req.Notes, req.FieldTime("notes"), equalValue[string])
+	mergeField(&result, fm, fallback, "deadline", &existing.Deadline, req.Deadline, req.FieldTime("deadline"), equalTimePtr)
+	mergeField(&result, fm, fallback, "plannedDate", &existing.PlannedDate, req.PlannedDate, req.FieldTime("plannedDate"), equalTimePtr)
+	mergeField(&result, fm, fallback, "difficulty", &existing.Difficulty, req.Difficulty, req.FieldTime("difficulty"), equalValue[int])
+	mergeField(&result, fm, fallback, "quadrant", &existing.Quadrant, req.Quadrant, req.FieldTime("quadrant"), equalValue[string])
+	mergeField(&result, fm, fallback, "repeatType", &existing.RepeatType, req.RepeatType, req.FieldTime("repeatType"), equalValue[string])
+	// 旧版客户端不提交提醒、重复间隔和优先级，此时保留服务端的值，不会被清空
+	if req.HasAlarm != nil {
+		mergeField(&result, fm, fallback, "alarmDate", &existing.AlarmDate, req.Alarm(), req.FieldTime("alarmDate"), equalTimePtr)
+	}
+	if req.RepeatInterval != nil {
+		mergeField(&result, fm, fallback, "repeatInterval", &existing.RepeatInterval, req.Interval(), req.FieldTime("repeatInterval"), equalValue[int])
+	}
+	if req.Priority != nil {
+		mergeField(&result, fm, fallback, "priority", &existing.Priority, req.PriorityLevel(), req.FieldTime("priority"), equalValue[int])
+	}
+
+	if result.Changed {
+		existing.ClientModified = laterClientTime(existing.ClientModified, req.LastModified)
+	}
+	return result
+}
+
+// NewFieldTimestamps 为新建记录生成各字段的修改时间
+func NewFieldTimestamps(fields []string, fieldTime func(field string) time.Time) models.FieldTimestamps {
+	fm := make(models.FieldTimestamps, len(fields))
+	for _, field := range fields {
+		fm[field] = fieldTime(field)
+	}
+	return fm
+}
+
+// 参与字段级合并的字段
+var (
+	EmotionMergeFields = []string{"emotionType", "intensity", "trigger", "unhealthyBeliefs", "healthyEmotion", "copingStrategies", "recordDate"}
+	TaskMergeFields    = []string{"title", "isCompleted", "notes", "deadline", "plannedDate", "difficulty", "quadrant", "repeatType", "alarmDate", "repeatInterval", "priority"}
+)
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeTaskKeepsAlarmForOldClients(t *testing.T) {
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	alarm := modified.Add(24 * time.Hour)
+	existing := models.Task{
+		ID:             "T1",
+		Title:          "复习",
+		AlarmDate:      &alarm,
+		RepeatInterval: 2,
+		Priority:       5,
+		FieldModified:  NewFieldTimestamps(TaskMergeFields, func(string) time.Time { return modified }),
+	}
+
+	// 旧版客户端不提交提醒、重复间隔和优先级，保留服务端的值
+	oldClient := &models.SyncTasksRequest{ID: "T1", Title: "复习第一章", LastModified: modified.Add(time.Hour)}
+	MergeTask(&existing, oldClient)
+	if existing.Title != "复习第一章" {
+		t.Fatalf("标题 = %q, want 合并客户端的修改", existing.Title)
+	}
+	if existing.AlarmDate == nil || existing.RepeatInterval != 2 || existing.Priority != 5 {
+		t.Errorf("旧版客户端清空了提醒、重复间隔或优先级: %v/%d/%d", existing.AlarmDate, existing.RepeatInterval, existing.Priority)
+	}
+
+	// 新版客户端关闭提醒
+	off := false
+	newClient := &models.SyncTasksRequest{ID: "T1", Title: "复习第一章", HasAlarm: &off, LastModified: modified.Add(2 * time.Hour)}
+	MergeTask(&existing, newClient)
+	if existing.AlarmDate != nil {
+		t.Errorf("提醒时间 = %v, want 已关闭", existing.AlarmDate)
+	}
+}
+
+func TestMergeTaskKeepsEditsToDifferentFields(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	existing := models.Task{
+		ID:            "T1",
+		Title:         "复习",
+		Notes:         "第一章",
+		FieldModified: NewFieldTimestamps(TaskMergeFields, func(string) time.Time { return base }),
+	}
+
+	// 设备 A 修改标题
+	deviceA := &models.SyncTasksRequest{
+		ID:            "T1",
+		Title:         "复习数学",
+		Notes:         "第一章",
+		LastModified:  base.Add(time.Hour),
+		FieldModified: map[string]time.Time{"title": base.Add(time.Hour)},
+	}
+	if result := MergeTask(&existing, deviceA); !result.Changed || len(result.Conflicts) != 0 {
+		t.Fatalf("设备 A 合并结果 = %+v, want 修改且无冲突", result)
+	}
+
+	// 设备 B 在同步到 A 的修改之前离线修改了备注，提交的标题仍是旧值
+	deviceB := &models.SyncTasksRequest{
+		ID:            "T1",
+		Title:         "复习",
+		Notes:         "第一章和第二章",
+		LastModified:  base.Add(2 * time.Hour),
+		FieldModified: map[string]time.Time{"title": base, "notes": base.Add(2 * time.Hour)},
+	}
+	result := MergeTask(&existing, deviceB)
+	if !result.Changed {
+		t.Fatalf("设备 B 的备注没有合并")
+	}
+	if existing.Title != "复习数学" || existing.Notes != "第一章和第二章" {
+		t.Errorf("合并后 = %q/%q, want 同时保留两台设备的修改", existing.Title, existing.Notes)
+	}
+	// B 的旧标题被丢弃，作为冲突返回，客户端据此采用服务端版本
+	if len(result.Conflicts) != 1 || result.Conflicts[0] != "title" {
+		t.Errorf("conflicts = %v, want [title]", result.Conflicts)
+	}
+	if !existing.FieldModified["title"].Equal(base.Add(time.Hour)) || !existing.FieldModified["notes"].Equal(base.Add(2*time.Hour)) {
+		t.Errorf("字段修改时间 = %v", existing.FieldModified)
+	}
+}
+
+func TestMergeTaskResolvesSameFieldByFieldTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name          string
+		titleModified time.Time
+		wantTitle     string
+		wantConflicts []string
+	}{
+		// 客户端整体修改时间更晚，但标题的修改早于服务端，服务端的标题胜出
+		{name: "server wins", titleModified: base.Add(time.Hour), wantTitle: "服务端标题", wantConflicts: []string{"title"}},
+		{name: "client wins", titleModified: base.Add(3 * time.Hour), wantTitle: "客户端标题"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := models.Task{
+				ID:            "T1",
+				Title:         "服务端标题",
+				FieldModified: NewFieldTimestamps(TaskMergeFields, func(string) time.Time { return base }),
+			}
+			existing.FieldModified["title"] = base.Add(2 * time.Hour)
+
+			req := &models.SyncTasksRequest{
+				ID:            "T1",
+				Title:         "客户端标题",
+				LastModified:  base.Add(4 * time.Hour),
+				FieldModified: map[string]time.Time{"title": tc.titleModified},
+			}
+			result := MergeTask(&existing, req)
+			if existing.Title != tc.wantTitle {
+				t.Errorf("标题 = %q, want %q", existing.Title, tc.wantTitle)
+			}
+			if strings.Join(result.Conflicts, ",") != strings.Join(tc.wantConflicts, ",") {
+				t.Errorf("conflicts = %v, want %v", result.Conflicts, tc.wantConflicts)
+			}
+			if result.Changed != (tc.wantConflicts == nil) {
+				t.Errorf("changed = %v", result.Changed)
+			}
+		})
+	}
+}
+
+func TestMergeEmotionFallsBackToClientTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clientModified := base.Add(2 * time.Hour)
+
+	cases := []struct {
+		name           string
+		clientModified *time.Time // 服务端记录的客户端修改时间
+		lastModified   time.Time  // 请求的修改时间，请求没有字段修改时间
+		wantTrigger    string
+		wantConflict   bool
+	}{
+		{name: "older request", clientModified: &clientModified, lastModified: base.Add(time.Hour), wantTrigger: "旧的诱因", wantConflict: true},
+		{name: "newer request", clientModified: &clientModified, lastModified: base.Add(3 * time.Hour), wantTrigger: "新的诱因"},
+		// 旧数据没有客户端时间，采用客户端的值
+		{name: "legacy row", lastModified: base, wantTrigger: "新的诱因"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 旧数据没有字段修改时间，服务端写入时间不参与比较
+			existing := models.EmotionRecord{
+				ID:             "E1",
+				EmotionType:    "焦虑",
+				Trigger:        "旧的诱因",
+				LastModified:   base.Add(10 * time.Hour),
+				ClientModified: tc.clientModified,
+			}
+			req := &models.SyncEmotionsRequest{
+				ID:           "E1",
+				EmotionType:  "焦虑",
+				Trigger:      "新的诱因",
+				LastModified: tc.lastModified,
+			}
+			result := MergeEmotion(&existing, req)
+			if existing.Trigger != tc.wantTrigger {
+				t.Errorf("诱因 = %q, want %q", existing.Trigger, tc.wantTrigger)
+			}
+			if got := len(result.Conflicts) > 0; got != tc.wantConflict {
+				t.Errorf("conflicts = %v, want conflict %v", result.Conflicts, tc.wantConflict)
+			}
+			if tc.wantConflict {
+				return
+			}
+			if !existing.FieldModified["trigger"].Equal(tc.lastModified) {
+				t.Errorf("诱因的修改时间 = %v, want %v", existing.FieldModified["trigger"], tc.lastModified)
+			}
+			if existing.ClientModified == nil || existing.ClientModified.Before(tc.lastModified) {
+				t.Errorf("客户端修改时间 = %v, want 不早于 %v", existing.ClientModified, tc.lastModified)
+			}
+		})
+	}
+}
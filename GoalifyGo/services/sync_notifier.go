@@ -0,0 +1,64 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	syncStreamsClosing   = make(chan struct{})
+	syncStreamsCloseOnce sync.Once
+)
+
+// syncChannel 返回用户同步变更通知的 Redis 频道
+func syncChannel(uid string) string {
+	return fmt.Sprintf("sync:changes:%s", uid)
+}
+
+// PublishSyncChange 在同步写入提交后通过 Redis 发布变更通知，所有实例上该用户的订阅连接都会收到
+func PublishSyncChange(uid string, entityType string, entityID string, seq int64) {
+	event := models.SyncChangeEvent{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Cursor:     EncodeSyncCursor(seq),
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		config.Logger.Errorw("序列化同步变更通知失败", "error", err, "uid", uid)
+		return
+	}
+
+	if err := config.RedisClient.Publish(context.Background(), syncChannel(uid), payload).Err(); err != nil {
+		// 通知失败不影响数据写入，客户端仍可通过轮询获取变更
+		config.Logger.Errorw("发布同步变更通知失败", "error", err, "uid", uid, "type", entityType, "id", entityID)
+	}
+}
+
+// SubscribeSyncChanges 订阅用户的同步变更通知，调用方负责关闭返回的订阅
+func SubscribeSyncChanges(ctx context.Context, uid string) (*redis.PubSub, error) {
+	pubsub := config.RedisClient.Subscribe(ctx, syncChannel(uid))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("订阅同步变更失败: %w", err)
+	}
+	return pubsub, nil
+}
+
+// SyncStreamsClosing 返回服务关闭信号，长连接在收到信号后应主动结束
+func SyncStreamsClosing() <-chan struct{} {
+	return syncStreamsClosing
+}
+
+// CloseSyncStreams 通知所有同步推送长连接结束，用于优雅关闭
+func CloseSyncStreams() {
+	syncStreamsCloseOnce.Do(func() {
+		close(syncStreamsClosing)
+	})
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"GoalifyGo/config"
+	"GoalifyGo/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 默认墓碑保留时长，超过该时长未同步的设备需要全量同步
+const defaultTombstoneRetention = 90 * 24 * time.Hour
+
+// tombstoneRetention 删除墓碑保留时长，由 ConfigureTombstoneRetention 设置
+var tombstoneRetention = defaultTombstoneRetention
+
+// ConfigureTombstoneRetention 设置删除墓碑保留天数，不大于 0 时使用默认值
+func ConfigureTombstoneRetention(retentionDays int) {
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		retention = defaultTombstoneRetention
+	}
+	tombstoneRetention = retention
+}
+
+// TombstoneCutoff 返回墓碑保留期的起点，早于该时间的删除记录可能已被物理删除
+func TombstoneCutoff() time.Time {
+	return time.Now().Add(-tombstoneRetention)
+}
+
+// TombstoneCollector 定期清理超过保留期的删除墓碑及其变更日志
+type TombstoneCollector struct {
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewTombstoneCollector 创建清理任务，保留期由 ConfigureTombstoneRetention 设置
+func NewTombstoneCollector() *TombstoneCollector {
+	return &TombstoneCollector{
+		interval: 24 * time.Hour,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start 在后台启动清理任务
+func (tc *TombstoneCollector) Start() {
+	tc.wg.Add(1)
+	go func() {
+		defer tc.wg.Done()
+
+		ticker := time.NewTicker(tc.interval)
+		defer ticker.Stop()
+
+		tc.purge()
+		for {
+			select {
+			case <-ticker.C:
+				tc.purge()
+			case <-tc.stop:
+				return
+			}
+		}
+	}()
+}
+
+// purge 物理删除过期墓碑，并清理这些记录的变更日志
+func (tc *TombstoneCollector) purge() {
+	cutoff := TombstoneCutoff()
+
+	for entity, model := range models.SyncEntityModels {
+		result := config.DB.Where("status = ? AND last_modified < ?", models.StatusDeleted, cutoff).Delete(model)
+		if result.Error != nil {
+			config.Logger.Errorw("清理删除墓碑失败", "error", result.Error, "type", entity)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			config.Logger.Infow("清理删除墓碑", "type", entity, "count", result.RowsAffected)
+		}
+
+		pruned, err := pruneChanges(entity, model, cutoff)
+		if err != nil {
+			config.Logger.Errorw("清理同步变更日志失败", "error", err, "type", entity)
+			continue
+		}
+		if pruned > 0 {
+			config.Logger.Infow("清理同步变更日志", "type", entity, "count", pruned)
+		}
+	}
+}
+
+// pruneChanges 删除早于 cutoff 且对应记录已不存在的变更日志，返回删除的条数。
+// 删除前记录每个用户被清理的最大序号，游标早于该序号的设备会漏掉这些删除，需要重新全量同步。
+func pruneChanges(entityType string, model interface{}, cutoff time.Time) (int64, error) {
+	var pruned int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 期间重新写入的记录会更新 changed_at，不会被删除
+		stale := func() *gorm.DB {
+			return tx.Model(&models.SyncChange{}).
+				Where("entity_type = ? AND changed_at < ? AND entity_id NOT IN (?)", entityType, cutoff, tx.Model(model).Select("id"))
+		}
+
+		var maxSeqs []struct {
+			UserID string
+			Seq    int64
+		}
+		if err := stale().Select("user_id, MAX(seq) AS seq").Group("user_id").Scan(&maxSeqs).Error; err != nil {
+			return err
+		}
+		for _, maxSeq := range maxSeqs {
+			if err := tx.Model(&models.User{}).
+				Where("id = ? AND sync_pruned_seq < ?", maxSeq.UserID, maxSeq.Seq).
+				UpdateColumn("sync_pruned_seq", maxSeq.Seq).Error; err != nil {
+				return err
+			}
+		}
+
+		result := stale().Delete(&models.SyncChange{})
+		pruned = result.RowsAffected
+		return result.Error
+	})
+	return pruned, err
+}
+
+// Stop 停止清理任务并等待当前清理完成
+func (tc *TombstoneCollector) Stop() {
+	close(tc.stop)
+	tc.wg.Wait()
+}
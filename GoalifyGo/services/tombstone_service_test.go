@@ -0,0 +1,63 @@
+package services
+
+import (
+	"GoalifyGo/models"
+	"GoalifyGo/testutil"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTombstonePurgePrunesChangeLog(t *testing.T) {
+	testutil.ObserveLogs(t)
+	db := testutil.SetupDB(t, &models.User{}, &models.EmotionRecord{}, &models.Task{},
+		&models.Subtask{}, &models.TimeRecord{}, &models.SyncChange{})
+	ConfigureTombstoneRetention(90)
+
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	recent := time.Now().Add(-24 * time.Hour)
+	fixtures := []interface{}{
+		&models.User{ID: "u", SyncSeq: 4},
+		// 过期的墓碑
+		&models.Task{ID: "T1", UserID: "u", Status: models.StatusDeleted, LastModified: old},
+		// 保留期内的墓碑
+		&models.Task{ID: "T2", UserID: "u", Status: models.StatusDeleted, LastModified: recent},
+		// 很久没有修改的正常记录
+		&models.Task{ID: "T3", UserID: "u", LastModified: old},
+		&models.SyncChange{UserID: "u", Seq: 2, EntityType: models.EntityTask, EntityID: "T1", ChangedAt: old},
+		&models.SyncChange{UserID: "u", Seq: 3, EntityType: models.EntityTask, EntityID: "T2", ChangedAt: recent},
+		&models.SyncChange{UserID: "u", Seq: 1, EntityType: models.EntityTask, EntityID: "T3", ChangedAt: old},
+	}
+	for _, fixture := range fixtures {
+		if err := db.Create(fixture).Error; err != nil {
+			t.Fatalf("创建测试数据失败: %v", err)
+		}
+	}
+
+	NewTombstoneCollector().purge()
+
+	var tasks []string
+	db.Model(&models.Task{}).Order("id").Pluck("id", &tasks)
+	if len(tasks) != 2 || tasks[0] != "T2" || tasks[1] != "T3" {
+		t.Errorf("tasks = %v, want [T2 T3]", tasks)
+	}
+	var changes []string
+	db.Model(&models.SyncChange{}).Order("entity_id").Pluck("entity_id", &changes)
+	if len(changes) != 2 || changes[0] != "T2" || changes[1] != "T3" {
+		t.Errorf("changes = %v, want [T2 T3]", changes)
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", "u").Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.SyncPrunedSeq != 2 {
+		t.Errorf("sync_pruned_seq = %d, want 2", user.SyncPrunedSeq)
+	}
+	if err := CheckCursorRetained("u", 1); !errors.Is(err, ErrFullResyncRequired) {
+		t.Errorf("CheckCursorRetained(1) = %v, want ErrFullResyncRequired", err)
+	}
+	if err := CheckCursorRetained("u", 2); err != nil {
+		t.Errorf("CheckCursorRetained(2) = %v, want nil", err)
+	}
+}
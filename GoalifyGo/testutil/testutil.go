@@ -0,0 +1,114 @@
+// Package testutil 提供测试使用的数据库、Redis 和日志替身，仅供 _test.go 引用
+package testutil
+
+import (
+	"GoalifyGo/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SetupDB 使用临时 SQLite 文件替换 config.DB 并迁移给定模型，测试结束后恢复。
+// 开启 WAL 和忙等待，事务以 IMMEDIATE 方式开始，并发事务会排队而不是直接失败。
+func SetupDB(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") +
+		"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// SetupMySQL 使用 TEST_MYSQL_DSN 指定的 MySQL 数据库替换 config.DB 并迁移给定模型，
+// 未设置该环境变量时跳过测试。测试开始前和结束后都会删除这些表，不要指向有数据的库。
+func SetupMySQL(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过 MySQL 测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	if err := db.Migrator().DropTable(models...); err != nil {
+		t.Fatalf("清理测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		db.Migrator().DropTable(models...)
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// SetupRedis 使用 miniredis 替换 config.RedisClient，测试结束后恢复
+func SetupRedis(t testing.TB) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	previous := config.RedisClient
+	config.RedisClient = client
+	t.Cleanup(func() {
+		config.RedisClient = previous
+		client.Close()
+	})
+	return server
+}
+
+// ObserveLogs 使用可观察的日志替换 config.Logger，返回记录到的日志，测试结束后恢复
+func ObserveLogs(t testing.TB) *observer.ObservedLogs {
+	t.Helper()
+
+	core, logs := observer.New(zap.DebugLevel)
+	previous := config.Logger
+	config.Logger = zap.New(core).Sugar()
+	t.Cleanup(func() {
+		config.Logger = previous
+	})
+	return logs
+}
+
+// SecurityEvents 返回记录到的指定安全事件
+func SecurityEvents(logs *observer.ObservedLogs, event string) []observer.LoggedEntry {
+	return logs.FilterField(zap.String("securityEvent", event)).AllUntimed()
+}